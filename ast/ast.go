@@ -33,9 +33,19 @@ func (p *Program) TokenLiteral() string {
 }
 
 func (p *Program) String() string {
+	return statements(p.Statements)
+}
+
+// statements returns the source of a list of statements. An expression
+// statement followed by another statement is ended by a semicolon, so that
+// the two are not read back as a single expression.
+func statements(list []Statement) string {
 	var out strings.Builder
-	for _, s := range p.Statements {
+	for i, s := range list {
 		out.WriteString(s.String())
+		if _, ok := s.(*ExpressionStatement); ok && i < len(list)-1 {
+			out.WriteString(";")
+		}
 	}
 	return out.String()
 }
@@ -56,7 +66,7 @@ func (ls *LetStatement) TokenLiteral() string {
 func (ls *LetStatement) String() string {
 	var out strings.Builder
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.TokenLiteral())
+	out.WriteString(declaration(ls.Name))
 	out.WriteString(" = ")
 	if ls.Value != nil {
 		out.WriteString(ls.Value.String())
@@ -65,9 +75,43 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// Const Statement -
+// const x = 5 works like a let statement, but x can never be reassigned
+type ConstStatement struct {
+	Token token.Token `json:"token"` // the token.CONST token (const)
+	Name  *Identifier `json:"name"`  // Name holds the constant name (x)
+	Value Expression  `json:"value"` // Value holds the expression bound to the name (5)
+}
+
+func (cs *ConstStatement) statementNode() {}
+func (cs *ConstStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+func (cs *ConstStatement) String() string {
+	var out strings.Builder
+	out.WriteString(cs.TokenLiteral() + " ")
+	out.WriteString(declaration(cs.Name))
+	out.WriteString(" = ")
+	if cs.Value != nil {
+		out.WriteString(cs.Value.String())
+	}
+	out.WriteString(";")
+	return out.String()
+}
+
 type Identifier struct {
-	Token token.Token `json:"token"` // Type - "IDENT" : Literal - variable name
-	Value string      `json:"value"` // Value - variable name
+	Token token.Token `json:"token"`          // Type - "IDENT" : Literal - variable name
+	Value string      `json:"value"`          // Value - variable name
+	Slot  *Slot       `json:"-"`              // Slot is set by the resolver, identifiers without one are looked up by name
+	Type  Type        `json:"type,omitempty"` // Type is the annotation of a declared name, if any: let x: int
+}
+
+// Slot locates a local variable: Depth is the number of scopes between
+// the identifier and the declaration, Index the position of the variable
+// among the variables of that scope
+type Slot struct {
+	Depth int
+	Index int
 }
 
 func (i *Identifier) expressionNode() {}
@@ -90,7 +134,7 @@ func (ls *AssignStatement) TokenLiteral() string {
 }
 func (ls *AssignStatement) String() string {
 	var out strings.Builder
-	out.WriteString(ls.TokenLiteral() + " ")
+	out.WriteString(ls.Name.String())
 	out.WriteString(" = ")
 	if ls.Value != nil {
 		out.WriteString(ls.Value.String())
@@ -132,15 +176,222 @@ func (ws *WhileStatement) TokenLiteral() string {
 }
 func (ws *WhileStatement) String() string {
 	out := strings.Builder{}
-	out.WriteString("if")
+	out.WriteString("while (")
 	out.WriteString(ws.Condition.String())
+	out.WriteString(")")
 
 	if ws.Consequence != nil {
 		out.WriteString(" ")
-		out.WriteString(ws.Consequence.String())
+		out.WriteString(block(ws.Consequence))
+	}
+	return out.String()
+
+}
+
+// ForStatement is the C-style loop
+// for (let i = 0; i < n; i = i + 1) { ... }
+// Init, Condition and Post are all optional.
+type ForStatement struct {
+	Token     token.Token     `json:"token"` // The 'for' token
+	Init      Statement       `json:"init"`
+	Condition Expression      `json:"condition"`
+	Post      Statement       `json:"post"`
+	Body      *BlockStatement `json:"body"`
+}
+
+func (fs *ForStatement) statementNode() {}
+func (fs *ForStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+func (fs *ForStatement) String() string {
+	out := strings.Builder{}
+	out.WriteString("for (")
+	// the semicolons ending let and assign statements are the ones
+	// separating the clauses
+	if fs.Init != nil {
+		out.WriteString(strings.TrimSuffix(fs.Init.String(), ";"))
+	}
+	out.WriteString("; ")
+	if fs.Condition != nil {
+		out.WriteString(fs.Condition.String())
+	}
+	out.WriteString("; ")
+	if fs.Post != nil {
+		out.WriteString(strings.TrimSuffix(fs.Post.String(), ";"))
 	}
+	out.WriteString(") ")
+	out.WriteString(block(fs.Body))
 	return out.String()
+}
+
+// ForInStatement iterates over the elements of a collection
+// for x in collection { ... }
+type ForInStatement struct {
+	Token    token.Token     `json:"token"` // The 'for' token
+	Variable *Identifier     `json:"variable"`
+	Iterable Expression      `json:"iterable"`
+	Body     *BlockStatement `json:"body"`
+}
+
+func (fs *ForInStatement) statementNode() {}
+func (fs *ForInStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+func (fs *ForInStatement) String() string {
+	out := strings.Builder{}
+	out.WriteString("for ")
+	out.WriteString(fs.Variable.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(" ")
+	out.WriteString(block(fs.Body))
+	return out.String()
+}
+
+type BreakStatement struct {
+	Token token.Token `json:"token"` // The 'break' token
+}
+
+func (bs *BreakStatement) statementNode() {}
+func (bs *BreakStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+func (bs *BreakStatement) String() string {
+	return bs.TokenLiteral() + ";"
+}
 
+type ContinueStatement struct {
+	Token token.Token `json:"token"` // The 'continue' token
+}
+
+func (cs *ContinueStatement) statementNode() {}
+func (cs *ContinueStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+func (cs *ContinueStatement) String() string {
+	return cs.TokenLiteral() + ";"
+}
+
+// ThrowStatement raises its value as an error
+// throw "something went wrong"
+type ThrowStatement struct {
+	Token token.Token `json:"token"` // The 'throw' token
+	Value Expression  `json:"value"`
+}
+
+func (ts *ThrowStatement) statementNode() {}
+func (ts *ThrowStatement) TokenLiteral() string {
+	return ts.Token.Literal
+}
+func (ts *ThrowStatement) String() string {
+	return ts.TokenLiteral() + " " + ts.Value.String() + ";"
+}
+
+// TryStatement -
+// try { ... } catch (e) { ... } finally { ... }
+// At least one of Catch and Finally is present. Parameter is optional even
+// when there is a catch block.
+type TryStatement struct {
+	Token     token.Token     `json:"token"` // The 'try' token
+	Block     *BlockStatement `json:"block"`
+	Parameter *Identifier     `json:"parameter"`
+	Catch     *BlockStatement `json:"catch"`
+	Finally   *BlockStatement `json:"finally"`
+}
+
+func (ts *TryStatement) statementNode() {}
+func (ts *TryStatement) TokenLiteral() string {
+	return ts.Token.Literal
+}
+func (ts *TryStatement) String() string {
+	out := strings.Builder{}
+	out.WriteString("try ")
+	out.WriteString(block(ts.Block))
+	if ts.Catch != nil {
+		out.WriteString(" catch")
+		if ts.Parameter != nil {
+			out.WriteString(" (" + ts.Parameter.String() + ")")
+		}
+		out.WriteString(" ")
+		out.WriteString(block(ts.Catch))
+	}
+	if ts.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(block(ts.Finally))
+	}
+	return out.String()
+}
+
+// FunctionStatement declares a named function
+// fn add(a, b) { a + b }
+// The name is bound before any statement of the enclosing block runs, so
+// declarations can call each other regardless of their order.
+type FunctionStatement struct {
+	Token    token.Token      `json:"token"` // The fn token
+	Name     *Identifier      `json:"name"`
+	Function *FunctionLiteral `json:"function"`
+}
+
+func (fs *FunctionStatement) statementNode() {}
+func (fs *FunctionStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+func (fs *FunctionStatement) String() string {
+	return fs.TokenLiteral() + " " + fs.Name.String() + fs.Function.signature() + " " + block(fs.Function.Body)
+}
+
+// ImportStatement binds a module or some of its exports
+// import "lib/math.monkey" as math
+// import { add, sub } from "lib/math.monkey"
+// Exactly one of Alias and Names is set.
+type ImportStatement struct {
+	Token token.Token   `json:"token"` // The 'import' token
+	Path  string        `json:"path"`
+	Alias *Identifier   `json:"alias"`
+	Names []*Identifier `json:"names"`
+}
+
+func (is *ImportStatement) statementNode() {}
+func (is *ImportStatement) TokenLiteral() string {
+	return is.Token.Literal
+}
+func (is *ImportStatement) String() string {
+	if is.Alias != nil {
+		return is.TokenLiteral() + " \"" + is.Path + "\" as " + is.Alias.String() + ";"
+	}
+	names := []string{}
+	for _, n := range is.Names {
+		names = append(names, n.String())
+	}
+	return is.TokenLiteral() + " { " + strings.Join(names, ", ") + " } from \"" + is.Path + "\";"
+}
+
+// ExportStatement marks a top-level let, const or function declaration as
+// visible to the modules importing this one
+type ExportStatement struct {
+	Token     token.Token `json:"token"`     // The 'export' token
+	Statement Statement   `json:"statement"` // a *LetStatement, *ConstStatement or *FunctionStatement
+}
+
+func (es *ExportStatement) statementNode() {}
+func (es *ExportStatement) TokenLiteral() string {
+	return es.Token.Literal
+}
+func (es *ExportStatement) String() string {
+	return es.TokenLiteral() + " " + es.Statement.String()
+}
+
+// Name returns the name the exported statement declares
+func (es *ExportStatement) Name() string {
+	switch stmt := es.Statement.(type) {
+	case *LetStatement:
+		return stmt.Name.Value
+	case *ConstStatement:
+		return stmt.Name.Value
+	case *FunctionStatement:
+		return stmt.Name.Value
+	}
+	return ""
 }
 
 type ExpressionStatement struct {
@@ -245,17 +496,18 @@ func (ie *IfExpression) expressionNode() {}
 
 func (ie *IfExpression) String() string {
 	out := strings.Builder{}
-	out.WriteString("if")
+	out.WriteString("if (")
 	out.WriteString(ie.Condition.String())
+	out.WriteString(")")
 
 	if ie.Consequence != nil {
 		out.WriteString(" ")
-		out.WriteString(ie.Consequence.String())
+		out.WriteString(block(ie.Consequence))
 	}
 
 	if ie.Alternative != nil {
-		out.WriteString("else ")
-		out.WriteString(ie.Alternative.String())
+		out.WriteString(" else ")
+		out.WriteString(block(ie.Alternative))
 	}
 
 	return out.String()
@@ -264,6 +516,7 @@ func (ie *IfExpression) String() string {
 type BlockStatement struct {
 	Token      token.Token `json:"token"` // the '{' token
 	Statements []Statement `json:"statements"`
+	End        token.Token `json:"-"` // the '}' token, it is left out of the JSON of the tree
 }
 
 func (bs *BlockStatement) statementNode() {}
@@ -272,38 +525,52 @@ func (bs *BlockStatement) TokenLiteral() string {
 	return bs.Token.Literal
 }
 
+// String returns the statements of the block, without the braces around
+// them
 func (bs *BlockStatement) String() string {
-	out := strings.Builder{}
+	return statements(bs.Statements)
+}
 
-	for _, s := range bs.Statements {
-		out.WriteString(s.String())
+// block returns the statements of bs between braces
+func block(bs *BlockStatement) string {
+	if len(bs.Statements) == 0 {
+		return "{}"
 	}
-
-	return out.String()
+	return "{ " + bs.String() + " }"
 }
 
 type FunctionLiteral struct {
 	Token      token.Token     `json:"token"` // The fn token
+	Name       string          `json:"name"`  // Name is set for declarations and for literals bound by let or const
 	Parameters []*Identifier   `json:"parameters"`
+	ReturnType Type            `json:"return_type,omitempty"` // ReturnType is the annotation after the parameters, if any
 	Body       *BlockStatement `json:"body"`
 }
 
 func (fl *FunctionLiteral) String() string {
 	var out strings.Builder
-	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
-	}
 
 	out.WriteString(fl.TokenLiteral())
-	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") ")
-	out.WriteString(fl.Body.String())
+	out.WriteString(fl.signature())
+	out.WriteString(" ")
+	out.WriteString(block(fl.Body))
 
 	return out.String()
 }
 
+// signature returns the parameter list and the return type of fl
+func (fl *FunctionLiteral) signature() string {
+	params := []string{}
+	for _, p := range fl.Parameters {
+		params = append(params, declaration(p))
+	}
+	signature := "(" + strings.Join(params, ", ") + ")"
+	if fl.ReturnType != nil {
+		signature += ": " + fl.ReturnType.String()
+	}
+	return signature
+}
+
 func (fl *FunctionLiteral) expressionNode() {}
 
 func (fl *FunctionLiteral) TokenLiteral() string {
@@ -314,6 +581,7 @@ type CallExpression struct {
 	Token     token.Token  `json:"token"` // T`he '(' token
 	Function  Expression   `json:"function"`
 	Arguments []Expression `json:"arguments"`
+	Tail      bool         `json:"-"` // Tail is set by the parser when the enclosing function returns the value of the call
 }
 
 func (ce *CallExpression) expressionNode() {}
@@ -346,4 +614,189 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode() {}
 func (sl *StringLiteral) TokenLiteral() string {return sl.Token.Literal}
-func (sl *StringLiteral) String() string {return sl.Token.Literal}
+func (sl *StringLiteral) String() string {return "\"" + sl.Value + "\""}
+
+type ArrayLiteral struct {
+	Token    token.Token  `json:"token"` // the '[' token
+	Elements []Expression `json:"elements"`
+}
+
+func (al *ArrayLiteral) expressionNode() {}
+func (al *ArrayLiteral) TokenLiteral() string {
+	return al.Token.Literal
+}
+func (al *ArrayLiteral) String() string {
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+type IndexExpression struct {
+	Token token.Token `json:"token"` // the '[' token
+	Left  Expression  `json:"left"`
+	Index Expression  `json:"index"`
+}
+
+func (ie *IndexExpression) expressionNode() {}
+func (ie *IndexExpression) TokenLiteral() string {
+	return ie.Token.Literal
+}
+func (ie *IndexExpression) String() string {
+	return "(" + ie.Left.String() + "[" + ie.Index.String() + "])"
+}
+
+type HashLiteral struct {
+	Token token.Token `json:"token"` // the '{' token
+	Pairs []HashPair  `json:"pairs"` // Pairs keeps the order in which they were written
+}
+
+type HashPair struct {
+	Key   Expression `json:"key"`
+	Value Expression `json:"value"`
+}
+
+func (hl *HashLiteral) expressionNode() {}
+func (hl *HashLiteral) TokenLiteral() string {
+	return hl.Token.Literal
+}
+func (hl *HashLiteral) String() string {
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// MatchExpression compares Subject against the pattern of each arm in turn
+// and evaluates to the body of the first arm that matches
+//
+//	match (x) { 1 => "one", [a, b] => a + b, _ => "other" }
+type MatchExpression struct {
+	Token   token.Token `json:"token"` // The 'match' token
+	Subject Expression  `json:"subject"`
+	Arms    []*MatchArm `json:"arms"`
+}
+
+// MatchArm is a single 'pattern => body' of a match expression. A pattern is
+// a literal, an identifier which binds the value (_ binds nothing), or an
+// array or hash literal made of further patterns.
+type MatchArm struct {
+	Pattern Expression      `json:"pattern"`
+	Body    *BlockStatement `json:"body"`
+}
+
+func (me *MatchExpression) expressionNode() {}
+func (me *MatchExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+func (me *MatchExpression) String() string {
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.Pattern.String()+" => "+block(arm.Body))
+	}
+	return "match (" + me.Subject.String() + ") {" + strings.Join(arms, ", ") + "}"
+}
+
+// MemberExpression reads an export of a module or a string key of a hash
+// math.add
+type MemberExpression struct {
+	Token    token.Token `json:"token"` // the '.' token
+	Object   Expression  `json:"object"`
+	Property *Identifier `json:"property"`
+}
+
+func (me *MemberExpression) expressionNode() {}
+func (me *MemberExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+func (me *MemberExpression) String() string {
+	return me.Object.String() + "." + me.Property.String()
+}
+
+// declaration returns a declared name along with its type annotation
+func declaration(ident *Identifier) string {
+	if ident.Type == nil {
+		return ident.Value
+	}
+	return ident.Value + ": " + ident.Type.String()
+}
+
+// Type is a type annotation. Annotations are optional and only used by the
+// type checker, the evaluator ignores them.
+type Type interface {
+	Node
+	typeNode()
+}
+
+// NamedType is one of the basic types: int, string, bool, null and any,
+// which accepts every value
+type NamedType struct {
+	Token token.Token `json:"token"`
+	Name  string      `json:"name"`
+}
+
+func (nt *NamedType) typeNode() {}
+func (nt *NamedType) TokenLiteral() string {
+	return nt.Token.Literal
+}
+func (nt *NamedType) String() string {
+	return nt.Name
+}
+
+// ArrayType is the type of arrays whose elements all have the type Element
+// [int]
+type ArrayType struct {
+	Token   token.Token `json:"token"` // the '[' token
+	Element Type        `json:"element"`
+}
+
+func (at *ArrayType) typeNode() {}
+func (at *ArrayType) TokenLiteral() string {
+	return at.Token.Literal
+}
+func (at *ArrayType) String() string {
+	return "[" + at.Element.String() + "]"
+}
+
+// HashType is the type of hashes with keys of type Key and values of type Value
+// {string: int}
+type HashType struct {
+	Token token.Token `json:"token"` // the '{' token
+	Key   Type        `json:"key"`
+	Value Type        `json:"value"`
+}
+
+func (ht *HashType) typeNode() {}
+func (ht *HashType) TokenLiteral() string {
+	return ht.Token.Literal
+}
+func (ht *HashType) String() string {
+	return "{" + ht.Key.String() + ": " + ht.Value.String() + "}"
+}
+
+// FunctionType is the type of functions
+// fn(int, string): bool
+// Return is nil when the return type is left out, which means any.
+type FunctionType struct {
+	Token      token.Token `json:"token"` // the fn token
+	Parameters []Type      `json:"parameters"`
+	Return     Type        `json:"return"`
+}
+
+func (ft *FunctionType) typeNode() {}
+func (ft *FunctionType) TokenLiteral() string {
+	return ft.Token.Literal
+}
+func (ft *FunctionType) String() string {
+	params := []string{}
+	for _, p := range ft.Parameters {
+		params = append(params, p.String())
+	}
+	out := "fn(" + strings.Join(params, ", ") + ")"
+	if ft.Return != nil {
+		out += ": " + ft.Return.String()
+	}
+	return out
+}
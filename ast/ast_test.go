@@ -2,6 +2,7 @@ package ast
 
 import (
 	"monkey/token"
+	"strings"
 	"testing"
 )
 
@@ -36,3 +37,53 @@ func TestString(t *testing.T) {
 
 	}
 }
+
+func TestInspect(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{Name: ident("x"), Value: &InfixExpression{Left: ident("a"), Operator: "+", Right: ident("b")}},
+			&ExpressionStatement{Expression: &CallExpression{Function: ident("f"), Arguments: []Expression{ident("x")}}},
+		},
+	}
+
+	visited := []string{}
+	Inspect(program, func(node Node) bool {
+		switch node := node.(type) {
+		case *Identifier:
+			visited = append(visited, node.Value)
+		case *CallExpression:
+			// skip the arguments
+			visited = append(visited, "call")
+			return false
+		}
+		return true
+	})
+
+	if got := strings.Join(visited, " "); got != "x a b call" {
+		t.Errorf("wrong nodes visited: %q", got)
+	}
+}
+
+func TestRunsCode(t *testing.T) {
+	tests := []struct {
+		node     Node
+		expected bool
+	}{
+		{&LetStatement{}, true},
+		{&ExpressionStatement{}, true},
+		{&WhileStatement{}, true},
+		{&BlockStatement{}, false},
+		{&FunctionStatement{}, false},
+		{&ExportStatement{}, false},
+		{&Identifier{}, false},
+	}
+
+	for _, tt := range tests {
+		if got := RunsCode(tt.node); got != tt.expected {
+			t.Errorf("RunsCode(%T) = %t, expected %t", tt.node, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package ast
+
+import (
+	"monkey/token"
+	"reflect"
+)
+
+// Position is a 1-based line and column in the source
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Span is the part of the source a node was parsed from. End is the
+// position right after the last token of the node.
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+var tokenType = reflect.TypeOf(token.Token{})
+
+// SpanOf returns the span covering every token stored in node and in its
+// children. Closing delimiters other than the brace of a block are not
+// stored in the tree, so the span of a call ends with its last argument.
+func SpanOf(node Node) Span {
+	var span Span
+	visitTokens(reflect.ValueOf(node), func(tok token.Token) {
+		if tok.Line == 0 {
+			return
+		}
+		start := Position{Line: tok.Line, Column: tok.Column}
+		end := Position{Line: tok.Line, Column: tok.Column + tokenLength(tok)}
+		if span.Start.Line == 0 || before(start, span.Start) {
+			span.Start = start
+		}
+		if before(span.End, end) {
+			span.End = end
+		}
+	})
+	return span
+}
+
+// RunsCode reports whether node is a statement that runs code of its own.
+// Blocks and the declarations of functions and exports do not, the code
+// they hold is in other statements.
+func RunsCode(node Node) bool {
+	switch node.(type) {
+	case *BlockStatement, *FunctionStatement, *ExportStatement:
+		return false
+	case Statement:
+		return true
+	}
+	return false
+}
+
+func before(a, b Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
+
+// tokenLength returns the number of columns tok takes in the source
+func tokenLength(tok token.Token) int {
+	if tok.Type == token.STRING {
+		return len(tok.Literal) + 2 // the quotes are not part of the literal
+	}
+	if tok.Literal == "" {
+		return 1
+	}
+	return len(tok.Literal)
+}
+
+// visitTokens calls visit with every token reachable from v
+func visitTokens(v reflect.Value, visit func(token.Token)) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			visitTokens(v.Elem(), visit)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			visitTokens(v.Index(i), visit)
+		}
+	case reflect.Struct:
+		if v.Type() == tokenType {
+			visit(v.Interface().(token.Token))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				visitTokens(v.Field(i), visit)
+			}
+		}
+	}
+}
+
+var nodeType = reflect.TypeOf((*Node)(nil)).Elem()
+
+// Inspect calls f with node and then with every node reachable from it,
+// parents before their children, in the order their fields are declared.
+// The children of a node are skipped when f returns false for it.
+func Inspect(node Node, f func(Node) bool) {
+	inspect(reflect.ValueOf(node), f)
+}
+
+func inspect(v reflect.Value, f func(Node) bool) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if !v.IsNil() {
+			inspect(v.Elem(), f)
+		}
+	case reflect.Pointer:
+		if v.IsNil() {
+			return
+		}
+		if v.Type().Implements(nodeType) && !f(v.Interface().(Node)) {
+			return
+		}
+		inspect(v.Elem(), f)
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			inspect(v.Index(i), f)
+		}
+	case reflect.Struct:
+		if v.Type() == tokenType {
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				inspect(v.Field(i), f)
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"context"
+	"monkey/module"
+	"syscall/js"
+	"time"
+)
+
+// interpretAsync(code, onOutput, modules?, signal?) evaluates code in the
+// background and returns a Promise. onOutput(stream, chunk) receives what
+// the program prints as it is printed, stream being "stdout" or "stderr".
+// The Promise resolves to {result} when the program finishes and rejects
+// with an Error when it fails or when the AbortSignal signal is aborted.
+func interpretAsync(this js.Value, args []js.Value) any {
+	if len(args) < 2 || len(args) > 4 || args[1].Type() != js.TypeFunction {
+		return js.ValueOf("err: wrong data")
+	}
+	code, onOutput := args[0].String(), args[1]
+	modules := module.MapResolver{}
+	if len(args) > 2 {
+		modules = modulesFromJS(args[2])
+	}
+	signal := js.Undefined()
+	if len(args) > 3 {
+		signal = args[3]
+	}
+
+	executor := js.FuncOf(func(this js.Value, promise []js.Value) any {
+		resolve, reject := promise[0], promise[1]
+
+		ctx, cancel := context.WithCancel(context.Background())
+		onAbort := js.FuncOf(func(this js.Value, args []js.Value) any {
+			cancel()
+			return nil
+		})
+		if signal.Truthy() {
+			if signal.Get("aborted").Bool() {
+				cancel()
+			}
+			signal.Call("addEventListener", "abort", onAbort)
+		}
+
+		go func() {
+			defer func() {
+				if signal.Truthy() {
+					signal.Call("removeEventListener", "abort", onAbort)
+				}
+				onAbort.Release()
+				cancel()
+			}()
+
+			stdout := &jsWriter{stream: "stdout", callback: onOutput}
+			stderr := &jsWriter{stream: "stderr", callback: onOutput}
+			result, isError := run(&yieldContext{Context: ctx}, code, modules, stdout, stderr)
+			if isError {
+				reject.Invoke(js.Global().Get("Error").New(result))
+				return
+			}
+			resolve.Invoke(js.ValueOf(map[string]any{"result": result}))
+		}()
+		return nil
+	})
+	defer executor.Release()
+
+	return js.Global().Get("Promise").New(executor)
+}
+
+// jsWriter passes everything written to it to a JS callback
+type jsWriter struct {
+	stream   string
+	callback js.Value
+}
+
+func (w *jsWriter) Write(p []byte) (int, error) {
+	w.callback.Invoke(w.stream, string(p))
+	return len(p), nil
+}
+
+// yieldInterval is how long evaluation runs before letting the browser
+// handle events
+const yieldInterval = 50 * time.Millisecond
+
+// yieldContext lets the browser run while a program is evaluated. Goroutines
+// are not preempted on wasm, so a busy program would otherwise keep the page
+// from painting its output or delivering the click that aborts it. The
+// evaluator checks Done on every call and loop iteration, which is where
+// yieldContext sleeps once yieldInterval has passed.
+type yieldContext struct {
+	context.Context
+	lastYield time.Time
+}
+
+func (c *yieldContext) Done() <-chan struct{} {
+	if c.lastYield.IsZero() {
+		c.lastYield = time.Now()
+	} else if time.Since(c.lastYield) > yieldInterval {
+		time.Sleep(time.Millisecond)
+		c.lastYield = time.Now()
+	}
+	return c.Context.Done()
+}
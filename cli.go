@@ -0,0 +1,315 @@
+//go:build !js || !wasm
+// +build !js !wasm
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/coverage"
+	"monkey/dap"
+	"monkey/debug"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/lsp"
+	"monkey/module"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/profile"
+	"monkey/repl"
+	"monkey/resolver"
+	"monkey/stdlib"
+	"monkey/tester"
+	"monkey/types"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const usage = `usage: monkey [command] [arguments]
+
+commands:
+	run [--profile out.pb] <file>  evaluate a Monkey program, writing its
+	                               profile to out.pb in the pprof format
+	debug <file>                   step through a Monkey program
+	test [flags] [path...]         run the test_* functions of the files named
+	                               *_test.monkey among paths, . by default
+	    -v                         report every test, not only the failed ones
+	    --junit out.xml            write the results in the JUnit XML format
+	    --cover                    report the lines and branches they ran
+	    --coverprofile out.lcov    write the coverage in the LCOV format
+	    --coverhtml out.html       write the coverage as an HTML page
+	check <file>                   report the type errors of a Monkey program
+	lsp                            start a language server on stdin and stdout
+	dap                            start a debug adapter on stdin and stdout
+	(none)                         start the REPL
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		repl.Start(os.Stdin, os.Stdout)
+		return
+	}
+
+	switch os.Args[1] {
+	case "run":
+		flags := flag.NewFlagSet("run", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		profilePath := flags.String("profile", "", "")
+		if err := flags.Parse(os.Args[2:]); err != nil || flags.NArg() != 1 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		if *profilePath != "" {
+			os.Exit(profileFile(flags.Arg(0), *profilePath, os.Stdout, os.Stderr))
+		}
+		os.Exit(runFile(flags.Arg(0), os.Stdout, os.Stderr))
+	case "test":
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		var options testOptions
+		flags.BoolVar(&options.verbose, "v", false, "")
+		flags.StringVar(&options.junit, "junit", "", "")
+		flags.BoolVar(&options.cover, "cover", false, "")
+		flags.StringVar(&options.lcov, "coverprofile", "", "")
+		flags.StringVar(&options.html, "coverhtml", "", "")
+		if err := flags.Parse(os.Args[2:]); err != nil {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		paths := flags.Args()
+		if len(paths) == 0 {
+			paths = []string{"."}
+		}
+		os.Exit(testFiles(paths, options, os.Stdout, os.Stderr))
+	case "debug":
+		if len(os.Args) != 3 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		os.Exit(debugFile(os.Args[2], os.Stdin, os.Stdout, os.Stderr))
+	case "check":
+		if len(os.Args) != 3 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		os.Exit(checkFile(os.Args[2], os.Stdout))
+	case "lsp":
+		if err := lsp.Serve(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "dap":
+		if err := dap.Serve(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// runFile evaluates the program in path, writes its output and result to
+// stdout and errors to stderr, and returns the exit code of the process.
+// Imports are resolved relative to the directory of path.
+func runFile(path string, stdout, stderr io.Writer) int {
+	program, _, env, ok := load(path, stdout, stderr)
+	if !ok {
+		return 1
+	}
+	return report(evaluator.Eval(program, env), stdout, stderr)
+}
+
+// profileFile evaluates the program in path under the profiler, and writes
+// its profile to out
+func profileFile(path, out string, stdout, stderr io.Writer) int {
+	program, _, env, ok := load(path, stdout, stderr)
+	if !ok {
+		return 1
+	}
+	profiler := profile.New()
+	code := report(profiler.Run(program, env), stdout, stderr)
+
+	if err := writeFile(out, profiler.WritePprof); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return code
+}
+
+// testOptions are the flags of monkey test, every report of the coverage
+// turns coverage on
+type testOptions struct {
+	verbose bool
+	junit   string
+	cover   bool
+	lcov    string
+	html    string
+}
+
+// testFiles runs the tests of the files named *_test.monkey among paths and
+// in their directories, and returns the exit code of the process. With
+// coverage on, it reports the coverage of the modules the tests load,
+// outside of the test files and the standard library.
+func testFiles(paths []string, options testOptions, stdout, stderr io.Writer) int {
+	files, err := tester.Discover(paths)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(stderr, "no test files found")
+		return 1
+	}
+
+	runner := tester.NewRunner()
+	cover := coverage.New(func(module string) bool {
+		return !strings.HasPrefix(module, stdlib.Prefix) && !strings.HasSuffix(module, tester.Suffix)
+	})
+	covering := options.cover || options.lcov != "" || options.html != ""
+	if covering {
+		runner.Hook = cover
+	}
+
+	code := 0
+	suites := []*tester.Suite{}
+	for _, file := range files {
+		suite := runner.Run(file)
+		if !suite.Passed() {
+			code = 1
+		}
+		suites = append(suites, suite)
+	}
+	tester.WriteText(stdout, suites, options.verbose)
+
+	write := func(path string, write func(w io.Writer) error) {
+		if err := writeFile(path, write); err != nil {
+			fmt.Fprintln(stderr, err)
+			code = 1
+		}
+	}
+	if options.junit != "" {
+		write(options.junit, func(w io.Writer) error { return tester.WriteJUnit(w, suites) })
+	}
+	if covering {
+		cover.WriteText(stdout)
+	}
+	if options.lcov != "" {
+		write(options.lcov, cover.WriteLCOV)
+	}
+	if options.html != "" {
+		read := stdlib.Resolver{Next: module.FileResolver{}}.Read
+		write(options.html, func(w io.Writer) error { return cover.WriteHTML(w, read) })
+	}
+	return code
+}
+
+// writeFile creates the file at path and writes it with write
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// debugFile evaluates the program in path under the debugger, driven by
+// the commands read from in
+func debugFile(path string, in io.Reader, stdout, stderr io.Writer) int {
+	program, source, env, ok := load(path, stdout, stderr)
+	if !ok {
+		return 1
+	}
+	return report(debug.Start(program, source, env, in, stdout), stdout, stderr)
+}
+
+// load parses and resolves the program in path and returns it with its
+// source and the environment to evaluate it in, whose output goes to
+// stdout and stderr. It reports false, after writing the errors to stderr,
+// when the program cannot run.
+func load(path string, stdout, stderr io.Writer) (*ast.Program, string, *object.Environment, bool) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return nil, "", nil, false
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		fmt.Fprint(stderr, printParserErrors(p.Errors()))
+		return nil, "", nil, false
+	}
+
+	diagnostics := resolver.Resolve(program, nil)
+	if errors := resolver.Errors(diagnostics); len(errors) != 0 {
+		fmt.Fprint(stderr, printResolverErrors(errors))
+		return nil, "", nil, false
+	}
+	for _, d := range diagnostics {
+		fmt.Fprintf(stderr, "%s:%s\n", path, d)
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return nil, "", nil, false
+	}
+
+	env := object.NewEnvironment()
+	env.SetModule(absPath)
+	env.Runtime().Loader = module.NewLoader(stdlib.Resolver{Next: module.FileResolver{}})
+	env.Runtime().Stdout = stdout
+	env.Runtime().Stderr = stderr
+	return program, string(source), env, true
+}
+
+// report writes the result of a program, or its error, and returns the
+// exit code of the process
+func report(evaluated object.Object, stdout, stderr io.Writer) int {
+	if errObj, ok := evaluated.(*object.Error); ok {
+		fmt.Fprintln(stderr, printRuntimeError(errObj))
+		return 1
+	}
+	if evaluated != nil && evaluated != evaluator.NullObj {
+		fmt.Fprintln(stdout, evaluated.Inspect())
+	}
+	return 0
+}
+
+// checkFile reports the resolver diagnostics and type errors of the program
+// in path, without running it, and returns the exit code of the process
+func checkFile(path string, out io.Writer) int {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		fmt.Fprint(out, printParserErrors(p.Errors()))
+		return 1
+	}
+
+	code := 0
+	for _, d := range resolver.Resolve(program, nil) {
+		fmt.Fprintf(out, "%s:%s\n", path, d)
+		if d.Severity == resolver.Error {
+			code = 1
+		}
+	}
+	for _, err := range types.Check(program).Errors {
+		fmt.Fprintf(out, "%s:%s\n", path, err)
+		code = 1
+	}
+	return code
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/module"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/resolver"
+	"monkey/stdlib"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "regenerate the golden files of testdata/conformance")
+
+// conformanceDir holds the programs of the conformance suite. Every
+// program.monkey comes with the golden files program.stdout, program.result
+// and program.error, holding what it prints, the value it ends with and the
+// error it stops with, as the CLI reports them. A golden file that would be
+// empty is left out. Modules the programs import are kept in lib, whose
+// files are not programs of their own.
+const conformanceDir = "testdata/conformance"
+
+// outcome is what running a program gave
+type outcome struct {
+	stdout string
+	result string
+	err    string
+}
+
+// backend is a way of running Monkey programs, which must all agree
+type backend struct {
+	name string
+	run  func(path, source string) outcome
+}
+
+var backends = []backend{
+	{"evaluator", evaluate},
+}
+
+// evaluate runs a program with the tree-walking evaluator, loading its
+// imports from disk relative to path
+func evaluate(path, source string) outcome {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return outcome{err: printParserErrors(p.Errors())}
+	}
+	if errs := resolver.Errors(resolver.Resolve(program, nil)); len(errs) != 0 {
+		return outcome{err: printResolverErrors(errs)}
+	}
+
+	var stdout strings.Builder
+	env := object.NewEnvironment()
+	env.SetModule(filepath.ToSlash(path))
+	env.Runtime().Loader = module.NewLoader(stdlib.Resolver{Next: module.FileResolver{}})
+	env.Runtime().Stdout = &stdout
+	env.Runtime().Stderr = &stdout
+
+	o := outcome{}
+	evaluated := evaluator.Eval(program, env)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		o.err = printRuntimeError(errObj) + "\n"
+	} else if evaluated != nil && evaluated != evaluator.NullObj {
+		o.result = evaluated.Inspect() + "\n"
+	}
+	o.stdout = stdout.String()
+	return o
+}
+
+func TestConformance(t *testing.T) {
+	programs, err := filepath.Glob(filepath.Join(conformanceDir, "*.monkey"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(programs) == 0 {
+		t.Fatalf("no programs in %s", conformanceDir)
+	}
+
+	for _, path := range programs {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		base := strings.TrimSuffix(path, ".monkey")
+
+		for _, b := range backends {
+			t.Run(b.name+"/"+filepath.Base(base), func(t *testing.T) {
+				got := b.run(path, string(source))
+				goldens := []struct {
+					ext  string
+					text string
+				}{
+					{".stdout", got.stdout},
+					{".result", got.result},
+					{".error", got.err},
+				}
+
+				for _, golden := range goldens {
+					file := base + golden.ext
+					// the goldens are written from the first backend, the
+					// others are only compared to them
+					if *update && b.name == backends[0].name {
+						writeGolden(t, file, golden.text)
+						continue
+					}
+					expected, err := os.ReadFile(file)
+					if err != nil && !os.IsNotExist(err) {
+						t.Fatal(err)
+					}
+					if string(expected) != golden.text {
+						t.Errorf("%s differs:\n%s", file, lineDiff(string(expected), golden.text))
+					}
+				}
+			})
+		}
+	}
+}
+
+// writeGolden writes text to file, or removes file when text is empty
+func writeGolden(t *testing.T, file, text string) {
+	t.Helper()
+	if text == "" {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		return
+	}
+	if err := os.WriteFile(file, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// lineDiff shows the lines of expected and got side by side from the first
+// line where they differ
+func lineDiff(expected, got string) string {
+	a, b := strings.Split(expected, "\n"), strings.Split(got, "\n")
+	first := 0
+	for first < len(a) && first < len(b) && a[first] == b[first] {
+		first++
+	}
+	var out strings.Builder
+	for i := first; i < len(a); i++ {
+		out.WriteString("-" + a[i] + "\n")
+	}
+	for i := first; i < len(b); i++ {
+		out.WriteString("+" + b[i] + "\n")
+	}
+	return out.String()
+}
@@ -0,0 +1,171 @@
+// Package coverage records which statements of Monkey programs ran and which
+// way their conditions went, and reports it as text, HTML or LCOV.
+package coverage
+
+import (
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"sort"
+)
+
+// File is the coverage of a module
+type File struct {
+	Module string
+	// Lines holds the number of times the statements starting on every line
+	// with code ran
+	Lines    map[int]int64
+	Branches []*Branch
+
+	branches map[branchKey]*Branch
+}
+
+// Branch is the coverage of the condition of an if, a while or a for. Taken
+// is the number of times it held, running the consequence or the body of
+// the loop, and NotTaken the number of times it did not.
+type Branch struct {
+	Kind     string
+	Line     int
+	Column   int
+	Taken    int64
+	NotTaken int64
+}
+
+type branchKey struct {
+	line   int
+	column int
+}
+
+// site is a statement starting on a line of a file
+type site struct {
+	file *File
+	line int
+}
+
+// Coverage is a Hook recording the coverage of the programs it runs and of
+// the modules they import. It can run several programs, the coverage of the
+// modules they share adds up.
+type Coverage struct {
+	include    func(module string) bool
+	files      map[string]*File
+	programs   map[*ast.Program]bool
+	statements map[ast.Node]site
+	conditions map[ast.Node]*Branch
+}
+
+// New returns an empty coverage of the modules include reports true for, or
+// of every module when it is nil
+func New(include func(module string) bool) *Coverage {
+	return &Coverage{
+		include:    include,
+		files:      map[string]*File{},
+		programs:   map[*ast.Program]bool{},
+		statements: map[ast.Node]site{},
+		conditions: map[ast.Node]*Branch{},
+	}
+}
+
+// Run evaluates program in env, recording its coverage
+func (c *Coverage) Run(program *ast.Program, env *object.Environment) object.Object {
+	return evaluator.EvalWithHook(program, env, c)
+}
+
+// Files returns the coverage of the modules that were loaded, sorted by
+// path
+func (c *Coverage) Files() []*File {
+	files := make([]*File, 0, len(c.files))
+	for _, f := range c.files {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Module < files[j].Module })
+	return files
+}
+
+// add records the statements and the conditions of the program of a
+// module, the first time it runs
+func (c *Coverage) add(program *ast.Program, module string) {
+	c.programs[program] = true
+	if c.include != nil && !c.include(module) {
+		return
+	}
+	f, ok := c.files[module]
+	if !ok {
+		f = &File{Module: module, Lines: map[int]int64{}, branches: map[branchKey]*Branch{}}
+		c.files[module] = f
+	}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		var kind string
+		var condition ast.Expression
+		switch node := node.(type) {
+		case *ast.IfExpression:
+			kind, condition = "if", node.Condition
+		case *ast.WhileStatement:
+			kind, condition = "while", node.Condition
+		case *ast.ForStatement:
+			kind, condition = "for", node.Condition
+		}
+		if ast.RunsCode(node) {
+			line := ast.SpanOf(node).Start.Line
+			c.statements[node] = site{file: f, line: line}
+			if _, ok := f.Lines[line]; !ok {
+				f.Lines[line] = 0
+			}
+		}
+		if condition == nil {
+			return true
+		}
+
+		// a module loaded by several programs is parsed again for each, its
+		// branches are told apart by their position
+		start := ast.SpanOf(node).Start
+		key := branchKey{line: start.Line, column: start.Column}
+		b, ok := f.branches[key]
+		if !ok {
+			b = &Branch{Kind: kind, Line: start.Line, Column: start.Column}
+			f.branches[key] = b
+			f.Branches = append(f.Branches, b)
+			sort.Slice(f.Branches, func(i, j int) bool {
+				if f.Branches[i].Line != f.Branches[j].Line {
+					return f.Branches[i].Line < f.Branches[j].Line
+				}
+				return f.Branches[i].Column < f.Branches[j].Column
+			})
+		}
+		c.conditions[condition] = b
+		return true
+	})
+}
+
+func (c *Coverage) Before(node ast.Node, env *object.Environment) *object.Error {
+	if program, ok := node.(*ast.Program); ok && !c.programs[program] {
+		c.add(program, env.Module())
+	}
+	if s, ok := c.statements[node]; ok {
+		s.file.Lines[s.line]++
+	}
+	return nil
+}
+
+func (c *Coverage) After(node ast.Node, env *object.Environment, result object.Object) {
+	b, ok := c.conditions[node]
+	if !ok {
+		return
+	}
+	if _, isError := result.(*object.Error); isError {
+		return
+	}
+	if evaluator.IsTruthy(result) {
+		b.Taken++
+	} else {
+		b.NotTaken++
+	}
+}
+
+func (c *Coverage) Call(fn *object.Function, args []object.Object) {}
+
+func (c *Coverage) Return(fn *object.Function, result object.Object) {}
+
+// NestTailCalls lets tail calls replace their caller, coverage only counts
+// what runs
+func (c *Coverage) NestTailCalls() bool { return false }
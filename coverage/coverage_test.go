@@ -0,0 +1,156 @@
+package coverage
+
+import (
+	"fmt"
+	"monkey/lexer"
+	"monkey/module"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/resolver"
+	"strings"
+	"testing"
+)
+
+var modules = module.MapResolver{
+	"lib.monkey": `export fn sign(n) {
+	if (n < 0) {
+		return -1;
+	}
+	if (n == 0) { 0 } else { 1 }
+}
+
+export fn unused() {
+	puts("never");
+}`,
+}
+
+// run evaluates the program of module main.monkey with input as its source
+func run(t *testing.T, c *Coverage, input string) object.Object {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	if errors := resolver.Errors(resolver.Resolve(program, nil)); len(errors) != 0 {
+		t.Fatalf("resolver errors: %v", errors)
+	}
+	env := object.NewEnvironment()
+	env.SetModule("main.monkey")
+	env.Runtime().Loader = module.NewLoader(modules)
+	result := c.Run(program, env)
+	return result
+}
+
+// summary returns the lines of f with the number of times they ran, and
+// its branches with the number of times they were taken and not
+func summary(f *File) string {
+	parts := []string{}
+	for _, line := range f.lines() {
+		parts = append(parts, fmt.Sprintf("%d:%d", line, f.Lines[line]))
+	}
+	for _, b := range f.Branches {
+		parts = append(parts, fmt.Sprintf("%s@%d:%d/%d", b.Kind, b.Line, b.Taken, b.NotTaken))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestCoverage(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1;\nif (x > 1) { x } else { 0 }", "1:1 2:2 if@2:0/1"},
+		{"let i = 0;\nwhile (i < 3) {\n\ti = i + 1;\n}", "1:1 2:1 3:3 while@2:3/1"},
+		{"for (let i = 0; i < 2; i = i + 1) {\n\tputs(i);\n}", "1:4 2:2 for@1:2/1"},
+		{"fn f() {\n\t1\n}\nlet g = fn() { 2 };", "2:0 4:1"},
+		// a condition that fails goes neither way
+		{"if (1 / 0) { 1 }", "1:1 if@1:0/0"},
+	}
+
+	for _, tt := range tests {
+		c := New(nil)
+		run(t, c, tt.input)
+		files := c.Files()
+		if len(files) != 1 || files[0].Module != "main.monkey" {
+			t.Fatalf("input %q: expected the coverage of main.monkey, got %v", tt.input, files)
+		}
+		if got := summary(files[0]); got != tt.expected {
+			t.Errorf("input %q: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestModules(t *testing.T) {
+	c := New(func(module string) bool { return module != "main.monkey" })
+	run(t, c, `import "lib.monkey" as lib; lib.sign(5)`)
+	run(t, c, `import "lib.monkey" as lib; lib.sign(-5)`)
+
+	files := c.Files()
+	if len(files) != 1 || files[0].Module != "lib.monkey" {
+		t.Fatalf("expected the coverage of lib.monkey only, got %v", files)
+	}
+	// the module is loaded by both programs, its coverage adds up
+	expected := "2:2 3:1 5:2 9:0 if@2:1/1 if@5:0/1"
+	if got := summary(files[0]); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if run, total := files[0].LinesRun(); run != 3 || total != 4 {
+		t.Errorf("expected 3 of 4 lines to run, got %d of %d", run, total)
+	}
+	if taken, total := files[0].BranchesTaken(); taken != 3 || total != 4 {
+		t.Errorf("expected 3 of 4 branches to be taken, got %d of %d", taken, total)
+	}
+}
+
+func TestReports(t *testing.T) {
+	c := New(func(module string) bool { return module != "main.monkey" })
+	run(t, c, `import "lib.monkey" as lib; lib.sign(5)`)
+
+	var text strings.Builder
+	c.WriteText(&text)
+	expected := `lib.monkey  lines 50.0% (2/4)  branches 50.0% (2/4)  not run: 3, 9
+total       lines 50.0% (2/4)  branches 50.0% (2/4)
+`
+	if text.String() != expected {
+		t.Errorf("expected the text report\n%s\ngot\n%s", expected, text.String())
+	}
+
+	var lcov strings.Builder
+	c.WriteLCOV(&lcov)
+	expected = `TN:
+SF:lib.monkey
+BRDA:2,0,0,0
+BRDA:2,0,1,1
+BRDA:5,1,0,0
+BRDA:5,1,1,1
+BRF:4
+BRH:2
+DA:2,1
+DA:3,0
+DA:5,2
+DA:9,0
+LF:4
+LH:2
+end_of_record
+`
+	if lcov.String() != expected {
+		t.Errorf("expected the LCOV report\n%s\ngot\n%s", expected, lcov.String())
+	}
+
+	var html strings.Builder
+	err := c.WriteHTML(&html, func(path string) (string, error) { return modules[path], nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []string{
+		`<tr class="partial" title="if: taken 0, not taken 1"><td class="number">2</td><td class="count">1</td>`,
+		`<tr class="missed"><td class="number">3</td><td class="count">0</td>`,
+		`<tr><td class="number">4</td><td class="count"></td>`,
+		`<td class="code">	puts(&#34;never&#34;);</td>`,
+	} {
+		if !strings.Contains(html.String(), row) {
+			t.Errorf("expected the HTML report to contain %q, got\n%s", row, html.String())
+		}
+	}
+}
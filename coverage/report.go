@@ -0,0 +1,248 @@
+package coverage
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// lines returns the lines of f with code, in order
+func (f *File) lines() []int {
+	lines := make([]int, 0, len(f.Lines))
+	for line := range f.Lines {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// LinesRun returns the number of lines with code and how many of them ran
+func (f *File) LinesRun() (run, total int) {
+	for _, count := range f.Lines {
+		if count > 0 {
+			run++
+		}
+	}
+	return run, len(f.Lines)
+}
+
+// BranchesTaken returns the number of branches, two for every condition,
+// and how many of them were taken
+func (f *File) BranchesTaken() (taken, total int) {
+	for _, b := range f.Branches {
+		if b.Taken > 0 {
+			taken++
+		}
+		if b.NotTaken > 0 {
+			taken++
+		}
+	}
+	return taken, 2 * len(f.Branches)
+}
+
+// missed returns the ranges of the lines with code that did not run, such
+// as 4 or 7-9
+func (f *File) missed() []string {
+	ranges := []string{}
+	start, end := 0, 0
+	flush := func() {
+		if start == 0 {
+			return
+		}
+		if start == end {
+			ranges = append(ranges, strconv.Itoa(start))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", start, end))
+		}
+		start = 0
+	}
+	for _, line := range f.lines() {
+		if f.Lines[line] > 0 {
+			flush()
+			continue
+		}
+		if start == 0 {
+			start = line
+		}
+		end = line
+	}
+	flush()
+	return ranges
+}
+
+func percent(part, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(part)/float64(total))
+}
+
+// display returns the path of a module relative to the working directory
+// when it is below it
+func display(module string) string {
+	if !filepath.IsAbs(module) {
+		return module
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return module
+	}
+	rel, err := filepath.Rel(wd, module)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return module
+	}
+	return rel
+}
+
+// WriteText writes the share of lines run and branches taken in every file
+// and in total, with the lines that did not run
+func (c *Coverage) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	var linesRun, lines, branchesTaken, branches int
+	for _, f := range c.Files() {
+		run, total := f.LinesRun()
+		taken, all := f.BranchesTaken()
+		linesRun, lines = linesRun+run, lines+total
+		branchesTaken, branches = branchesTaken+taken, branches+all
+		fmt.Fprintf(tw, "%s\tlines %s (%d/%d)\tbranches %s (%d/%d)",
+			display(f.Module), percent(run, total), run, total, percent(taken, all), taken, all)
+		if missed := f.missed(); len(missed) != 0 {
+			fmt.Fprintf(tw, "\tnot run: %s", strings.Join(missed, ", "))
+		}
+		fmt.Fprintln(tw)
+	}
+	fmt.Fprintf(tw, "total\tlines %s (%d/%d)\tbranches %s (%d/%d)\n",
+		percent(linesRun, lines), linesRun, lines, percent(branchesTaken, branches), branchesTaken, branches)
+	return tw.Flush()
+}
+
+// WriteLCOV writes the coverage in the LCOV tracefile format, which genhtml
+// and most coverage services read. Every condition is a block of two
+// branches, the first taken when the condition held.
+func (c *Coverage) WriteLCOV(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("TN:\n")
+	for _, f := range c.Files() {
+		fmt.Fprintf(&b, "SF:%s\n", f.Module)
+		for i, branch := range f.Branches {
+			taken, notTaken := "-", "-"
+			if branch.Taken+branch.NotTaken > 0 {
+				taken, notTaken = strconv.FormatInt(branch.Taken, 10), strconv.FormatInt(branch.NotTaken, 10)
+			}
+			fmt.Fprintf(&b, "BRDA:%d,%d,0,%s\n", branch.Line, i, taken)
+			fmt.Fprintf(&b, "BRDA:%d,%d,1,%s\n", branch.Line, i, notTaken)
+		}
+		taken, branches := f.BranchesTaken()
+		fmt.Fprintf(&b, "BRF:%d\nBRH:%d\n", branches, taken)
+		for _, line := range f.lines() {
+			fmt.Fprintf(&b, "DA:%d,%d\n", line, f.Lines[line])
+		}
+		run, lines := f.LinesRun()
+		fmt.Fprintf(&b, "LF:%d\nLH:%d\n", lines, run)
+		b.WriteString("end_of_record\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type htmlFile struct {
+	Name     string
+	Lines    string
+	Branches string
+	Error    string
+	Source   []htmlLine
+}
+
+type htmlLine struct {
+	Number int
+	Code   string
+	// Class is run, missed or partial for the lines with code, partial when
+	// a condition on the line never went one way
+	Class string
+	Count string
+	Title string
+}
+
+var htmlTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Monkey coverage</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table.source { border-collapse: collapse; font-family: monospace; }
+table.source td { padding: 0 0.5em; white-space: pre; }
+td.number, td.count { color: #888; text-align: right; }
+tr.run td.code { background: #dfd; }
+tr.missed td.code { background: #fdd; }
+tr.partial td.code { background: #ffd; }
+</style>
+</head>
+<body>
+<h1>Monkey coverage</h1>
+{{range .}}
+<h2>{{.Name}}</h2>
+<p>lines {{.Lines}}, branches {{.Branches}}</p>
+{{if .Error}}<p>{{.Error}}</p>{{else}}
+<table class="source">
+{{range .Source}}<tr{{if .Class}} class="{{.Class}}"{{end}}{{if .Title}} title="{{.Title}}"{{end}}><td class="number">{{.Number}}</td><td class="count">{{.Count}}</td><td class="code">{{.Code}}</td></tr>
+{{end}}</table>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// WriteHTML writes a page showing the source of every file, with the lines
+// that ran, did not run, or have a condition that never went one way, in
+// different colours. read returns the source of a module.
+func (c *Coverage) WriteHTML(w io.Writer, read func(module string) (string, error)) error {
+	files := []htmlFile{}
+	for _, f := range c.Files() {
+		run, lines := f.LinesRun()
+		taken, branches := f.BranchesTaken()
+		file := htmlFile{
+			Name:     display(f.Module),
+			Lines:    fmt.Sprintf("%s (%d/%d)", percent(run, lines), run, lines),
+			Branches: fmt.Sprintf("%s (%d/%d)", percent(taken, branches), taken, branches),
+		}
+		source, err := read(f.Module)
+		if err != nil {
+			file.Error = err.Error()
+			files = append(files, file)
+			continue
+		}
+
+		branchesOn := map[int][]*Branch{}
+		for _, b := range f.Branches {
+			branchesOn[b.Line] = append(branchesOn[b.Line], b)
+		}
+		for i, code := range strings.Split(source, "\n") {
+			line := htmlLine{Number: i + 1, Code: code}
+			if count, ok := f.Lines[line.Number]; ok {
+				line.Count = strconv.FormatInt(count, 10)
+				line.Class = "missed"
+				if count > 0 {
+					line.Class = "run"
+				}
+			}
+			titles := []string{}
+			for _, b := range branchesOn[line.Number] {
+				titles = append(titles, fmt.Sprintf("%s: taken %d, not taken %d", b.Kind, b.Taken, b.NotTaken))
+				if line.Class == "run" && (b.Taken == 0 || b.NotTaken == 0) {
+					line.Class = "partial"
+				}
+			}
+			line.Title = strings.Join(titles, "; ")
+			file.Source = append(file.Source, line)
+		}
+		files = append(files, file)
+	}
+	return htmlTemplate.Execute(w, files)
+}
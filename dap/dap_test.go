@@ -0,0 +1,407 @@
+package dap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"monkey/debug"
+	"monkey/object"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const program = `fn add(a, b) {
+	let sum = a + b;
+	sum
+}
+
+let xs = [1, "two", {"k": 3}];
+let total = add(1, 2);
+puts(total);
+total`
+
+// message is a response or an event read by the client
+type message struct {
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Command    string          `json:"command"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// client is a scripted DAP client talking to a server running on a
+// goroutine, with pipes in between
+type client struct {
+	t        *testing.T
+	requests *io.PipeWriter
+	messages chan message
+	// pending holds the messages read while waiting for another one
+	pending []message
+	seq     int
+	served  chan error
+}
+
+func newClient(t *testing.T) *client {
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	c := &client{t: t, requests: inWriter, messages: make(chan message, 100), served: make(chan error, 1)}
+
+	go func() {
+		err := Serve(inReader, outWriter)
+		outWriter.Close()
+		c.served <- err
+	}()
+	go func() {
+		reader := bufio.NewReader(outReader)
+		defer close(c.messages)
+		for {
+			header, err := textproto.NewReader(reader).ReadMIMEHeader()
+			if err != nil {
+				return
+			}
+			length, _ := strconv.Atoi(header.Get("Content-Length"))
+			body := make([]byte, length)
+			if _, err := io.ReadFull(reader, body); err != nil {
+				return
+			}
+			var m message
+			if err := json.Unmarshal(body, &m); err != nil {
+				t.Errorf("invalid message %s: %v", body, err)
+				return
+			}
+			c.messages <- m
+		}
+	}()
+	return c
+}
+
+func (c *client) send(command string, arguments any) int {
+	c.seq++
+	body, _ := json.Marshal(map[string]any{"seq": c.seq, "type": "request", "command": command, "arguments": arguments})
+	go fmt.Fprintf(c.requests, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return c.seq
+}
+
+// next returns the first message, among the pending ones and then the ones
+// still to come, that match reports true for
+func (c *client) next(what string, match func(m message) bool) message {
+	c.t.Helper()
+	for i, m := range c.pending {
+		if match(m) {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			return m
+		}
+	}
+	for {
+		select {
+		case m, ok := <-c.messages:
+			if !ok {
+				c.t.Fatalf("the server stopped before %s", what)
+			}
+			if match(m) {
+				return m
+			}
+			c.pending = append(c.pending, m)
+		case <-time.After(5 * time.Second):
+			c.t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+// request sends a request and returns its response, decoding its body into
+// body unless it is nil
+func (c *client) request(command string, arguments any, body any) message {
+	c.t.Helper()
+	seq := c.send(command, arguments)
+	m := c.next("the response to "+command, func(m message) bool {
+		return m.Type == "response" && m.RequestSeq == seq
+	})
+	if m.Command != command {
+		c.t.Errorf("response to %s is for %s", command, m.Command)
+	}
+	if body != nil && m.Success {
+		if err := json.Unmarshal(m.Body, body); err != nil {
+			c.t.Fatalf("invalid body of %s: %s", command, m.Body)
+		}
+	}
+	return m
+}
+
+// succeed is request for a request that must succeed
+func (c *client) succeed(command string, arguments any, body any) {
+	c.t.Helper()
+	if m := c.request(command, arguments, body); !m.Success {
+		c.t.Fatalf("%s failed: %s", command, m.Message)
+	}
+}
+
+func (c *client) event(name string, body any) {
+	c.t.Helper()
+	m := c.next("the "+name+" event", func(m message) bool {
+		return m.Type == "event" && m.Event == name
+	})
+	if body != nil {
+		json.Unmarshal(m.Body, body)
+	}
+}
+
+// stopped waits until the program stops and returns the reason along with
+// the name and the line of every frame
+func (c *client) stopped() string {
+	c.t.Helper()
+	var event struct {
+		Reason string `json:"reason"`
+	}
+	c.event("stopped", &event)
+	var trace struct {
+		StackFrames []stackFrame `json:"stackFrames"`
+	}
+	c.succeed("stackTrace", map[string]any{"threadId": threadID}, &trace)
+	frames := []string{}
+	for _, f := range trace.StackFrames {
+		frames = append(frames, fmt.Sprintf("%s:%d", f.Name, f.Line))
+	}
+	return event.Reason + " " + strings.Join(frames, " ")
+}
+
+func (c *client) disconnect() {
+	c.t.Helper()
+	c.succeed("disconnect", map[string]any{}, nil)
+	select {
+	case err := <-c.served:
+		if err != nil {
+			c.t.Errorf("Serve failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("the server did not stop")
+	}
+}
+
+func writeProgram(t *testing.T, source string) string {
+	path := filepath.Join(t.TempDir(), "main.monkey")
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func (c *client) launch(path string, stopOnEntry bool, lines ...int) []breakpoint {
+	c.t.Helper()
+	var capabilities map[string]any
+	c.succeed("initialize", map[string]any{"adapterID": "monkey"}, &capabilities)
+	if capabilities["supportsConfigurationDoneRequest"] != true {
+		c.t.Errorf("wrong capabilities %v", capabilities)
+	}
+	c.event("initialized", nil)
+	c.succeed("launch", map[string]any{"program": path, "stopOnEntry": stopOnEntry}, nil)
+
+	requested := []map[string]any{}
+	for _, line := range lines {
+		requested = append(requested, map[string]any{"line": line})
+	}
+	var result struct {
+		Breakpoints []breakpoint `json:"breakpoints"`
+	}
+	c.succeed("setBreakpoints", map[string]any{"source": map[string]any{"path": path}, "breakpoints": requested}, &result)
+	c.succeed("configurationDone", map[string]any{}, nil)
+	return result.Breakpoints
+}
+
+func TestSession(t *testing.T) {
+	path := writeProgram(t, program)
+	c := newClient(t)
+
+	breakpoints := c.launch(path, false, 2, 4, 20)
+	expected := []breakpoint{{Verified: true, Line: 2}, {Verified: true, Line: 6}, {Line: 20, Message: "no code at or after this line"}}
+	if fmt.Sprint(breakpoints) != fmt.Sprint(expected) {
+		t.Errorf("expected breakpoints %v, got %v", expected, breakpoints)
+	}
+
+	var threads struct {
+		Threads []thread `json:"threads"`
+	}
+	c.succeed("threads", nil, &threads)
+	if len(threads.Threads) != 1 {
+		t.Errorf("expected one thread, got %v", threads.Threads)
+	}
+
+	steps := []struct {
+		command  string
+		expected string
+	}{
+		{"", "breakpoint <program>:6"},
+		{"next", "step <program>:7"},
+		{"stepIn", "breakpoint add:2 <program>:7"},
+		{"stepOut", "step <program>:8"},
+	}
+	for _, step := range steps {
+		if step.command != "" {
+			c.succeed(step.command, map[string]any{"threadId": threadID}, nil)
+		}
+		if got := c.stopped(); got != step.expected {
+			t.Fatalf("after %q: expected to stop at %q, got %q", step.command, step.expected, got)
+		}
+	}
+
+	// the variables of the program, and of the elements of xs
+	var scopes struct {
+		Scopes []scope `json:"scopes"`
+	}
+	c.succeed("scopes", map[string]any{"frameId": 1}, &scopes)
+	if len(scopes.Scopes) != 1 || scopes.Scopes[0].Name != "Globals" {
+		t.Fatalf("wrong scopes %v", scopes.Scopes)
+	}
+	variables := func(reference int) map[string]variable {
+		var result struct {
+			Variables []variable `json:"variables"`
+		}
+		c.succeed("variables", map[string]any{"variablesReference": reference}, &result)
+		byName := map[string]variable{}
+		for _, v := range result.Variables {
+			byName[v.Name] = v
+		}
+		return byName
+	}
+	globals := variables(scopes.Scopes[0].VariablesReference)
+	if globals["total"].Value != "3" || globals["add"].Value != "fn add(a, b)" || globals["xs"].VariablesReference == 0 {
+		t.Errorf("wrong globals %v", globals)
+	}
+	xs := variables(globals["xs"].VariablesReference)
+	if xs["0"].Value != "1" || xs["1"].Value != `"two"` || xs["1"].Type != "string" {
+		t.Errorf("wrong elements of xs %v", xs)
+	}
+	if hash := variables(xs["2"].VariablesReference); hash[`"k"`].Value != "3" {
+		t.Errorf("wrong pairs of the hash %v", hash)
+	}
+
+	var evaluated struct {
+		Result string `json:"result"`
+	}
+	c.succeed("evaluate", map[string]any{"expression": "total * 10", "frameId": 1}, &evaluated)
+	if evaluated.Result != "30" {
+		t.Errorf("expected 30, got %q", evaluated.Result)
+	}
+	if m := c.request("evaluate", map[string]any{"expression": "nope"}, nil); m.Success || !strings.Contains(m.Message, "identifier not found: nope") {
+		t.Errorf("expected evaluating nope to fail, got %+v", m)
+	}
+
+	// the program runs to its end
+	c.succeed("continue", map[string]any{"threadId": threadID}, nil)
+	output := ""
+	for output != "3\n3\n" {
+		var event struct {
+			Category string `json:"category"`
+			Output   string `json:"output"`
+		}
+		c.event("output", &event)
+		if event.Category != "stdout" {
+			t.Fatalf("unexpected output %+v", event)
+		}
+		output += event.Output
+	}
+	var exited struct {
+		ExitCode int `json:"exitCode"`
+	}
+	c.event("exited", &exited)
+	if exited.ExitCode != 0 {
+		t.Errorf("expected exit code 0, got %d", exited.ExitCode)
+	}
+	c.event("terminated", nil)
+
+	if m := c.request("next", map[string]any{"threadId": threadID}, nil); m.Success {
+		t.Errorf("expected next to fail once the program ended")
+	}
+	c.disconnect()
+}
+
+func TestBreakpointInLoop(t *testing.T) {
+	path := writeProgram(t, "let i = 0;\nwhile (i < 3) {\n\ti = i + 1;\n}\ni")
+	c := newClient(t)
+	c.launch(path, true, 3)
+
+	expected := []string{"entry <program>:1", "breakpoint <program>:3", "breakpoint <program>:3", "breakpoint <program>:3"}
+	for i, stop := range expected {
+		if i > 0 {
+			c.succeed("continue", map[string]any{"threadId": threadID}, nil)
+		}
+		if got := c.stopped(); got != stop {
+			t.Fatalf("stop %d: expected %q, got %q", i, stop, got)
+		}
+	}
+	// the breakpoints of a file can be replaced while it is stopped
+	c.succeed("setBreakpoints", map[string]any{"source": map[string]any{"path": path}, "breakpoints": []any{}}, nil)
+	c.succeed("continue", map[string]any{"threadId": threadID}, nil)
+	c.event("terminated", nil)
+	c.disconnect()
+}
+
+func TestDisconnectWhileStopped(t *testing.T) {
+	path := writeProgram(t, "puts(1);\nputs(2);")
+	c := newClient(t)
+	c.launch(path, true)
+	if got := c.stopped(); got != "entry <program>:1" {
+		t.Fatalf("expected to stop on entry, got %q", got)
+	}
+	c.disconnect()
+	for _, m := range c.pending {
+		if m.Event == "output" && strings.Contains(string(m.Body), `"stdout"`) {
+			t.Errorf("the program ran after the client disconnected: %s", m.Body)
+		}
+	}
+}
+
+func TestStopAfterTerminate(t *testing.T) {
+	// the client disconnects while the program runs, and the program reaches
+	// a breakpoint before it checks for cancellation
+	s := &server{out: io.Discard, resume: make(chan debug.Action), launch: &launchArguments{}}
+	s.env = object.NewEnvironment()
+	ctx, cancel := context.WithCancel(context.Background())
+	s.env.Runtime().Context = ctx
+	cancel()
+
+	action := make(chan debug.Action, 1)
+	go func() { action <- s.stopped(debug.New(s.stopped), debug.Breakpoint) }()
+	select {
+	case got := <-action:
+		if got != debug.Quit {
+			t.Errorf("expected the program to quit, got %v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the program stayed stopped after the session ended")
+	}
+	if s.isPaused() {
+		t.Errorf("the program is still marked as paused")
+	}
+}
+
+func TestLaunchErrors(t *testing.T) {
+	tests := []struct {
+		arguments map[string]any
+		expected  string
+	}{
+		{map[string]any{}, "the program to debug is missing"},
+		{map[string]any{"program": writeProgram(t, "let x = ;")}, "parser errors"},
+		{map[string]any{"program": writeProgram(t, "y")}, "resolver errors"},
+	}
+
+	for _, tt := range tests {
+		c := newClient(t)
+		c.succeed("initialize", map[string]any{}, nil)
+		if m := c.request("launch", tt.arguments, nil); m.Success || !strings.Contains(m.Message, tt.expected) {
+			t.Errorf("launch %v: expected an error with %q, got %+v", tt.arguments, tt.expected, m)
+		}
+		if m := c.request("attach", map[string]any{}, nil); m.Success {
+			t.Errorf("expected attach to be unsupported")
+		}
+		c.disconnect()
+	}
+}
@@ -0,0 +1,592 @@
+// Package dap implements a Debug Adapter Protocol server for Monkey, so that
+// VS Code and other DAP clients can debug Monkey programs with breakpoints,
+// stepping, the call stack, variables and evaluation.
+//
+// The program runs on a goroutine of its own under a debug.Debugger. While
+// it is stopped, the server answers requests about it; resuming requests
+// hand an action back to the debugger.
+package dap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/debug"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/module"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/resolver"
+	"monkey/stdlib"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// threadID is the id of the only thread of a Monkey program
+const threadID = 1
+
+// Serve answers the requests read from in, writing the responses and the
+// events to out, until the client disconnects or in is closed. A program
+// still running then is ended.
+func Serve(in io.Reader, out io.Writer) error {
+	s := &server{
+		reader: bufio.NewReader(in),
+		out:    out,
+		resume: make(chan debug.Action),
+		lines:  map[string][]int{},
+	}
+	s.debugger = debug.New(s.stopped)
+	defer s.terminate()
+
+	for {
+		req, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if req == nil {
+			continue
+		}
+		if err := s.handle(req); err != nil {
+			return err
+		}
+		if s.disconnected {
+			return nil
+		}
+	}
+}
+
+type server struct {
+	reader *bufio.Reader
+
+	// mu guards what the goroutine of the program shares with the server:
+	// out and seq, as the program writes its output and its stops, and paused
+	mu  sync.Mutex
+	out io.Writer
+	seq int
+	// paused is set while the program waits for an action from resume
+	paused bool
+	resume chan debug.Action
+
+	debugger *debug.Debugger
+	// lines holds the lines the debugger can stop at in each file
+	lines map[string][]int
+
+	// launch is set by the launch request, and the program starts once the
+	// client is done configuring it
+	launch     *launchArguments
+	program    *ast.Program
+	env        *object.Environment
+	configured bool
+	cancel     context.CancelFunc
+	// done is closed when the program has ended, it is nil until it starts
+	done chan struct{}
+
+	// frames and references describe the stopped program, they are valid
+	// until it resumes. A variables reference is an index in references
+	// plus one.
+	frames     []*debug.Frame
+	references []any
+
+	// after holds what to do once the response to the current request is
+	// written, such as resuming the program
+	after        []func()
+	disconnected bool
+}
+
+// read reads the next request, it returns nil for a message that is not one
+func (s *server) read() (*request, error) {
+	header, err := textproto.NewReader(s.reader).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, body); err != nil {
+		return nil, err
+	}
+
+	req := &request{}
+	if err := json.Unmarshal(body, req); err != nil || req.Type != "request" {
+		return nil, nil
+	}
+	return req, nil
+}
+
+// write numbers a response or an event with the next seq and writes it
+func (s *server) write(setSeq func(seq int) any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	body, err := json.Marshal(setSeq(s.seq))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (s *server) event(name string, body any) error {
+	return s.write(func(seq int) any {
+		return event{Seq: seq, Type: "event", Event: name, Body: body}
+	})
+}
+
+// handle answers a request and then does what the request left for after
+// its response
+func (s *server) handle(req *request) error {
+	body, err := s.handleRequest(req)
+	werr := s.write(func(seq int) any {
+		r := response{Seq: seq, Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: err == nil, Body: body}
+		if err != nil {
+			r.Message = err.Error()
+		}
+		return r
+	})
+	if werr != nil {
+		return werr
+	}
+
+	after := s.after
+	s.after = nil
+	for _, f := range after {
+		f()
+	}
+	return nil
+}
+
+func (s *server) handleRequest(req *request) (any, error) {
+	switch req.Command {
+	case "initialize":
+		s.after = append(s.after, func() { s.event("initialized", nil) })
+		return map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsTerminateRequest":         true,
+			"supportsEvaluateForHovers":        true,
+		}, nil
+
+	case "launch":
+		var args launchArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		if s.launch != nil {
+			return nil, errors.New("the program is already launched")
+		}
+		if err := s.load(args.Program); err != nil {
+			return nil, err
+		}
+		s.launch = &args
+		s.after = append(s.after, s.start)
+		return nil, nil
+
+	case "configurationDone":
+		s.configured = true
+		s.after = append(s.after, s.start)
+		return nil, nil
+
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return map[string]any{"breakpoints": s.setBreakpoints(args)}, nil
+
+	case "threads":
+		return map[string]any{"threads": []thread{{ID: threadID, Name: "main"}}}, nil
+
+	case "continue", "next", "stepIn", "stepOut":
+		if !s.isPaused() {
+			return nil, errors.New("the program is not stopped")
+		}
+		action := map[string]debug.Action{
+			"continue": debug.Continue,
+			"next":     debug.StepOver,
+			"stepIn":   debug.StepIn,
+			"stepOut":  debug.StepOut,
+		}[req.Command]
+		s.after = append(s.after, func() { s.resumeWith(action) })
+		if req.Command == "continue" {
+			return map[string]any{"allThreadsContinued": true}, nil
+		}
+		return nil, nil
+
+	case "stackTrace":
+		var args stackTraceArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.stackTrace(args)
+
+	case "scopes":
+		var args scopesArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.scopes(args)
+
+	case "variables":
+		var args variablesArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.variables(args)
+
+	case "evaluate":
+		var args evaluateArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.evaluate(args)
+
+	case "terminate":
+		s.after = append(s.after, s.terminate)
+		return nil, nil
+
+	case "disconnect":
+		s.after = append(s.after, s.terminate)
+		s.disconnected = true
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unsupported command %s", req.Command)
+}
+
+// load parses and resolves the program in path, and prepares the
+// environment to run it in
+func (s *server) load(path string) error {
+	if path == "" {
+		return errors.New("launch: the program to debug is missing")
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return fmt.Errorf("%s: parser errors:\n\t%s", path, strings.Join(p.Errors(), "\n\t"))
+	}
+	if errs := resolver.Errors(resolver.Resolve(program, nil)); len(errs) != 0 {
+		return fmt.Errorf("%s: resolver errors:\n\t%s", path, strings.Join(errs, "\n\t"))
+	}
+
+	env := object.NewEnvironment()
+	env.SetModule(path)
+	env.Runtime().Loader = module.NewLoader(stdlib.Resolver{Next: module.FileResolver{}})
+	env.Runtime().Stdout = output{s, "stdout"}
+	env.Runtime().Stderr = output{s, "stderr"}
+	ctx, cancel := context.WithCancel(context.Background())
+	env.Runtime().Context = ctx
+
+	s.program, s.env, s.cancel = program, env, cancel
+	return nil
+}
+
+// output sends what the program writes to the client in output events
+type output struct {
+	s        *server
+	category string
+}
+
+func (o output) Write(p []byte) (int, error) {
+	err := o.s.event("output", map[string]any{"category": o.category, "output": string(p)})
+	return len(p), err
+}
+
+// start runs the program once it is launched and configured
+func (s *server) start() {
+	if s.launch == nil || !s.configured || s.done != nil {
+		return
+	}
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		var result object.Object
+		if s.launch.NoDebug {
+			result = evaluator.Eval(s.program, s.env)
+		} else {
+			result = s.debugger.Run(s.program, s.env)
+		}
+
+		code := 0
+		if err, ok := result.(*object.Error); ok {
+			code = 1
+			message := err.Inspect()
+			for _, frame := range err.PrintedStack() {
+				message += "\n\tat " + frame
+			}
+			s.event("output", map[string]any{"category": "stderr", "output": message + "\n"})
+		} else if result != nil && result != evaluator.NullObj {
+			s.event("output", map[string]any{"category": "stdout", "output": result.Inspect() + "\n"})
+		}
+		s.event("exited", map[string]any{"exitCode": code})
+		s.event("terminated", nil)
+	}()
+}
+
+// terminate ends the program, if it runs, and waits for it. A program that
+// is stopped, or stops before it notices, quits in stopped.
+func (s *server) terminate() {
+	if s.done == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+}
+
+// stopped is called by the debugger on the goroutine of the program when it
+// stops, it waits for the client to resume it
+func (s *server) stopped(d *debug.Debugger, reason debug.Reason) debug.Action {
+	if reason == debug.Entry && !s.launch.StopOnEntry {
+		return debug.Continue
+	}
+	s.mu.Lock()
+	s.paused = true
+	s.frames = d.Frames()
+	s.references = nil
+	s.mu.Unlock()
+
+	s.event("stopped", map[string]any{"reason": string(reason), "threadId": threadID, "allThreadsStopped": true})
+	select {
+	case action := <-s.resume:
+		return action
+	case <-s.env.Runtime().Context.Done():
+		s.mu.Lock()
+		s.paused = false
+		s.mu.Unlock()
+		return debug.Quit
+	}
+}
+
+func (s *server) isPaused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+func (s *server) resumeWith(action debug.Action) {
+	s.mu.Lock()
+	s.paused = false
+	s.mu.Unlock()
+	s.resume <- action
+}
+
+// setBreakpoints replaces the breakpoints of a file. A breakpoint on a line
+// the program cannot stop at moves to the next line it can stop at.
+func (s *server) setBreakpoints(args setBreakpointsArguments) []breakpoint {
+	path, err := filepath.Abs(args.Source.Path)
+	if err != nil {
+		path = args.Source.Path
+	}
+	for _, location := range s.debugger.Breakpoints() {
+		if location.Module == path {
+			s.debugger.ClearBreakpoint(location)
+		}
+	}
+
+	lines, err := s.stoppableLines(path)
+	result := []breakpoint{}
+	for _, b := range args.Breakpoints {
+		if err != nil {
+			result = append(result, breakpoint{Line: b.Line, Message: err.Error()})
+			continue
+		}
+		i := sort.SearchInts(lines, b.Line)
+		if i == len(lines) {
+			result = append(result, breakpoint{Line: b.Line, Message: "no code at or after this line"})
+			continue
+		}
+		s.debugger.SetBreakpoint(debug.Location{Module: path, Line: lines[i]})
+		result = append(result, breakpoint{Verified: true, Line: lines[i]})
+	}
+	return result
+}
+
+// stoppableLines returns the lines the debugger can stop at in the file at
+// path
+func (s *server) stoppableLines(path string) ([]int, error) {
+	if lines, ok := s.lines[path]; ok {
+		return lines, nil
+	}
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New("the file does not parse")
+	}
+	s.lines[path] = debug.Lines(program)
+	return s.lines[path], nil
+}
+
+func (s *server) stackTrace(args stackTraceArguments) (any, error) {
+	if !s.isPaused() {
+		return nil, errors.New("the program is not stopped")
+	}
+	frames := []stackFrame{}
+	for i, frame := range s.frames {
+		if i < args.StartFrame || args.Levels > 0 && i >= args.StartFrame+args.Levels {
+			continue
+		}
+		frames = append(frames, stackFrame{
+			ID:     i + 1,
+			Name:   frame.Name(),
+			Source: sourceOf(frame.Location.Module),
+			Line:   frame.Location.Line,
+			Column: frame.Column,
+		})
+	}
+	return map[string]any{"stackFrames": frames, "totalFrames": len(s.frames)}, nil
+}
+
+// sourceOf describes the file of a module, the standard library modules
+// have no file
+func sourceOf(module string) source {
+	if !filepath.IsAbs(module) {
+		return source{Name: module}
+	}
+	return source{Name: filepath.Base(module), Path: module}
+}
+
+// frame returns the frame of the stopped program with id, the innermost
+// frame being 1
+func (s *server) frame(id int) (*debug.Frame, error) {
+	if !s.isPaused() {
+		return nil, errors.New("the program is not stopped")
+	}
+	if id < 1 || id > len(s.frames) {
+		return nil, fmt.Errorf("unknown frame %d", id)
+	}
+	return s.frames[id-1], nil
+}
+
+func (s *server) scopes(args scopesArguments) (any, error) {
+	frame, err := s.frame(args.FrameID)
+	if err != nil {
+		return nil, err
+	}
+	envs := frame.Scopes()
+	scopes := []scope{}
+	for i, env := range envs {
+		name := "Enclosing"
+		switch {
+		case i == len(envs)-1:
+			name = "Globals"
+		case i == 0:
+			name = "Locals"
+		}
+		scopes = append(scopes, scope{Name: name, VariablesReference: s.reference(env)})
+	}
+	return map[string]any{"scopes": scopes}, nil
+}
+
+// reference returns the variables reference of an environment or a value
+// with children, or 0 for a value without
+func (s *server) reference(value any) int {
+	switch value := value.(type) {
+	case *object.Array:
+		if len(value.Elements) == 0 {
+			return 0
+		}
+	case *object.Hash:
+		if len(value.Pairs()) == 0 {
+			return 0
+		}
+	case *object.Module:
+		if len(value.Exports) == 0 {
+			return 0
+		}
+	case *object.Environment:
+	default:
+		return 0
+	}
+	s.references = append(s.references, value)
+	return len(s.references)
+}
+
+func (s *server) variables(args variablesArguments) (any, error) {
+	if !s.isPaused() {
+		return nil, errors.New("the program is not stopped")
+	}
+	if args.VariablesReference < 1 || args.VariablesReference > len(s.references) {
+		return nil, fmt.Errorf("unknown variables reference %d", args.VariablesReference)
+	}
+
+	variables := []variable{}
+	add := func(name string, value object.Object) {
+		variables = append(variables, variable{
+			Name:               name,
+			Value:              debug.Summary(value),
+			Type:               strings.ToLower(string(value.Type())),
+			VariablesReference: s.reference(value),
+		})
+	}
+	switch value := s.references[args.VariablesReference-1].(type) {
+	case *object.Environment:
+		for _, name := range value.Names() {
+			v, _ := value.Get(name)
+			add(name, v)
+		}
+	case *object.Array:
+		for i, element := range value.Elements {
+			add(strconv.Itoa(i), element)
+		}
+	case *object.Hash:
+		for _, pair := range value.Pairs() {
+			add(debug.Summary(pair.Key), pair.Value)
+		}
+	case *object.Module:
+		names := make([]string, 0, len(value.Exports))
+		for name := range value.Exports {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			add(name, value.Exports[name])
+		}
+	}
+	return map[string]any{"variables": variables}, nil
+}
+
+// evaluate evaluates an expression in a frame of the stopped program, the
+// innermost one when the client names none
+func (s *server) evaluate(args evaluateArguments) (any, error) {
+	if args.FrameID == 0 {
+		args.FrameID = 1
+	}
+	frame, err := s.frame(args.FrameID)
+	if err != nil {
+		return nil, err
+	}
+	result := s.debugger.Evaluate(args.Expression, frame)
+	if err, ok := result.(*object.Error); ok {
+		return nil, errors.New(err.Inspect())
+	}
+	if result == nil {
+		return map[string]any{"result": "", "variablesReference": 0}, nil
+	}
+	return map[string]any{"result": debug.Summary(result), "variablesReference": s.reference(result)}, nil
+}
@@ -0,0 +1,209 @@
+package debug
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/module"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/resolver"
+	"strings"
+	"testing"
+)
+
+const program = `fn add(a, b) {
+	let sum = a + b;
+	sum
+}
+let x = 1;
+let y = add(x, 2);
+let i = 0;
+while (i < 2) {
+	i = i + 1;
+}
+add(y, i)`
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	resolver.Resolve(program, nil)
+	return program
+}
+
+// script runs input under a debugger that resumes with actions, one per
+// stop, and records every stop as "reason line depth"
+func script(t *testing.T, input string, breakpoints []int, actions ...Action) ([]string, object.Object) {
+	t.Helper()
+	stops := []string{}
+	d := New(func(d *Debugger, reason Reason) Action {
+		frames := d.Frames()
+		stops = append(stops, fmt.Sprintf("%s %d %d", reason, frames[0].Location.Line, len(frames)))
+		if len(stops) > len(actions) {
+			return Continue
+		}
+		return actions[len(stops)-1]
+	})
+	for _, line := range breakpoints {
+		d.SetBreakpoint(Location{Line: line})
+	}
+
+	env := object.NewEnvironment()
+	env.Runtime().Loader = module.NewLoader(module.MapResolver{"lib": "export let one = 1;\nexport let two = 2;"})
+	result := d.Run(parse(t, input), env)
+	return stops, result
+}
+
+func TestStops(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		breakpoints []int
+		actions     []Action
+		expected    []string
+	}{
+		{"continue", program, nil, []Action{Continue}, []string{"entry 5 1"}},
+		{"step in", program, nil, []Action{StepIn, StepIn, StepIn, StepIn, StepIn, StepIn, StepIn, StepIn, StepIn},
+			[]string{"entry 5 1", "step 6 1", "step 2 2", "step 3 2", "step 7 1", "step 8 1", "step 9 1", "step 9 1", "step 11 1", "step 2 2"}},
+		{"step over", program, nil, []Action{StepOver, StepOver, StepOver},
+			[]string{"entry 5 1", "step 6 1", "step 7 1", "step 8 1"}},
+		{"step out", program, nil, []Action{StepIn, StepIn, StepOut},
+			[]string{"entry 5 1", "step 6 1", "step 2 2", "step 7 1"}},
+		{"step over at the end of a function", program, nil, []Action{StepIn, StepIn, StepOver, StepOver},
+			[]string{"entry 5 1", "step 6 1", "step 2 2", "step 3 2", "step 7 1"}},
+		{"breakpoints", program, []int{2, 9}, []Action{Continue, Continue, Continue, Continue, Continue},
+			[]string{"entry 5 1", "breakpoint 2 2", "breakpoint 9 1", "breakpoint 9 1", "breakpoint 2 2"}},
+		{"breakpoint while stepping over", program, []int{2}, []Action{StepOver, StepOver},
+			[]string{"entry 5 1", "step 6 1", "breakpoint 2 2", "breakpoint 2 2"}},
+		{"statements on one line", "let a = 1; let b = 2;\nlet c = if (a < b) { 1 } else { 2 };\nc", []int{2}, []Action{StepIn, StepIn, StepIn},
+			[]string{"entry 1 1", "breakpoint 2 1", "step 3 1"}},
+		{"loop on one line", "let i = 0;\nwhile (i < 3) { i = i + 1; }", nil, []Action{StepIn, StepIn, StepIn, StepIn},
+			[]string{"entry 1 1", "step 2 1", "step 2 1", "step 2 1"}},
+		{"step over an import", "import \"lib\" as lib;\nlib.one", nil, []Action{StepOver},
+			[]string{"entry 1 1", "step 2 1"}},
+		{"step into an import", "import \"lib\" as lib;\nlib.one", nil, []Action{StepIn, StepIn, StepIn},
+			[]string{"entry 1 1", "step 1 1", "step 2 1", "step 2 1"}},
+	}
+
+	for _, tt := range tests {
+		stops, result := script(t, tt.input, tt.breakpoints, tt.actions...)
+		if strings.Join(stops, ", ") != strings.Join(tt.expected, ", ") {
+			t.Errorf("%s:\nexpected %q\ngot      %q", tt.name, tt.expected, stops)
+		}
+		if isError(result) {
+			t.Errorf("%s: the program failed: %s", tt.name, result.Inspect())
+		}
+	}
+}
+
+func isError(obj object.Object) bool {
+	_, ok := obj.(*object.Error)
+	return ok
+}
+
+func TestQuit(t *testing.T) {
+	stops, result := script(t, "puts(1);\nputs(2);", nil, StepIn, Quit)
+	if len(stops) != 2 {
+		t.Errorf("expected 2 stops, got %q", stops)
+	}
+	err, ok := result.(*object.Error)
+	if !ok || err.Kind != object.CancelledError {
+		t.Errorf("expected a cancelled error, got %v", result)
+	}
+}
+
+func TestInspection(t *testing.T) {
+	var frames []string
+	var scopes [][]string
+	var values []string
+	d := New(func(d *Debugger, reason Reason) Action {
+		if reason != Breakpoint || frames != nil {
+			return Continue
+		}
+		for _, frame := range d.Frames() {
+			frames = append(frames, fmt.Sprintf("%s:%d:%d", frame.Name(), frame.Location.Line, frame.Column))
+		}
+		for _, scope := range d.Frames()[0].Scopes() {
+			scopes = append(scopes, scope.Names())
+		}
+		values = append(values, d.Evaluate("sum * 10", d.Frames()[0]).Inspect())
+		values = append(values, d.Evaluate("let", d.Frames()[0]).Inspect())
+		// assignments change the program
+		d.Evaluate("sum = 100", d.Frames()[0])
+		return Continue
+	})
+	d.SetBreakpoint(Location{Line: 3})
+
+	result := d.Run(parse(t, program), object.NewEnvironment())
+
+	if got := strings.Join(frames, " "); got != "add:3:2 <program>:6:1" {
+		t.Errorf("wrong frames %q", got)
+	}
+	if got := fmt.Sprint(scopes); got != "[[a b sum] [add x]]" {
+		t.Errorf("wrong scopes %s", got)
+	}
+	if values[0] != "30" || !strings.Contains(values[1], "expected next token") {
+		t.Errorf("wrong values %q", values)
+	}
+	if result.Inspect() != "102" {
+		t.Errorf("expected the assignment to change the result, got %s", result.Inspect())
+	}
+}
+
+func TestLines(t *testing.T) {
+	expected := []int{2, 3, 5, 6, 7, 8, 9, 11}
+	if got := Lines(parse(t, program)); fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expected lines %v, got %v", expected, got)
+	}
+}
+
+func TestTerminal(t *testing.T) {
+	input := strings.Join([]string{"b 2", "c", "bt", "e", "p a + b", "f 1", "p x", "n", "", "breakpoints", "clear 2", "c"}, "\n")
+	var out strings.Builder
+	result := Start(parse(t, program), program, object.NewEnvironment(), strings.NewReader(input), &out)
+
+	expected := []string{
+		"stopped at line 5 (entry)",
+		"   5\tlet x = 1;",
+		"(debug) breakpoint at line 2",
+		"(debug) stopped at line 2 (breakpoint)",
+		"   2\t\tlet sum = a + b;",
+		"(debug) * 0 add at line 2",
+		"  1 <program> at line 6",
+		"(debug) scope 0:",
+		"\ta = 1",
+		"\tb = 2",
+		"global:",
+		"\tadd = fn add(a, b)",
+		"\tx = 1",
+		"(debug) 3",
+		"(debug) 1 <program> at line 6",
+		"   6\tlet y = add(x, 2);",
+		"(debug) 1",
+		"(debug) stopped at line 3 (step)",
+		"   3\t\tsum",
+		"(debug) stopped at line 7 (step)",
+		"   7\tlet i = 0;",
+		"(debug) line 2",
+		"(debug) (debug) ",
+	}
+	if got := out.String(); got != strings.Join(expected, "\n") {
+		t.Errorf("wrong output:\n%s", got)
+	}
+	if result.Inspect() != "5" {
+		t.Errorf("expected 5, got %s", result.Inspect())
+	}
+}
+
+func TestTerminalEndOfInput(t *testing.T) {
+	var out strings.Builder
+	result := Start(parse(t, program), program, object.NewEnvironment(), strings.NewReader("s"), &out)
+	err, ok := result.(*object.Error)
+	if !ok || err.Kind != object.CancelledError {
+		t.Errorf("expected the program to end, got %v", result)
+	}
+}
@@ -0,0 +1,297 @@
+// Package debug runs Monkey programs step by step. A Debugger is the Hook
+// of a Runtime: it stops the program at breakpoints and after steps, and
+// hands control to a front end, which inspects the program while it is
+// stopped and tells the debugger how to resume it.
+package debug
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Action tells a stopped program how to resume
+type Action int
+
+const (
+	// Continue runs until the next breakpoint
+	Continue Action = iota
+	// StepIn stops at the next line, inside the functions the current line calls
+	StepIn
+	// StepOver stops at the next line of the current function
+	StepOver
+	// StepOut stops at the next line of the function the current one returns to
+	StepOut
+	// Quit ends the program with a CancelledError
+	Quit
+)
+
+// Reason tells why a program stopped
+type Reason string
+
+const (
+	Entry      Reason = "entry"
+	Step       Reason = "step"
+	Breakpoint Reason = "breakpoint"
+)
+
+// Location is a line of a module, Module being the resolved path of the
+// module or empty for a program that is not a file
+type Location struct {
+	Module string
+	Line   int
+}
+
+// Frame is a function call in progress, or the program itself at the
+// bottom of the stack
+type Frame struct {
+	// Function is nil for the program
+	Function *object.Function
+	// Node is the statement the frame is running and Env the environment it
+	// runs in, they are nil until the frame runs its first statement
+	Node     ast.Node
+	Env      *object.Environment
+	Location Location
+	Column   int
+}
+
+// Name returns the name of the function of the frame
+func (f *Frame) Name() string {
+	switch {
+	case f.Function == nil:
+		return "<program>"
+	case f.Function.Name == "":
+		return "<anonymous>"
+	}
+	return f.Function.Name
+}
+
+// Scopes returns the environments the frame sees, innermost first
+func (f *Frame) Scopes() []*object.Environment {
+	var scopes []*object.Environment
+	for env := f.Env; env != nil; env = env.Outer() {
+		scopes = append(scopes, env)
+	}
+	return scopes
+}
+
+// Debugger stops a program at the first statement of a line when the line
+// has a breakpoint or when a step ends there. Several statements on one line
+// are a single stop, except when a loop runs them again.
+type Debugger struct {
+	// Stopped is called when the program stops, and the program resumes
+	// with the action it returns. It can call the methods of the debugger,
+	// the program does not run until it returns.
+	Stopped func(d *Debugger, reason Reason) Action
+
+	// mu guards breakpoints, which front ends may change while the program
+	// runs
+	mu          sync.Mutex
+	breakpoints map[Location]bool
+	frames      []*Frame
+	action      Action
+	// depth and module are where the last step started
+	depth  int
+	module string
+	// evaluating is set while Evaluate runs code for the front end, which is
+	// not debugged
+	evaluating bool
+	positions  map[ast.Node]ast.Position
+}
+
+// New returns a debugger that stops at the first line of the program
+func New(stopped func(d *Debugger, reason Reason) Action) *Debugger {
+	return &Debugger{
+		Stopped:     stopped,
+		breakpoints: map[Location]bool{},
+		frames:      []*Frame{{}},
+		action:      StepIn,
+		positions:   map[ast.Node]ast.Position{},
+	}
+}
+
+// Run evaluates program in env under the debugger
+func (d *Debugger) Run(program *ast.Program, env *object.Environment) object.Object {
+	return evaluator.EvalWithHook(program, env, d)
+}
+
+func (d *Debugger) SetBreakpoint(location Location) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints[location] = true
+}
+
+func (d *Debugger) ClearBreakpoint(location Location) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.breakpoints, location)
+}
+
+// Breakpoints returns the locations of the breakpoints, in no order
+func (d *Debugger) Breakpoints() []Location {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	locations := make([]Location, 0, len(d.breakpoints))
+	for location := range d.breakpoints {
+		locations = append(locations, location)
+	}
+	return locations
+}
+
+// Frames returns the call stack, the innermost frame first
+func (d *Debugger) Frames() []*Frame {
+	frames := make([]*Frame, len(d.frames))
+	for i, frame := range d.frames {
+		frames[len(d.frames)-1-i] = frame
+	}
+	return frames
+}
+
+// Evaluate evaluates code in the environment of frame, a frame of the
+// stopped program. Breakpoints are ignored while it runs.
+func (d *Debugger) Evaluate(code string, frame *Frame) object.Object {
+	p := parser.New(lexer.New(code))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return &object.Error{Kind: object.RuntimeError, Message: strings.Join(p.Errors(), "; ")}
+	}
+	if frame.Env == nil {
+		return &object.Error{Kind: object.RuntimeError, Message: "the frame has not started"}
+	}
+
+	d.evaluating = true
+	defer func() { d.evaluating = false }()
+	return evaluator.Eval(program, frame.Env)
+}
+
+func (d *Debugger) Before(node ast.Node, env *object.Environment) *object.Error {
+	if d.evaluating || !ast.RunsCode(node) {
+		return nil
+	}
+
+	position := d.position(node)
+	frame := d.frames[len(d.frames)-1]
+	location := Location{Module: env.Module(), Line: position.Line}
+	// the line is the same unless it goes back to the start of a loop
+	sameLine := location == frame.Location && position.Column > frame.Column
+	frame.Node, frame.Env, frame.Location, frame.Column = node, env, location, position.Column
+	if sameLine {
+		return nil
+	}
+
+	reason, stop := d.stop(location)
+	if !stop {
+		return nil
+	}
+	d.action = d.Stopped(d, reason)
+	d.depth, d.module = len(d.frames), location.Module
+	if d.action == Quit {
+		return &object.Error{Kind: object.CancelledError, Message: "the debugger ended the program"}
+	}
+	return nil
+}
+
+func (d *Debugger) After(node ast.Node, env *object.Environment, result object.Object) {}
+
+// Lines returns the lines of program the debugger can stop at, in order.
+// A breakpoint on another line is never hit.
+func Lines(program *ast.Program) []int {
+	seen := map[int]bool{}
+	lines := []int{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ast.RunsCode(node) {
+			line := ast.SpanOf(node).Start.Line
+			if !seen[line] {
+				seen[line] = true
+				lines = append(lines, line)
+			}
+		}
+		return true
+	})
+	sort.Ints(lines)
+	return lines
+}
+
+// stop reports whether the program stops at location, the first statement
+// of a line, and why
+func (d *Debugger) stop(location Location) (Reason, bool) {
+	d.mu.Lock()
+	breakpoint := d.breakpoints[location]
+	d.mu.Unlock()
+	if breakpoint {
+		return Breakpoint, true
+	}
+	depth := len(d.frames)
+	switch d.action {
+	case StepIn:
+		if depth == 1 && d.depth == 0 {
+			return Entry, true
+		}
+		return Step, true
+	case StepOver:
+		// a module imported by the current line runs at the same depth,
+		// stepping over the import skips it
+		return Step, depth < d.depth || depth == d.depth && location.Module == d.module
+	case StepOut:
+		return Step, depth < d.depth
+	}
+	return "", false
+}
+
+// position returns where node starts, the spans of statements are
+// remembered as they are costly to compute
+func (d *Debugger) position(node ast.Node) ast.Position {
+	position, ok := d.positions[node]
+	if !ok {
+		position = ast.SpanOf(node).Start
+		d.positions[node] = position
+	}
+	return position
+}
+
+func (d *Debugger) Call(fn *object.Function, args []object.Object) {
+	if d.evaluating {
+		return
+	}
+	d.frames = append(d.frames, &Frame{Function: fn})
+}
+
+func (d *Debugger) Return(fn *object.Function, result object.Object) {
+	if d.evaluating {
+		return
+	}
+	d.frames = d.frames[:len(d.frames)-1]
+}
+
+// NestTailCalls keeps the frame of every call, tail calls included
+func (d *Debugger) NestTailCalls() bool { return true }
+
+// Summary returns a short description of value for front ends to show.
+// Strings are quoted, and functions are shown by their signature rather
+// than their whole body.
+func Summary(value object.Object) string {
+	switch value := value.(type) {
+	case *object.String:
+		return strconv.Quote(value.Value)
+	case *object.Function:
+		params := []string{}
+		for _, p := range value.Parameters {
+			params = append(params, p.Value)
+		}
+		name := "fn"
+		if value.Name != "" {
+			name += " " + value.Name
+		}
+		return fmt.Sprintf("%s(%s)", name, strings.Join(params, ", "))
+	case nil:
+		return "null"
+	}
+	return value.Inspect()
+}
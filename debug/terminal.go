@@ -0,0 +1,210 @@
+package debug
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/object"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const PROMPT = "(debug) "
+
+const help = `commands:
+	break <line>, b    set a breakpoint
+	clear <line>       remove a breakpoint
+	breakpoints        list the breakpoints
+	continue, c        run until the next breakpoint
+	step, s            run to the next line, entering calls
+	next, n            run to the next line of this function
+	out, o             run until this function returns
+	backtrace, bt      show the call stack
+	frame <n>, f       select frame n of the call stack
+	env, e             show the variables of the selected frame, scope by scope
+	print <expr>, p    evaluate an expression in the selected frame
+	list, l            show the source around the current line
+	quit, q            end the program
+An empty line repeats the last command.
+`
+
+// terminal is a front end reading commands from a terminal
+type terminal struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+	module  string   // module is the path of the program
+	lines   []string // lines is the source of the program
+	frame   int      // frame is the index of the selected frame, 0 being the innermost
+	last    string   // last is the last command, which an empty line repeats
+}
+
+// Start evaluates program in env under a debugger driven by the commands
+// read from in, and returns the result of the program. source is the text
+// of program, which the list command shows. The program stops before its
+// first line.
+func Start(program *ast.Program, source string, env *object.Environment, in io.Reader, out io.Writer) object.Object {
+	t := &terminal{
+		scanner: bufio.NewScanner(in),
+		out:     out,
+		module:  env.Module(),
+		lines:   strings.Split(source, "\n"),
+	}
+	return New(t.stopped).Run(program, env)
+}
+
+func (t *terminal) stopped(d *Debugger, reason Reason) Action {
+	t.frame = 0
+	frame := d.Frames()[0]
+	fmt.Fprintf(t.out, "stopped at %s (%s)\n", t.describe(frame), reason)
+	t.show(frame)
+
+	for {
+		fmt.Fprint(t.out, PROMPT)
+		if !t.scanner.Scan() {
+			fmt.Fprintln(t.out)
+			return Quit
+		}
+		line := strings.TrimSpace(t.scanner.Text())
+		if line == "" {
+			line = t.last
+		}
+		t.last = line
+		command, argument, _ := strings.Cut(line, " ")
+		argument = strings.TrimSpace(argument)
+
+		switch command {
+		case "":
+		case "help", "h":
+			fmt.Fprint(t.out, help)
+		case "break", "b", "clear":
+			n, err := strconv.Atoi(argument)
+			if err != nil || n < 1 {
+				fmt.Fprintf(t.out, "expected a line number, got %q\n", argument)
+				continue
+			}
+			location := Location{Module: t.module, Line: n}
+			if command == "clear" {
+				d.ClearBreakpoint(location)
+			} else {
+				d.SetBreakpoint(location)
+				fmt.Fprintf(t.out, "breakpoint at line %d\n", n)
+			}
+		case "breakpoints":
+			t.breakpoints(d)
+		case "continue", "c":
+			return Continue
+		case "step", "s":
+			return StepIn
+		case "next", "n":
+			return StepOver
+		case "out", "o":
+			return StepOut
+		case "quit", "q":
+			return Quit
+		case "backtrace", "bt":
+			for i, frame := range d.Frames() {
+				marker := " "
+				if i == t.frame {
+					marker = "*"
+				}
+				fmt.Fprintf(t.out, "%s %d %s at %s\n", marker, i, frame.Name(), t.describe(frame))
+			}
+		case "frame", "f":
+			n, err := strconv.Atoi(argument)
+			if err != nil || n < 0 || n >= len(d.Frames()) {
+				fmt.Fprintf(t.out, "expected a frame between 0 and %d, got %q\n", len(d.Frames())-1, argument)
+				continue
+			}
+			t.frame = n
+			frame := d.Frames()[n]
+			fmt.Fprintf(t.out, "%d %s at %s\n", n, frame.Name(), t.describe(frame))
+			t.show(frame)
+		case "env", "e":
+			t.env(d.Frames()[t.frame])
+		case "print", "p":
+			result := d.Evaluate(argument, d.Frames()[t.frame])
+			if result != nil {
+				fmt.Fprintln(t.out, result.Inspect())
+			}
+		case "list", "l":
+			t.list(d.Frames()[t.frame])
+		default:
+			fmt.Fprintf(t.out, "unknown command %q, type help for the list of commands\n", command)
+		}
+	}
+}
+
+// describe returns the location of frame, the line alone in the program
+func (t *terminal) describe(frame *Frame) string {
+	if frame.Location.Module == t.module {
+		return fmt.Sprintf("line %d", frame.Location.Line)
+	}
+	return fmt.Sprintf("%s:%d", frame.Location.Module, frame.Location.Line)
+}
+
+// show prints the line frame is at, or the statement when it is not in the
+// program
+func (t *terminal) show(frame *Frame) {
+	line := frame.Location.Line
+	if frame.Location.Module == t.module && line >= 1 && line <= len(t.lines) {
+		fmt.Fprintf(t.out, "%4d\t%s\n", line, t.lines[line-1])
+	} else if frame.Node != nil {
+		fmt.Fprintf(t.out, "%4d\t%s\n", line, frame.Node.String())
+	}
+}
+
+// list prints the lines around the line frame is at
+func (t *terminal) list(frame *Frame) {
+	if frame.Location.Module != t.module {
+		t.show(frame)
+		return
+	}
+	current := frame.Location.Line
+	for line := max(current-5, 1); line <= min(current+5, len(t.lines)); line++ {
+		marker := " "
+		if line == current {
+			marker = ">"
+		}
+		fmt.Fprintf(t.out, "%s%3d\t%s\n", marker, line, t.lines[line-1])
+	}
+}
+
+func (t *terminal) breakpoints(d *Debugger) {
+	locations := d.Breakpoints()
+	if len(locations) == 0 {
+		fmt.Fprintln(t.out, "no breakpoints")
+		return
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		if locations[i].Module != locations[j].Module {
+			return locations[i].Module < locations[j].Module
+		}
+		return locations[i].Line < locations[j].Line
+	})
+	for _, location := range locations {
+		fmt.Fprintf(t.out, "line %d\n", location.Line)
+	}
+}
+
+// env prints the variables of the scopes frame sees, innermost first
+func (t *terminal) env(frame *Frame) {
+	scopes := frame.Scopes()
+	for i, scope := range scopes {
+		name := fmt.Sprintf("scope %d", i)
+		if scope.Outer() == nil {
+			name = "global"
+		}
+		names := scope.Names()
+		if len(names) == 0 {
+			fmt.Fprintf(t.out, "%s: (empty)\n", name)
+			continue
+		}
+		fmt.Fprintf(t.out, "%s:\n", name)
+		for _, n := range names {
+			value, _ := scope.Get(n)
+			fmt.Fprintf(t.out, "\t%s = %s\n", n, Summary(value))
+		}
+	}
+}
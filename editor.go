@@ -0,0 +1,256 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"monkey/format"
+	"monkey/lexer"
+	"monkey/lsp"
+	"monkey/module"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/resolver"
+	"monkey/stdlib"
+	"monkey/token"
+	"monkey/trace"
+	"sort"
+	"strings"
+	"syscall/js"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// The functions of this file serve the editor. Positions are offsets into
+// the code counted in UTF-16 code units, like the indexes of JavaScript
+// strings, and every result is JSON.
+
+// registerEditorFunctions sets the editor functions on the global object.
+// Each returns {result, is_error} like getAST.
+func registerEditorFunctions() {
+	js.Global().Set("tokenize", editorFunc(1, func(code string, _ int) (any, error) {
+		return tokenize(code), nil
+	}))
+	js.Global().Set("diagnostics", editorFunc(1, func(code string, _ int) (any, error) {
+		return diagnostics(lsp.NewDocument("", code)), nil
+	}))
+	js.Global().Set("hover", editorFunc(2, func(code string, offset int) (any, error) {
+		return hover(lsp.NewDocument("", code), offset), nil
+	}))
+	js.Global().Set("completions", editorFunc(2, func(code string, offset int) (any, error) {
+		return completions(lsp.NewDocument("", code), offset), nil
+	}))
+	js.Global().Set("definition", editorFunc(2, func(code string, offset int) (any, error) {
+		return definition(lsp.NewDocument("", code), offset), nil
+	}))
+	js.Global().Set("format", editorFunc(1, func(code string, _ int) (any, error) {
+		return format.Source(code)
+	}))
+	js.Global().Set("trace", editorFunc(1, func(code string, _ int) (any, error) {
+		return traceProgram(code)
+	}))
+}
+
+// editorFunc wraps fn, which takes the code and, when arity is 2, an offset
+func editorFunc(arity int, fn func(code string, offset int) (any, error)) js.Func {
+	return js.FuncOf(func(this js.Value, args []js.Value) (response any) {
+		defer recoverResponse(&response)
+		if len(args) != arity {
+			return js.ValueOf("err: wrong data")
+		}
+		offset := 0
+		if arity == 2 {
+			offset = args[1].Int()
+		}
+
+		var result string
+		value, err := fn(args[0].String(), offset)
+		if err == nil {
+			var bytes []byte
+			bytes, err = json.Marshal(value)
+			result = string(bytes)
+		}
+		if err != nil {
+			result = err.Error()
+		}
+
+		return js.ValueOf(map[string]any{
+			"result":   result,
+			"is_error": err != nil,
+		})
+	})
+}
+
+// editorToken is a token of the code, comments included. Line and column
+// are 1-based and count bytes like the positions of the parser.
+type editorToken struct {
+	Type    token.Type `json:"type"`
+	Literal string     `json:"literal"`
+	Line    int        `json:"line"`
+	Column  int        `json:"column"`
+	Offset  int        `json:"offset"`
+	Length  int        `json:"length"`
+}
+
+// tokenize returns the tokens of code in the order they appear, from the
+// same lexer the parser reads
+func tokenize(code string) []editorToken {
+	l := lexer.New(code)
+	tokens := []token.Token{}
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		tokens = append(tokens, tok)
+	}
+	tokens = append(tokens, l.Comments()...)
+
+	// units[i] is the offset of the byte i of code in UTF-16 code units
+	units := make([]int, len(code)+1)
+	// lines[i] is the offset of the line i+1 in bytes
+	lines := []int{0}
+	for i := 0; i < len(code); {
+		r, size := utf8.DecodeRuneInString(code[i:])
+		for j := 1; j <= size; j++ {
+			units[i+j] = units[i] + len(utf16.Encode([]rune{r}))
+		}
+		if r == '\n' {
+			lines = append(lines, i+1)
+		}
+		i += size
+	}
+
+	result := make([]editorToken, 0, len(tokens))
+	for _, tok := range tokens {
+		start := lines[tok.Line-1] + tok.Column - 1
+		// the literal of a string leaves out its quotes
+		length := len(tok.Literal)
+		if tok.Type == token.STRING {
+			length += 2
+		}
+		end := min(start+length, len(code))
+		result = append(result, editorToken{
+			Type:    tok.Type,
+			Literal: tok.Literal,
+			Line:    tok.Line,
+			Column:  tok.Column,
+			Offset:  units[start],
+			Length:  units[end] - units[start],
+		})
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Offset < result[j].Offset })
+	return result
+}
+
+// editorRange is a range of the code from offset start to offset end
+type editorRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+func rangeOf(d *lsp.Document, r lsp.Range) editorRange {
+	return editorRange{Start: d.OffsetAt(r.Start), End: d.OffsetAt(r.End)}
+}
+
+type editorDiagnostic struct {
+	editorRange
+	Severity string `json:"severity"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+// diagnostics returns the problems the language server reports for the code
+func diagnostics(d *lsp.Document) []editorDiagnostic {
+	result := []editorDiagnostic{}
+	for _, diagnostic := range d.Diagnostics() {
+		severity := "error"
+		if diagnostic.Severity == lsp.SeverityWarning {
+			severity = "warning"
+		}
+		result = append(result, editorDiagnostic{
+			editorRange: rangeOf(d, diagnostic.Range),
+			Severity:    severity,
+			Source:      diagnostic.Source,
+			Message:     diagnostic.Message,
+		})
+	}
+	return result
+}
+
+type editorHover struct {
+	editorRange
+	Contents string `json:"contents"`
+}
+
+// hover returns the Markdown describing the name at offset, or nil
+func hover(d *lsp.Document, offset int) *editorHover {
+	h := d.Hover(d.PositionAt(offset))
+	if h == nil {
+		return nil
+	}
+	return &editorHover{editorRange: rangeOf(d, h.Range), Contents: h.Contents.Value}
+}
+
+// completions returns the names that can be typed at offset. Their kinds are
+// the completion item kinds of the Language Server Protocol.
+func completions(d *lsp.Document, offset int) []lsp.CompletionItem {
+	items := d.Completion(d.PositionAt(offset))
+	if items == nil {
+		items = []lsp.CompletionItem{}
+	}
+	return items
+}
+
+// definition returns the range of the declaration of the name at offset,
+// or nil
+func definition(d *lsp.Document, offset int) *editorRange {
+	location := d.Definition(d.PositionAt(offset))
+	if location == nil {
+		return nil
+	}
+	r := rangeOf(d, location.Range)
+	return &r
+}
+
+// traceLimit is the number of events trace records before it stops the
+// program
+const traceLimit = 10000
+
+type traceResult struct {
+	Events []trace.Event `json:"events"`
+	// Truncated is set when the program was stopped at the limit of events
+	Truncated bool   `json:"truncated"`
+	Stdout    string `json:"stdout"`
+	Result    string `json:"result"`
+	Error     string `json:"error"`
+}
+
+// traceProgram evaluates code and records every node the evaluator visits,
+// with the value it evaluated to
+func traceProgram(code string) (*traceResult, error) {
+	p := parser.New(lexer.New(code))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(printParserErrors(p.Errors()))
+	}
+	if errs := resolver.Errors(resolver.Resolve(program, nil)); len(errs) != 0 {
+		return nil, errors.New(printResolverErrors(errs))
+	}
+
+	var stdout strings.Builder
+	env := object.NewEnvironment()
+	env.Runtime().Loader = module.NewLoader(stdlib.Resolver{Next: module.MapResolver{}})
+	env.Runtime().Stdout = &stdout
+	env.Runtime().Stderr = &stdout
+
+	tracer := trace.New(traceLimit)
+	evaluated := tracer.Run(program, env)
+
+	result := &traceResult{Events: tracer.Events(), Truncated: tracer.Truncated()}
+	if errObj, ok := evaluated.(*object.Error); ok {
+		result.Error = printRuntimeError(errObj)
+	} else if evaluated != nil {
+		result.Result = evaluated.Inspect()
+	}
+	result.Stdout = stdout.String()
+	return result, nil
+}
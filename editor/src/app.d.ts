@@ -1,11 +1,25 @@
 // See https://svelte.dev/docs/kit/types#app.d.ts
 
-import type { InterpreterResult } from "$lib/wasm/types";
+import type { InterpreterResult, OutputCallback, RunResult } from "$lib/wasm/types";
 
 // for information about these interfaces
 declare global {
-	function interpret(code: string): InterpreterResult;
+	function interpret(code: string, modules?: Record<string, string>): RunResult;
+	function interpretAsync(
+		code: string,
+		onOutput: OutputCallback,
+		modules?: Record<string, string>,
+		signal?: AbortSignal
+	): Promise<{ result: string }>;
 	function getAST(code: string): InterpreterResult;
+	function typecheck(code: string): InterpreterResult;
+	function tokenize(code: string): InterpreterResult;
+	function diagnostics(code: string): InterpreterResult;
+	function hover(code: string, offset: number): InterpreterResult;
+	function completions(code: string, offset: number): InterpreterResult;
+	function definition(code: string, offset: number): InterpreterResult;
+	function format(code: string): InterpreterResult;
+	function trace(code: string): InterpreterResult;
 	namespace App {
 		// interface Error {}
 		// interface Locals {}
@@ -1,16 +1,73 @@
 // This file contains all the functions that can be involked from WASM
 
-import type { InterpreterResult } from "./types"
+import type { InterpreterResult, OutputCallback, RunResult } from "./types"
 
 export class Wasm {
     private _global = globalThis
 
-    interpret(code: string): InterpreterResult {
-        return this._global.interpret(code)
+    // modules maps the paths used in import statements to their source
+    interpret(code: string, modules: Record<string, string> = {}): RunResult {
+        return this._global.interpret(code, modules)
+    }
+
+    // interpretAsync streams the output of the program to onOutput while it
+    // runs, the promise rejects when the program fails or signal is aborted
+    interpretAsync(
+        code: string,
+        onOutput: OutputCallback,
+        modules: Record<string, string> = {},
+        signal?: AbortSignal
+    ): Promise<{ result: string }> {
+        return this._global.interpretAsync(code, onOutput, modules, signal)
     }
 
     getAST(code: string): InterpreterResult {
         return this._global.getAST(code)
     } 
-}
 
+    // typecheck returns the type errors of code, result is a JSON encoded
+    // TypeError[] unless the code does not parse
+    typecheck(code: string): InterpreterResult {
+        return this._global.typecheck(code)
+    }
+
+    // The functions below back the editor. Offsets count UTF-16 code units
+    // like JavaScript strings, and result is JSON unless is_error is set.
+
+    // tokenize returns EditorToken[], comments included, in source order
+    tokenize(code: string): InterpreterResult {
+        return this._global.tokenize(code)
+    }
+
+    // diagnostics returns the EditorDiagnostic[] of the parser, the resolver
+    // and the type checker
+    diagnostics(code: string): InterpreterResult {
+        return this._global.diagnostics(code)
+    }
+
+    // hover returns the EditorHover of the name at offset, or null
+    hover(code: string, offset: number): InterpreterResult {
+        return this._global.hover(code, offset)
+    }
+
+    // completions returns the CompletionItem[] that can be typed at offset
+    completions(code: string, offset: number): InterpreterResult {
+        return this._global.completions(code, offset)
+    }
+
+    // definition returns the OffsetRange declaring the name at offset, or null
+    definition(code: string, offset: number): InterpreterResult {
+        return this._global.definition(code, offset)
+    }
+
+    // format returns the formatted code as a JSON string
+    format(code: string): InterpreterResult {
+        return this._global.format(code)
+    }
+
+    // trace runs code and returns a TraceResult, with an event for every
+    // node the evaluator visits
+    trace(code: string): InterpreterResult {
+        return this._global.trace(code)
+    }
+}
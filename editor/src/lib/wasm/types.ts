@@ -1,4 +1,85 @@
 export interface InterpreterResult {
     result: string
     is_error: boolean
-}
\ No newline at end of file
+}
+
+// RunResult keeps what the program printed apart from the value it evaluated to
+export interface RunResult extends InterpreterResult {
+    stdout: string
+    stderr: string
+}
+
+export type OutputStream = "stdout" | "stderr"
+
+// OutputCallback receives the output of a program while it runs
+export type OutputCallback = (stream: OutputStream, chunk: string) => void
+
+export interface Position {
+    line: number
+    column: number
+}
+
+export interface Span {
+    start: Position
+    end: Position
+}
+
+// TypeError is one of the errors reported by typecheck
+export interface TypeError {
+    span: Span
+    message: string
+}
+
+// EditorToken is a token returned by tokenize. Line and column are 1-based
+// and count bytes, offset and length count UTF-16 code units.
+export interface EditorToken {
+    type: string
+    literal: string
+    line: number
+    column: number
+    offset: number
+    length: number
+}
+
+// OffsetRange runs from offset start to offset end of the code
+export interface OffsetRange {
+    start: number
+    end: number
+}
+
+export interface EditorDiagnostic extends OffsetRange {
+    severity: "error" | "warning"
+    source: string
+    message: string
+}
+
+// EditorHover holds the Markdown describing a name
+export interface EditorHover extends OffsetRange {
+    contents: string
+}
+
+// CompletionItem kinds are those of the Language Server Protocol
+export interface CompletionItem {
+    label: string
+    kind: number
+    detail?: string
+}
+
+// TraceEvent is the visit of a node by the evaluator, a node comes before
+// its children. depth counts the scopes enclosing the one it runs in.
+export interface TraceEvent {
+    kind: string
+    span: Span
+    value: string
+    depth: number
+}
+
+// TraceResult is returned by trace. truncated is set when the program was
+// stopped because it reached the limit of events.
+export interface TraceResult {
+    events: TraceEvent[]
+    truncated: boolean
+    stdout: string
+    result: string
+    error: string
+}
@@ -1,5 +1,7 @@
 export const codeState = $state({
     inputCode: "",
     isError: false,
-    result: "Press the 'Run' button to see the result."
+    result: "Press the 'Run' button to see the result.",
+    stdout: "",
+    stderr: ""
 })
\ No newline at end of file
@@ -0,0 +1,130 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/object"
+	"strings"
+)
+
+// The assertions are added to the builtins on init, as assert_error calls
+// back into the evaluator, which looks builtins up
+func init() {
+	for _, builtin := range []*object.Builtin{
+		{Name: "assert", Fn: assert},
+		{Name: "assert_eq", Fn: assertEq},
+		{Name: "assert_error", Fn: assertError},
+	} {
+		builtins[builtin.Name] = builtin
+	}
+}
+
+// assertionError returns the error of a failed assertion, with the message
+// the program gave it if any
+func assertionError(args []object.Object, messageIndex int, format string, a ...any) *object.Error {
+	message := fmt.Sprintf(format, a...)
+	if len(args) > messageIndex {
+		message = args[messageIndex].Inspect() + ": " + message
+	}
+	return newError(object.AssertionError, "%s", message)
+}
+
+// assert(condition, message) fails unless condition is truthy
+func assert(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError(object.TypeError, "wrong number of arguments to assert: want=1 or 2, got=%d", len(args))
+	}
+	if !IsTruthy(args[0]) {
+		return assertionError(args, 1, "assert failed: %s is not truthy", args[0].Inspect())
+	}
+	return NullObj
+}
+
+// assert_eq(actual, expected, message) fails unless both values have the same
+// type and Inspect the same, and shows how they differ
+func assertEq(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError(object.TypeError, "wrong number of arguments to assert_eq: want=2 or 3, got=%d", len(args))
+	}
+	actual, expected := args[0], args[1]
+	if actual.Type() != expected.Type() {
+		return assertionError(args, 2, "assert_eq failed: expected %s, got %s\n%s",
+			expected.Type(), actual.Type(), diff(expected.Inspect(), actual.Inspect()))
+	}
+	if actual.Inspect() != expected.Inspect() {
+		return assertionError(args, 2, "assert_eq failed\n%s", diff(expected.Inspect(), actual.Inspect()))
+	}
+	return NullObj
+}
+
+// assert_error(fn, part) calls fn without arguments and fails unless it
+// returns an error whose message contains part. It returns the message.
+func assertError(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError(object.TypeError, "wrong number of arguments to assert_error: want=1 or 2, got=%d", len(args))
+	}
+	switch args[0].(type) {
+	case *object.Function, *object.Builtin:
+	default:
+		return newError(object.TypeError, "first argument to assert_error must be FUNCTION, got %s", args[0].Type())
+	}
+	var part string
+	if len(args) == 2 {
+		str, ok := args[1].(*object.String)
+		if !ok {
+			return newError(object.TypeError, "second argument to assert_error must be STRING, got %s", args[1].Type())
+		}
+		part = str.Value
+	}
+
+	err, ok := applyFunction(args[0], nil, env).(*object.Error)
+	if !ok {
+		return newError(object.AssertionError, "assert_error failed: the function returned without an error")
+	}
+	if !err.Catchable() {
+		return err
+	}
+	if !strings.Contains(err.Message, part) {
+		return newError(object.AssertionError, "assert_error failed: expected an error containing %q, got %q", part, err.Message)
+	}
+	return &object.String{Value: err.Message}
+}
+
+// diff shows the lines of expected and actual, the ones only in expected
+// prefixed by -, the ones only in actual by + and the common ones by a
+// space, the way diff -u does
+func diff(expected, actual string) string {
+	a, b := strings.Split(expected, "\n"), strings.Split(actual, "\n")
+	// common[i][j] is the length of the longest common subsequence of
+	// a[i:] and b[j:]
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	out.WriteString("--- expected\n+++ actual")
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out.WriteString("\n " + a[i])
+			i, j = i+1, j+1
+		case j == len(b) || (i < len(a) && common[i+1][j] >= common[i][j+1]):
+			out.WriteString("\n-" + a[i])
+			i++
+		default:
+			out.WriteString("\n+" + b[j])
+			j++
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,105 @@
+package evaluator
+
+import (
+	"io"
+	"monkey/object"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// builtins are looked up after every environment of the chain, so programs
+// can shadow them with their own bindings
+var builtins = map[string]*object.Builtin{
+	"len": {
+		Name: "len",
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.TypeError, "wrong number of arguments to len: want=1, got=%d", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *object.String:
+				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+			case *object.Array:
+				return &object.Integer{Value: int64(len(arg.Elements))}
+			case *object.Hash:
+				return &object.Integer{Value: int64(len(arg.Pairs()))}
+			}
+			return newError(object.TypeError, "argument to len not supported: %s", args[0].Type())
+		},
+	},
+	"push": {
+		Name: "push",
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError(object.TypeError, "wrong number of arguments to push: want=2, got=%d", len(args))
+			}
+			array, ok := args[0].(*object.Array)
+			if !ok {
+				return newError(object.TypeError, "first argument to push must be ARRAY, got %s", args[0].Type())
+			}
+			// push never changes its argument, it returns a new array
+			elements := make([]object.Object, len(array.Elements), len(array.Elements)+1)
+			copy(elements, array.Elements)
+			return &object.Array{Elements: append(elements, args[1])}
+		},
+	},
+	"str": {
+		Name: "str",
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.TypeError, "wrong number of arguments to str: want=1, got=%d", len(args))
+			}
+			if str, ok := args[0].(*object.String); ok {
+				return str
+			}
+			return &object.String{Value: args[0].Inspect()}
+		},
+	},
+	"puts": {
+		Name: "puts",
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			out := stdout(env)
+			for _, arg := range args {
+				io.WriteString(out, arg.Inspect()+"\n")
+			}
+			return NullObj
+		},
+	},
+	"print": {
+		Name: "print",
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			values := make([]string, 0, len(args))
+			for _, arg := range args {
+				values = append(values, arg.Inspect())
+			}
+			io.WriteString(stdout(env), strings.Join(values, " "))
+			return NullObj
+		},
+	},
+}
+
+// stdout returns the writer programs running in env print to
+func stdout(env *object.Environment) io.Writer {
+	if w := env.Runtime().Stdout; w != nil {
+		return w
+	}
+	return io.Discard
+}
+
+// Builtins returns the names of the builtin functions, sorted
+func Builtins() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsBuiltin reports whether name refers to a builtin function when no
+// variable of that name is in scope
+func IsBuiltin(name string) bool {
+	_, ok := builtins[name]
+	return ok
+}
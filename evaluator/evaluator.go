@@ -1,6 +1,7 @@
 package evaluator
 
 import (
+	"errors"
 	"fmt"
 	"monkey/ast"
 	"monkey/object"
@@ -12,7 +13,64 @@ var (
 	NullObj  = &object.Null{}
 )
 
-func Eval(node ast.Node, env *object.Environment) object.Object {
+func Eval(node ast.Node, env *object.Environment) (result object.Object) {
+	// a panic is turned into an error by the innermost node it goes
+	// through, which locates it best
+	defer func() {
+		if r := recover(); r != nil {
+			result = internalError(r, node)
+		}
+	}()
+
+	hook := env.Runtime().Hook
+	if hook == nil {
+		return eval(node, env)
+	}
+	if err := hook.Before(node, env); err != nil {
+		return err
+	}
+	result = eval(node, env)
+	hook.After(node, env, result)
+	return result
+}
+
+// EvalWithHook evaluates node in env with hook set on its Runtime, and sets
+// back the hook it replaced once the evaluation ends
+func EvalWithHook(node ast.Node, env *object.Environment, hook object.Hook) object.Object {
+	defer setHook(env, hook)()
+	return Eval(node, env)
+}
+
+// ApplyWithHook is Apply with hook set like EvalWithHook sets it
+func ApplyWithHook(fn object.Object, args []object.Object, env *object.Environment, hook object.Hook) object.Object {
+	defer setHook(env, hook)()
+	return Apply(fn, args, env)
+}
+
+// setHook sets hook on the Runtime of env and returns the function setting
+// back the hook it replaced
+func setHook(env *object.Environment, hook object.Hook) func() {
+	runtime := env.Runtime()
+	previous := runtime.Hook
+	runtime.Hook = hook
+	return func() { runtime.Hook = previous }
+}
+
+// internalError returns the error reporting the Go panic r, raised while
+// node was evaluated, along with the position of node in the source
+func internalError(r any, node ast.Node) *object.Error {
+	message := fmt.Sprint(r)
+	if node != nil {
+		if start := ast.SpanOf(node).Start; start.Line != 0 {
+			message = fmt.Sprintf("%s (%d:%d)", message, start.Line, start.Column)
+		}
+	}
+	return newError(object.InternalError, "%s", message)
+}
+
+// eval evaluates node, Eval wraps it with the calls to the hook of the
+// runtime
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 
 	case *ast.Program:
@@ -32,7 +90,18 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		if !declare(env, node.Name, val, false) {
+			return newError(object.ReferenceError, "identifier already declared: %s", node.Name.Value)
+		}
+
+	case *ast.ConstStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		if !declare(env, node.Name, val, true) {
+			return newError(object.ReferenceError, "identifier already declared: %s", node.Name.Value)
+		}
 
 	case *ast.Boolean:
 		if node.Value {
@@ -67,6 +136,34 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.WhileStatement:
 		return evalWhileStatement(node, env)
 
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+
+	case *ast.ForInStatement:
+		return evalForInStatement(node, env)
+
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return newThrownError(val)
+
+	case *ast.TryStatement:
+		return evalTryStatement(node, env)
+
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
+
+	case *ast.ExportStatement:
+		return Eval(node.Statement, env)
+
+	case *ast.BreakStatement:
+		return &object.Break{}
+
+	case *ast.ContinueStatement:
+		return &object.Continue{}
+
 	case *ast.ReturnStatement:
 		val := Eval(node.Value, env)
 		if isError(val) {
@@ -78,20 +175,47 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalIdentifier(node, env)
 
 	case *ast.AssignStatement:
-		_, ok := env.Get(node.Name.Value)
-		if !ok {
-			return newError("%s is not defined", node.Name.Value)
-		}
-		val := Eval(node.Value, env)
-		if isError(val) {
-			return val
-		}
-		env.Set(node.Name.Value, val)
+		return evalAssignStatement(node, env)
 
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{Name: node.Name, Parameters: params, Env: env, Body: body}
+
+	case *ast.FunctionStatement:
+		// already bound by hoistFunctions when the enclosing block started
+		return nil
+
+	case *ast.ArrayLiteral:
+		elements := evalExpression(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
+
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+
+	case *ast.MemberExpression:
+		obj := Eval(node.Object, env)
+		if isError(obj) {
+			return obj
+		}
+		return evalMemberExpression(obj, node.Property.Value)
+
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
 
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
@@ -104,32 +228,188 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		// a tail call is made by applyFunction once the current call is
+		// over, unless a hook needs it nested in the current call
+		if fn, ok := function.(*object.Function); ok && node.Tail && !nestsTailCalls(env.Runtime().Hook) {
+			return &tailCall{fn: fn, args: args, node: node}
+		}
+
+		result := applyFunction(function, args, env)
+		if err, ok := result.(*object.Error); ok {
+			if fn, ok := function.(*object.Function); ok {
+				err.Stack = append(err.Stack, callFrame(fn, node))
+			}
+		}
+		return result
 	}
 
 	return nil
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func applyFunction(fn object.Object, args []object.Object, env *object.Environment) object.Object {
+	if builtin, ok := fn.(*object.Builtin); ok {
+		return builtin.Fn(env, args...)
+	}
+
 	function, ok := fn.(*object.Function)
 	if !ok {
-		return newError("not a function %s", fn.Type())
+		return newError(object.TypeError, "not a function %s", fn.Type())
+	}
+
+	// the calls function ends with come back as tail calls, which are made
+	// here one after the other rather than nested in each other, so tail
+	// recursion runs in constant stack
+	var node *ast.CallExpression
+	for {
+		evaluated := callFunction(function, args)
+		call, ok := evaluated.(*tailCall)
+		if !ok {
+			// the caller adds the frame of the first call, the frames of
+			// the tail calls in between are gone
+			if err, ok := evaluated.(*object.Error); ok && node != nil {
+				err.Stack = append(err.Stack, callFrame(function, node))
+			}
+			return evaluated
+		}
+		function, args, node = call.fn, call.args, call.node
+	}
+}
+
+// maxCallDepth is the number of nested calls past which a program fails.
+// Go cannot recover from a stack overflow, which would end the host with it.
+const maxCallDepth = 10000
+
+// callFunction evaluates the body of function with args bound to its
+// parameters, and returns the value it returns
+func callFunction(function *object.Function, args []object.Object) object.Object {
+	if err := checkCancelled(function.Env); err != nil {
+		return err
+	}
+	if len(args) != len(function.Parameters) {
+		return newError(object.TypeError, "wrong number of arguments to %s: want=%d, got=%d",
+			functionName(function), len(function.Parameters), len(args))
+	}
+	runtime := function.Env.Runtime()
+	if runtime.Depth >= maxCallDepth {
+		return newError(object.RuntimeError, "maximum call depth of %d exceeded", maxCallDepth)
+	}
+	runtime.Depth++
+	defer func() { runtime.Depth-- }()
+
+	hook := runtime.Hook
+	if hook != nil {
+		hook.Call(function, args)
 	}
 	extendedEnv := extendFunctionEnv(function, args)
-	evaluated := Eval(function.Body, extendedEnv)
-	return unwrapReturnValue(evaluated)
+	evaluated := nullIfNil(unwrapReturnValue(Eval(function.Body, extendedEnv)))
+	if hook != nil {
+		hook.Return(function, evaluated)
+	}
+	return evaluated
+}
+
+// nestsTailCalls reports whether hook needs tail calls nested in their caller
+func nestsTailCalls(hook object.Hook) bool {
+	nester, ok := hook.(object.TailCallNester)
+	return ok && nester.NestTailCalls()
+}
+
+// tailCall is a call in tail position, returned by the function making it
+// for applyFunction to make once that function is done
+type tailCall struct {
+	fn   *object.Function
+	args []object.Object
+	node *ast.CallExpression
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return tc.node.String() }
+
+// callFrame returns the entry of a stack trace for the call of fn by node
+func callFrame(fn *object.Function, node *ast.CallExpression) string {
+	return fmt.Sprintf("%s (%d:%d)", functionName(fn), node.Token.Line, node.Token.Column)
 }
 
 func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
 	env := object.NewEnclosedEnvironment(fn.Env)
 
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		set(env, param, args[paramIdx])
 	}
 
 	return env
 }
 
+// Apply calls fn, a Monkey function or a builtin, with args. It lets host
+// code call back into functions received from a program, env is the
+// environment builtins are called from.
+func Apply(fn object.Object, args []object.Object, env *object.Environment) (result object.Object) {
+	// builtins are called without going through Eval, which recovers
+	// the panics of everything else
+	defer func() {
+		if r := recover(); r != nil {
+			result = internalError(r, nil)
+		}
+	}()
+	return applyFunction(fn, args, env)
+}
+
+// checkCancelled returns an error once the context of the runtime is done.
+// Loops and function calls check it, so every program can be stopped.
+func checkCancelled(env *object.Environment) object.Object {
+	ctx := env.Runtime().Context
+	if ctx == nil {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return newError(object.CancelledError, "evaluation cancelled: %s", ctx.Err())
+	default:
+		return nil
+	}
+}
+
+// functionName returns the name used for fn in stack traces and errors
+func functionName(fn *object.Function) string {
+	if fn.Name == "" {
+		return "<anonymous>"
+	}
+	return fn.Name
+}
+
+// hoistFunctions binds every function declaration among statements in env,
+// before any of the statements run
+func hoistFunctions(statements []ast.Statement, env *object.Environment) object.Object {
+	for _, statement := range statements {
+		if export, ok := statement.(*ast.ExportStatement); ok {
+			statement = export.Statement
+		}
+		decl, ok := statement.(*ast.FunctionStatement)
+		if !ok {
+			continue
+		}
+		fn := &object.Function{
+			Name:       decl.Name.Value,
+			Parameters: decl.Function.Parameters,
+			Body:       decl.Function.Body,
+			Env:        env,
+		}
+		if !declare(env, decl.Name, fn, false) {
+			return newError(object.ReferenceError, "identifier already declared: %s", decl.Name.Value)
+		}
+	}
+	return nil
+}
+
+// nullIfNil returns null for the nil result of a block that is empty or
+// ends with a statement, where a value is expected
+func nullIfNil(obj object.Object) object.Object {
+	if obj == nil {
+		return NullObj
+	}
+	return obj
+}
+
 func unwrapReturnValue(obj object.Object) object.Object {
 	if returnValue, ok := obj.(*object.Return); ok {
 		return returnValue.Value
@@ -150,11 +430,15 @@ func evalExpression(exps []ast.Expression, env *object.Environment) []object.Obj
 }
 
 func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	if err := hoistFunctions(block.Statements, env); err != nil {
+		return err
+	}
+
 	var result object.Object
 	for _, statement := range block.Statements {
 		result = Eval(statement, env)
 
-		if result != nil && (result.Type() == object.ReturnTypeObj || result.Type() == object.ErrorObj) {
+		if isControlFlow(result) {
 			return result
 		}
 	}
@@ -168,10 +452,10 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 		return condition
 	}
 
-	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+	if IsTruthy(condition) {
+		return nullIfNil(Eval(ie.Consequence, object.NewEnclosedEnvironment(env)))
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return nullIfNil(Eval(ie.Alternative, object.NewEnclosedEnvironment(env)))
 	} else {
 		return NullObj
 	}
@@ -186,13 +470,14 @@ func evalWhileStatement(ie *ast.WhileStatement, env *object.Environment) object.
 
 	var result object.Object
 
-	for isTruthy(condition) {
-		result = Eval(ie.Consequence, env)
-		if result != nil {
-			if result.Type() == object.ReturnTypeObj || result.Type() == object.ErrorObj {
-				return result
-			}
+	for IsTruthy(condition) {
+		// every iteration gets a fresh scope so that a let in the body
+		// does not collide with the one from the previous iteration
+		value, done := evalLoopBody(ie.Consequence, object.NewEnclosedEnvironment(env))
+		if done {
+			return value
 		}
+		result = value
 		condition = Eval(ie.Condition, env)
 		if isError(condition) {
 			return condition
@@ -203,7 +488,200 @@ func evalWhileStatement(ie *ast.WhileStatement, env *object.Environment) object.
 
 }
 
-func isTruthy(obj object.Object) bool {
+// evalForStatement runs a C-style loop. The variables declared by the init
+// statement are copied for every iteration before the post statement runs,
+// so a closure created in the body keeps the values of its own iteration.
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	loopEnv := object.NewEnclosedEnvironment(env)
+
+	if fs.Init != nil {
+		init := Eval(fs.Init, loopEnv)
+		if isError(init) {
+			return init
+		}
+	}
+
+	var result object.Object
+
+	for {
+		if fs.Condition != nil {
+			condition := Eval(fs.Condition, loopEnv)
+			if isError(condition) {
+				return condition
+			}
+			if !IsTruthy(condition) {
+				break
+			}
+		}
+
+		value, done := evalLoopBody(fs.Body, object.NewEnclosedEnvironment(loopEnv))
+		if done {
+			return value
+		}
+		result = value
+
+		loopEnv = loopEnv.Copy()
+		if fs.Post != nil {
+			post := Eval(fs.Post, loopEnv)
+			if isError(post) {
+				return post
+			}
+		}
+	}
+
+	return result
+}
+
+func evalForInStatement(fs *ast.ForInStatement, env *object.Environment) object.Object {
+	iterable := Eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	var elements []object.Object
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		elements = iterable.Elements
+	case *object.String:
+		for _, ch := range iterable.Value {
+			elements = append(elements, &object.String{Value: string(ch)})
+		}
+	case *object.Hash:
+		for _, pair := range iterable.Pairs() {
+			elements = append(elements, pair.Key)
+		}
+	default:
+		return newError(object.TypeError, "cannot iterate over %s", iterable.Type())
+	}
+
+	var result object.Object
+
+	for _, element := range elements {
+		iterationEnv := object.NewEnclosedEnvironment(env)
+		set(iterationEnv, fs.Variable, element)
+
+		value, done := evalLoopBody(fs.Body, iterationEnv)
+		if done {
+			return value
+		}
+		result = value
+	}
+
+	return result
+}
+
+// evalLoopBody runs a single iteration of a loop body. It reports whether the
+// loop has to stop, along with the value it should stop with: return values
+// and errors propagate, a break ends the loop and a continue only ends the iteration.
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	if err := checkCancelled(env); err != nil {
+		return err, true
+	}
+
+	result := Eval(body, env)
+	if result == nil {
+		return nil, false
+	}
+
+	switch result.Type() {
+	case object.ReturnTypeObj, object.ErrorObj:
+		return result, true
+	case object.BreakObj:
+		return nil, true
+	case object.ContinueObj:
+		return nil, false
+	}
+	return result, false
+}
+
+// isControlFlow reports whether obj stops the evaluation of the enclosing
+// block: a return value, an error, a break or a continue
+func isControlFlow(obj object.Object) bool {
+	if obj == nil {
+		return false
+	}
+	switch obj.Type() {
+	case object.ReturnTypeObj, object.ErrorObj, object.BreakObj, object.ContinueObj:
+		return true
+	}
+	return false
+}
+
+// evalTryStatement runs the try block and hands an error raised by it to the
+// catch block. The finally block always runs last. When it ends normally the
+// outcome of the try or catch block is kept, so a return inside try still
+// returns after finally has run. When finally itself returns, throws, breaks
+// or continues, that replaces the earlier outcome.
+func evalTryStatement(ts *ast.TryStatement, env *object.Environment) object.Object {
+	result := Eval(ts.Block, object.NewEnclosedEnvironment(env))
+
+	if err, ok := result.(*object.Error); ok && ts.Catch != nil && err.Catchable() {
+		catchEnv := object.NewEnclosedEnvironment(env)
+		if ts.Parameter != nil {
+			set(catchEnv, ts.Parameter, errorToHash(err))
+		}
+		result = Eval(ts.Catch, catchEnv)
+	}
+
+	if ts.Finally != nil {
+		finally := Eval(ts.Finally, object.NewEnclosedEnvironment(env))
+		if isControlFlow(finally) {
+			return finally
+		}
+	}
+
+	return result
+}
+
+// errorToHash turns a caught error into the value bound by catch, a hash
+// with the "message", "kind" and "stack" of the error
+func errorToHash(err *object.Error) *object.Hash {
+	stack := &object.Array{}
+	for _, frame := range err.Stack {
+		stack.Elements = append(stack.Elements, &object.String{Value: frame})
+	}
+
+	hash := object.NewHash()
+	hash.Set(&object.String{Value: "message"}, &object.String{Value: err.Message})
+	hash.Set(&object.String{Value: "kind"}, &object.String{Value: string(err.Kind)})
+	hash.Set(&object.String{Value: "stack"}, stack)
+	return hash
+}
+
+// newThrownError builds the error raised by a throw statement. Throwing a hash
+// that looks like a caught error, such as the one bound by catch, raises it
+// again with its message, kind and stack intact; any other value becomes
+// the message of a plain error.
+func newThrownError(val object.Object) *object.Error {
+	err := &object.Error{Kind: object.ThrownError, Message: val.Inspect()}
+
+	hash, ok := val.(*object.Hash)
+	if !ok {
+		return err
+	}
+	if message, ok := hash.Get(&object.String{Value: "message"}); ok {
+		err.Message = message.Inspect()
+	}
+	// a program cannot raise the kinds it cannot catch, which stand for
+	// cancellation and bugs of the interpreter
+	if kind, ok := hash.Get(&object.String{Value: "kind"}); ok {
+		if k := object.ErrorKind(kind.Inspect()); (&object.Error{Kind: k}).Catchable() {
+			err.Kind = k
+		}
+	}
+	if stack, ok := hash.Get(&object.String{Value: "stack"}); ok {
+		if stack, ok := stack.(*object.Array); ok {
+			for _, frame := range stack.Elements {
+				err.Stack = append(err.Stack, frame.Inspect())
+			}
+		}
+	}
+	return err
+}
+
+// IsTruthy reports whether obj counts as true in a condition, everything
+// but null and false does
+func IsTruthy(obj object.Object) bool {
 	switch obj {
 	case NullObj:
 		return false
@@ -217,6 +695,10 @@ func isTruthy(obj object.Object) bool {
 }
 
 func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	if err := hoistFunctions(program.Statements, env); err != nil {
+		return err
+	}
+
 	var result object.Object
 	for _, statement := range program.Statements {
 		result = Eval(statement, env)
@@ -241,7 +723,7 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 
 	}
 
-	return newError("unknown operator: %s %s", operator, right.Type())
+	return newError(object.TypeError, "unknown operator: %s %s", operator, right.Type())
 }
 
 func evalBangOperatorExpression(right object.Object) object.Object {
@@ -261,7 +743,7 @@ func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 
 	value, ok := right.(*object.Integer)
 	if !ok {
-		return newError("unknown operator: -%s", right.Type())
+		return newError(object.TypeError, "unknown operator: -%s", right.Type())
 	}
 
 	return &object.Integer{Value: -value.Value}
@@ -278,19 +760,24 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	case operator == "!=":
 		return nativeBoolToBooleanObj(left != right)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
 func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
-	if operator != "+" {
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
-
 	leftValue := left.(*object.String).Value
 	rightValue := right.(*object.String).Value
 
-	return &object.String{Value: leftValue + rightValue}
+	switch operator {
+	case "+":
+		return &object.String{Value: leftValue + rightValue}
+	case "==":
+		return nativeBoolToBooleanObj(leftValue == rightValue)
+	case "!=":
+		return nativeBoolToBooleanObj(leftValue != rightValue)
+	}
+
+	return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 }
 
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
@@ -305,6 +792,9 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	case "*":
 		return &object.Integer{Value: leftValue * rightValue}
 	case "/":
+		if rightValue == 0 {
+			return newError(object.RuntimeError, "division by zero")
+		}
 		return &object.Integer{Value: leftValue / rightValue}
 	case "<":
 		return nativeBoolToBooleanObj(leftValue < rightValue)
@@ -327,8 +817,8 @@ func nativeBoolToBooleanObj(input bool) *object.Boolean {
 	return FalseObj
 }
 
-func newError(format string, a ...any) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+func newError(kind object.ErrorKind, format string, a ...any) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
 }
 
 func isError(obj object.Object) bool {
@@ -339,9 +829,245 @@ func isError(obj object.Object) bool {
 }
 
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
-	val, ok := env.Get(node.Value)
+	if node.Slot != nil {
+		if val, ok := env.GetAt(node.Slot.Depth, node.Slot.Index); ok {
+			return val
+		}
+	}
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+	if builtin, ok := builtins[node.Value]; ok {
+		return builtin
+	}
+	return newError(object.ReferenceError, "identifier not found: %s", node.Value)
+}
+
+// declare binds the identifier declared by a statement in env, in the slot
+// the resolver gave it if any
+func declare(env *object.Environment, ident *ast.Identifier, val object.Object, constant bool) bool {
+	if ident.Slot != nil {
+		return env.DeclareAt(ident.Slot.Index, ident.Value, val, constant)
+	}
+	return env.Declare(ident.Value, val, constant)
+}
+
+// set binds a parameter, loop variable or pattern variable in env
+func set(env *object.Environment, ident *ast.Identifier, val object.Object) {
+	if ident.Slot != nil {
+		env.SetAt(ident.Slot.Index, ident.Value, val)
+		return
+	}
+	env.Set(ident.Value, val)
+}
+
+func evalAssignStatement(node *ast.AssignStatement, env *object.Environment) object.Object {
+	name := node.Name.Value
+	if slot := node.Name.Slot; slot != nil {
+		if _, ok := env.GetAt(slot.Depth, slot.Index); ok {
+			if env.IsConstantAt(slot.Depth, slot.Index) {
+				return newError(object.TypeError, "cannot assign to constant: %s", name)
+			}
+			val := Eval(node.Value, env)
+			if isError(val) {
+				return val
+			}
+			env.AssignAt(slot.Depth, slot.Index, val)
+			return nil
+		}
+	}
+
+	_, ok := env.Get(name)
 	if !ok {
-		return newError("identifier not found: %s", node.Value)
+		return newError(object.ReferenceError, "%s is not defined", name)
+	}
+	if env.IsConstant(name) {
+		return newError(object.TypeError, "cannot assign to constant: %s", name)
+	}
+	val := Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+	env.Assign(name, val)
+	return nil
+}
+
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ArrayObj && index.Type() == object.IntegerTypeObj:
+		elements := left.(*object.Array).Elements
+		idx := index.(*object.Integer).Value
+		if idx < 0 || idx >= int64(len(elements)) {
+			return NullObj
+		}
+		return elements[idx]
+	case left.Type() == object.StringObj && index.Type() == object.IntegerTypeObj:
+		chars := []rune(left.(*object.String).Value)
+		idx := index.(*object.Integer).Value
+		if idx < 0 || idx >= int64(len(chars)) {
+			return NullObj
+		}
+		return &object.String{Value: string(chars[idx])}
+	case left.Type() == object.HashObj:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError(object.TypeError, "unusable as hash key: %s", index.Type())
+		}
+		value, ok := left.(*object.Hash).Get(key)
+		if !ok {
+			return NullObj
+		}
+		return value
+	default:
+		return newError(object.TypeError, "index operator not supported: %s", left.Type())
+	}
+}
+
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if isError(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError(object.TypeError, "unusable as hash key: %s", key.Type())
+		}
+
+		value := Eval(pair.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		hash.Set(hashKey, value)
+	}
+
+	return hash
+}
+
+func evalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := Eval(me.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, arm := range me.Arms {
+		armEnv := object.NewEnclosedEnvironment(env)
+		if matchPattern(arm.Pattern, subject, armEnv) {
+			return nullIfNil(Eval(arm.Body, armEnv))
+		}
+	}
+
+	return NullObj
+}
+
+// matchPattern reports whether value matches pattern, binding the
+// identifiers of the pattern in env along the way
+func matchPattern(pattern ast.Expression, value object.Object, env *object.Environment) bool {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			set(env, pattern, value)
+		}
+		return true
+
+	case *ast.IntegerLiteral:
+		integer, ok := value.(*object.Integer)
+		return ok && integer.Value == pattern.Value
+
+	case *ast.StringLiteral:
+		str, ok := value.(*object.String)
+		return ok && str.Value == pattern.Value
+
+	case *ast.Boolean:
+		return value == nativeBoolToBooleanObj(pattern.Value)
+
+	case *ast.ArrayLiteral:
+		array, ok := value.(*object.Array)
+		if !ok || len(array.Elements) != len(pattern.Elements) {
+			return false
+		}
+		for i, element := range pattern.Elements {
+			if !matchPattern(element, array.Elements[i], env) {
+				return false
+			}
+		}
+		return true
+
+	case *ast.HashLiteral:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return false
+		}
+		for _, pair := range pattern.Pairs {
+			key, ok := Eval(pair.Key, env).(object.Hashable)
+			if !ok {
+				return false
+			}
+			v, ok := hash.Get(key)
+			if !ok || !matchPattern(pair.Value, v, env) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+func evalImportStatement(is *ast.ImportStatement, env *object.Environment) object.Object {
+	loader := env.Runtime().Loader
+	if loader == nil {
+		return newError(object.RuntimeError, "cannot import %q: no module loader configured", is.Path)
+	}
+
+	module, err := loader.Load(is.Path, env)
+	var moduleErr *object.ModuleError
+	if errors.As(err, &moduleErr) {
+		// the error keeps its kind, a cancelled or broken module is not
+		// turned into an error the program can catch
+		return &object.Error{Kind: moduleErr.Err.Kind, Message: moduleErr.Error(), Stack: moduleErr.Err.Stack}
+	}
+	if err != nil {
+		return newError(object.RuntimeError, "%s", err)
+	}
+
+	if is.Alias != nil {
+		if !env.Declare(is.Alias.Value, module, true) {
+			return newError(object.ReferenceError, "identifier already declared: %s", is.Alias.Value)
+		}
+		return nil
+	}
+
+	for _, name := range is.Names {
+		value, ok := module.Exports[name.Value]
+		if !ok {
+			return newError(object.ReferenceError, "module %s has no export %s", module.Path, name.Value)
+		}
+		if !env.Declare(name.Value, value, true) {
+			return newError(object.ReferenceError, "identifier already declared: %s", name.Value)
+		}
+	}
+	return nil
+}
+
+func evalMemberExpression(obj object.Object, name string) object.Object {
+	switch obj := obj.(type) {
+	case *object.Module:
+		value, ok := obj.Exports[name]
+		if !ok {
+			return newError(object.ReferenceError, "module %s has no export %s", obj.Path, name)
+		}
+		return value
+	case *object.Hash:
+		value, ok := obj.Get(&object.String{Value: name})
+		if !ok {
+			return NullObj
+		}
+		return value
 	}
-	return val
+	return newError(object.TypeError, "member access not supported: %s.%s", obj.Type(), name)
 }
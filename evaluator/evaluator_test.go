@@ -1,9 +1,12 @@
 package evaluator
 
 import (
+	"monkey/ast"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"runtime/debug"
+	"strings"
 	"testing"
 )
 
@@ -151,6 +154,10 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (1 > 2) {10}", nil},
 		{"if (1 > 2) {10} else { 20 }", 20},
 		{"if (1 < 2) {10} else { 20 }", 10},
+		{"if (true) {}", nil},
+		{"if (true) { let x = 1; }", nil},
+		{"fn() {}()", nil},
+		{"match (1) { _ => {} }", nil},
 	}
 
 	for _, tt := range tests {
@@ -202,4 +209,743 @@ func TestFunctionObject(t *testing.T) {
 	if fn.Body.String() != expectedBody {
 		t.Fatalf("body is not %q, got=%q", expectedBody, fn.Body.String())
 	}
-}
\ No newline at end of file
+}
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"const a = 5; a;", 5},
+		{"const a = 5; let b = a * 2; b;", 10},
+		{"const a = 5; let f = fn() { let a = 1; a = a + 1; a }; f();", 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBindingErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5;", "x is not defined"},
+		{"let a = 1; let a = 2;", "identifier already declared: a"},
+		{"const a = 1; let f = fn() { a = 2 }; f();", "cannot assign to constant: a"},
+	}
+
+	for _, tt := range tests {
+		// the parser reports some of these statically; evaluate regardless
+		// to make sure the evaluator rejects them too
+		p := parser.New(lexer.New(tt.input))
+		evaluated := Eval(p.ParseProgram(), object.NewEnvironment())
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("input %q: no error object returned. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("input %q: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestBlockScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 1; if (true) { let x = 2; } x;", 1},
+		{"let x = 1; if (true) { x = 2; } x;", 2},
+		{"let i = 0; let sum = 0; while (i < 3) { let d = i * 2; sum = sum + d; i = i + 1; } sum;", 6},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let sum = 0; for (let i = 0; i < 5; i = i + 1) { sum = sum + i; } sum;", 10},
+		{"let sum = 0; for x in [1, 2, 3] { sum = sum + x; } sum;", 6},
+		{"let sum = 0; for (let i = 0; i < 10; i = i + 1) { if (i == 3) { break; } sum = sum + i; } sum;", 3},
+		{"let sum = 0; for x in [1, 2, 3, 4] { if (x == 2) { continue; } sum = sum + x; } sum;", 8},
+		{"let i = 0; while (true) { i = i + 1; if (i > 4) { break; } } i;", 5},
+		{"let f = fn() { for x in [1, 2, 3] { if (x == 2) { return x * 10; } } }; f();", 20},
+		{"let n = 0; for (;;) { n = n + 1; if (n == 3) { break } } n;", 3},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestArrays(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"[1, 2 * 2, 3][1]", 4},
+		{"let a = [1, 2, 3]; a[0] + a[2];", 4},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+
+	evaluated := testEval(`let out = ""; for c in "abc" { out = c + out; } out;`)
+	if evaluated.Inspect() != "cba" {
+		t.Errorf("expected=%s, got=%s", "cba", evaluated.Inspect())
+	}
+}
+
+func TestElseIfExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let x = 1; if (x == 0) { 10 } else if (x == 1) { 20 } else { 30 }", 20},
+		{"let x = 5; if (x == 0) { 10 } else if (x == 1) { 20 } else { 30 }", 30},
+		{"let x = 5; if (x == 0) { 10 } else if (x == 1) { 20 }", nil},
+		{"if (false) { 1 } else { 2 }; 3", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"one": 1, "two": 1 + 1, 3: true}`, `{one: 1, two: 2, 3: true}`},
+		{`{"a": 1}["a"]`, `1`},
+		{`{"a": 1}["b"]`, `null`},
+		{`{true: 5}[1 > 0]`, `5`},
+		{`{"a": 1}[fn(x) { x }]`, `ERROR: unusable as hash key: FUNCTION`},
+		{`let keys = ""; for k in {"a": 1, "b": 2} { keys = keys + k; } keys;`, `ab`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (2) { 1 => "one", 2 => "two", _ => "many" }`, `two`},
+		{`match (7) { 1 => "one", 2 => "two", _ => "many" }`, `many`},
+		{`match (-1) { -1 => "minus one", _ => "other" }`, `minus one`},
+		{`match ("b") { "a" => 1, "b" => 2 }`, `2`},
+		{`match (1 > 2) { true => "yes", false => "no" }`, `no`},
+		{`match ([1, 2]) { [a] => a, [a, b] => a + b }`, `3`},
+		{`match ([1, [2, 3]]) { [_, [x, 3]] => x }`, `2`},
+		{`match ({"name": "monkey", "age": 3}) { {"name": n} => n }`, `monkey`},
+		{`match ({"age": 3}) { {"name": n} => n, _ => "anonymous" }`, `anonymous`},
+		{`match (5) { 1 => 1 }`, `null`},
+		{`match (5) { n => { let doubled = n * 2; doubled } }`, `10`},
+		{`let n = 1; match (5) { n => n }; n`, `1`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestTryCatchFinally(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { throw "boom"; 1 } catch (e) { e["message"] }`, `boom`},
+		{`try { 1 } catch (e) { 2 }`, `1`},
+		{`try { missing } catch (e) { e["kind"] + ": " + e["message"] }`, `ReferenceError: identifier not found: missing`},
+		{`try { 1 + true } catch (e) { e["kind"] }`, `TypeError`},
+		{`try { 1 / 0 } catch (e) { e["kind"] + ": " + e["message"] }`, `RuntimeError: division by zero`},
+		{`try { throw {"message": "custom", "kind": "ValueError"} } catch (e) { e["kind"] }`, `ValueError`},
+		{`try { throw 42 } catch { "caught" }`, `caught`},
+		// the kinds a program cannot catch cannot be thrown either
+		{`try { throw {"message": "x", "kind": "InternalError"} } catch (e) { e["kind"] }`, `Error`},
+		{`try { throw {"message": "x", "kind": "CancelledError"} } catch (e) { e["kind"] }`, `Error`},
+		{`let log = ""; try { throw "x" } catch (e) { log = log + "c" } finally { log = log + "f" }; log`, `cf`},
+		{`let log = ""; try { log = "t" } finally { log = log + "f" }; log`, `tf`},
+		{`let f = fn() { try { return 1 } finally { 2 } }; f()`, `1`},
+		{`let f = fn() { try { return 1 } finally { return 2 } }; f()`, `2`},
+		{`let f = fn() { try { throw "x" } finally { return 3 } }; f()`, `3`},
+		{`let i = 0; while (true) { try { break } finally { i = i + 1 } }; i`, `1`},
+		{`try { throw "inner" } finally { 1 }`, `ERROR: inner`},
+		{`try { try { throw "a" } catch (e) { throw e } } catch (e) { e["message"] }`, `a`},
+		{`let f = fn() { throw "deep" }; let g = fn() { f() }; try { g() } catch (e) { e["stack"] }`, `[f (1:48), g (1:61)]`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestErrorStack(t *testing.T) {
+	input := `let f = fn() {
+	throw "boom"
+};
+let g = fn() { f() };
+g();`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if errObj.Kind != object.ThrownError {
+		t.Errorf("wrong error kind. expected=%s, got=%s", object.ThrownError, errObj.Kind)
+	}
+
+	expected := []string{"f (4:17)", "g (5:2)"}
+	if len(errObj.Stack) != len(expected) {
+		t.Fatalf("wrong stack. expected=%v, got=%v", expected, errObj.Stack)
+	}
+	for i, frame := range expected {
+		if errObj.Stack[i] != frame {
+			t.Errorf("wrong frame %d. expected=%q, got=%q", i, frame, errObj.Stack[i])
+		}
+	}
+}
+
+func TestFunctionDeclarations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn add(a, b) { a + b } add(2, 3)", "5"},
+		{"let r = add(1, 1); fn add(a, b) { a + b } r", "2"},
+		{`fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } }
+		  fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } }
+		  isEven(10)`, "true"},
+		{"let f = fn() { g() }; fn g() { 7 } f()", "7"},
+		{"fn outer() { let r = inner(); fn inner() { 9 } r } outer()", "9"},
+		{"fn add(a, b) { a + b } add", "fn add(a, b) {\n(a + b)\n}"},
+		{"let sq = fn(x) { x * x }; sq", "fn sq(x) {\n(x * x)\n}"},
+		{"fn add(a, b) { a + b } add(1)", "ERROR: wrong number of arguments to add: want=2, got=1"},
+		{"fn(a) { a }(1, 2)", "ERROR: wrong number of arguments to <anonymous>: want=1, got=2"},
+		{"let f = 1; fn f() { 2 }", "ERROR: identifier already declared: f"},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		evaluated := Eval(p.ParseProgram(), object.NewEnvironment())
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStackTraceNames(t *testing.T) {
+	input := `fn fail() { throw "x" }
+let run = fn(f) { f() };
+run(fail);`
+
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned")
+	}
+
+	expected := []string{"fail (2:20)", "run (3:4)"}
+	if len(errObj.Stack) != len(expected) {
+		t.Fatalf("wrong stack. expected=%v, got=%v", expected, errObj.Stack)
+	}
+	for i, frame := range expected {
+		if errObj.Stack[i] != frame {
+			t.Errorf("wrong frame %d. expected=%q, got=%q", i, frame, errObj.Stack[i])
+		}
+	}
+}
+
+// TestClosures pins down how closures see the variables around them:
+//   - variables are captured by reference, a closure sees later changes
+//     and its own assignments update the captured binding
+//   - closures created by the same call share their captured variables
+//   - every call creates fresh bindings, so separate calls never interfere
+//   - every loop iteration has its own bindings, including the variables of a
+//     C-style for loop, so closures created in a loop keep their iteration's values
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name: "counter",
+			input: `let make = fn() { let c = 0; fn() { c = c + 1; c } };
+			        let counter = make();
+			        counter(); counter(); counter();`,
+			expected: "3",
+		},
+		{
+			name: "independent counters",
+			input: `let make = fn() { let c = 0; fn() { c = c + 1; c } };
+			        let a = make(); let b = make();
+			        a(); a(); b();
+			        [a(), b()]`,
+			expected: "[3, 2]",
+		},
+		{
+			name: "shared captured variable",
+			input: `let make = fn() {
+			          let n = 0;
+			          [fn() { n = n + 1 }, fn() { n }]
+			        };
+			        let pair = make();
+			        pair[0](); pair[0]();
+			        pair[1]()`,
+			expected: "2",
+		},
+		{
+			name:     "sees later changes",
+			input:    `let x = 1; let get = fn() { x }; x = 5; get()`,
+			expected: "5",
+		},
+		{
+			name:     "assigns to global",
+			input:    `let total = 0; let add = fn(n) { total = total + n }; add(2); add(3); total`,
+			expected: "5",
+		},
+		{
+			name:     "parameter shadows captured variable",
+			input:    `let x = 1; let f = fn(x) { x = x + 10; x }; [f(1), x]`,
+			expected: "[11, 1]",
+		},
+		{
+			name: "for loop variable per iteration",
+			input: `let a = 0; let b = 0; let c = 0;
+			        for (let i = 0; i < 3; i = i + 1) {
+			          let f = fn() { i };
+			          if (i == 0) { a = f } else if (i == 1) { b = f } else { c = f }
+			        }
+			        [a(), b(), c()]`,
+			expected: "[0, 1, 2]",
+		},
+		{
+			name: "for in variable per iteration",
+			input: `let a = 0; let b = 0;
+			        for x in [10, 20] { if (x == 10) { a = fn() { x } } else { b = fn() { x } } }
+			        [a(), b()]`,
+			expected: "[10, 20]",
+		},
+		{
+			name: "while body bindings per iteration",
+			input: `let a = 0; let b = 0; let i = 0;
+			        while (i < 2) {
+			          let j = i;
+			          if (j == 0) { a = fn() { j } } else { b = fn() { j } }
+			          i = i + 1;
+			        }
+			        [a(), b()]`,
+			expected: "[0, 1]",
+		},
+		{
+			name: "closure mutates loop counter",
+			input: `let n = 0;
+			        for (let i = 0; i < 5; i = i + 1) { let bump = fn() { i = i + 1 }; bump(); n = n + 1; }
+			        n`,
+			expected: "3",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%s, got=%s", tt.name, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMemberExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let h = {"name": "monkey"}; h.name`, `monkey`},
+		{`let h = {"name": "monkey"}; h.age`, `null`},
+		{`let n = 5; n.value`, `ERROR: member access not supported: INTEGER.value`},
+		{`import "lib.monkey" as lib`, `ERROR: cannot import "lib.monkey": no module loader configured`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`len("")`, `0`},
+		{`len("héllo")`, `5`},
+		{`len([1, 2, 3])`, `3`},
+		{`len({"a": 1})`, `1`},
+		{`len(1)`, `ERROR: argument to len not supported: INTEGER`},
+		{`len("a", "b")`, `ERROR: wrong number of arguments to len: want=1, got=2`},
+		{`let a = [1]; let b = push(a, 2); [a, b]`, `[[1], [1, 2]]`},
+		{`push(1, 2)`, `ERROR: first argument to push must be ARRAY, got INTEGER`},
+		{`str(12) + str(true) + str("x")`, `12truex`},
+		{`let len = fn(x) { 0 }; len([1, 2])`, `0`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`assert(1 < 2)`, `null`},
+		{`assert(0)`, `null`},
+		{`assert(false)`, `ERROR: assert failed: false is not truthy`},
+		{`assert(if (false) { 1 }, "empty")`, `ERROR: empty: assert failed: null is not truthy`},
+		{`assert()`, `ERROR: wrong number of arguments to assert: want=1 or 2, got=0`},
+		{`assert_eq([1, {"a": 2}], [1, {"a": 2}])`, `null`},
+		{`assert_eq(1 + 1, 3)`, "ERROR: assert_eq failed\n--- expected\n+++ actual\n-3\n+2"},
+		{`assert_eq(1, "1", "kinds")`, "ERROR: kinds: assert_eq failed: expected STRING, got INTEGER\n--- expected\n+++ actual\n 1"},
+		{`assert_error(fn() { 1 + true })`, `unknown operator: INTEGER + BOOLEAN`},
+		{`assert_error(fn() { throw "boom" }, "oo")`, `boom`},
+		{`assert_error(fn() { throw "boom" }, "bang")`, `ERROR: assert_error failed: expected an error containing "bang", got "boom"`},
+		{`assert_error(fn() { 1 })`, `ERROR: assert_error failed: the function returned without an error`},
+		{`assert_error(1)`, `ERROR: first argument to assert_error must be FUNCTION, got INTEGER`},
+		{`try { assert(false) } catch (e) { e.kind }`, `AssertionError`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		expected string
+		actual   string
+		diff     string
+	}{
+		{"a", "a", " a"},
+		{"a\nb\nc", "a\nc\nd", " a\n-b\n c\n+d"},
+		{"", "x", "-\n+x"},
+	}
+
+	for _, tt := range tests {
+		if got := diff(tt.expected, tt.actual); got != "--- expected\n+++ actual\n"+tt.diff {
+			t.Errorf("diff(%q, %q): expected\n%s\ngot\n%s", tt.expected, tt.actual, tt.diff, got)
+		}
+	}
+}
+
+func TestOutputBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		output   string
+		expected string
+	}{
+		{`puts("hello")`, "hello\n", `null`},
+		{`puts(1, [true, "x"]); 2`, "1\n[true, x]\n", `2`},
+		{`puts()`, "", `null`},
+		{`print("a", 1); print("b")`, "a 1b", `null`},
+		{`fn log(x) { puts(x) } for x in [1, 2] { log(x) }`, "1\n2\n", `null`},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		env := object.NewEnvironment()
+		env.Runtime().Stdout = &out
+		evaluated := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+		if out.String() != tt.output {
+			t.Errorf("input %q: expected output %q, got %q", tt.input, tt.output, out.String())
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// without a writer the output is discarded
+	if evaluated := testEval(`puts("lost")`); evaluated != NullObj {
+		t.Errorf("expected null, got %s", evaluated.Inspect())
+	}
+}
+
+func TestStringOperations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a" == "a"`, `true`},
+		{`"a" != "a"`, `false`},
+		{`"a" == "b"`, `false`},
+		{`"héllo"[1]`, `é`},
+		{`"abc"[3]`, `null`},
+		{`"a" - "b"`, `ERROR: unknown operator: STRING - STRING`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	// without tail calls, a hundred thousand nested calls already take far
+	// more stack
+	defer debug.SetMaxStack(debug.SetMaxStack(16 << 20))
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn loop(n, acc) { if (n == 0) { acc } else { loop(n - 1, acc + 1) } } loop(1000000, 0)`, `1000000`},
+		{`fn count(n) { if (n == 0) { return "done" } return count(n - 1) } count(100000)`, `done`},
+		{`fn m(n) { match (n) { 0 => "zero", _ => m(n - 1) } } m(100000)`, `zero`},
+		{`fn w(n) { while (true) { return if (n == 0) { 0 } else { w(n - 1) } } } w(100000)`, `0`},
+		{`fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } }
+		  fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } }
+		  isEven(100001)`, `false`},
+		{`let f = fn(g) { g(1) }; f(fn(x) { len(str(x)) })`, `1`},
+		// calls that are not in tail position
+		{`fn sum(n) { if (n == 0) { 0 } else { n + sum(n - 1) } } sum(100)`, `5050`},
+		{`let log = ""; fn f() { log = log + "f" } fn g() { try { return f() } finally { log = log + "g" } } g(); log`, `fg`},
+		{`fn f() { throw "x" } fn g() { try { f() } catch (e) { "caught" } } g()`, `caught`},
+		{`fn f(a) { a } fn g() { f() } g()`, `ERROR: wrong number of arguments to f: want=1, got=0`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+// depth is a hook following the depth of the calls
+type depth struct{ calls, depth, max int }
+
+func (d *depth) Before(node ast.Node, env *object.Environment) *object.Error        { return nil }
+func (d *depth) After(node ast.Node, env *object.Environment, result object.Object) {}
+func (d *depth) Call(fn *object.Function, args []object.Object) {
+	d.calls++
+	d.depth++
+	d.max = max(d.max, d.depth)
+}
+func (d *depth) Return(fn *object.Function, result object.Object) { d.depth-- }
+
+// nesting is a depth hook that needs tail calls nested in their caller
+type nesting struct{ depth }
+
+func (n *nesting) NestTailCalls() bool { return true }
+
+func TestTailCallsWithHook(t *testing.T) {
+	input := `fn loop(n) { if (n == 0) { "done" } else { loop(n - 1) } } loop(100)`
+	plain, nested := &depth{}, &nesting{}
+	tests := []struct {
+		hook     object.Hook
+		depth    *depth
+		expected int
+	}{
+		// a hook sees every call, one after the other
+		{plain, plain, 1},
+		// unless it needs them nested
+		{nested, &nested.depth, 101},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.Runtime().Hook = tt.hook
+		if evaluated := Eval(parser.New(lexer.New(input)).ParseProgram(), env); evaluated.Inspect() != "done" {
+			t.Fatalf("%T: expected done, got %s", tt.hook, evaluated.Inspect())
+		}
+		if tt.depth.calls != 101 || tt.depth.max != tt.expected || tt.depth.depth != 0 {
+			t.Errorf("%T: expected 101 calls at most %d deep, got %+v", tt.hook, tt.expected, tt.depth)
+		}
+	}
+}
+
+func TestCallDepth(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn f(n) { 1 + f(n + 1) } f(0)`, "ERROR: maximum call depth of 10000 exceeded"},
+		{`fn f(n) { 1 + f(n + 1) } try { f(0) } catch (e) { e.message }`, "maximum call depth of 10000 exceeded"},
+		{`fn f(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } } f(9999)`, "9999"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		evaluated := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+		if env.Runtime().Depth != 0 {
+			t.Errorf("input %q: the depth is %d after the run", tt.input, env.Runtime().Depth)
+		}
+	}
+}
+
+func TestEvalWithHook(t *testing.T) {
+	tests := []string{
+		`fn f() { 1 } f()`,
+		`fn f() { throw "failed" } f()`,
+		`fn f() { boom() } f()`,
+	}
+
+	for _, input := range tests {
+		env := object.NewEnvironment()
+		env.Set("boom", &object.Builtin{Name: "boom", Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			panic("boom")
+		}})
+		outer, hook := &depth{}, &depth{}
+		env.Runtime().Hook = outer
+		EvalWithHook(parser.New(lexer.New(input)).ParseProgram(), env, hook)
+		if hook.calls != 1 || outer.calls != 0 {
+			t.Errorf("input %q: expected the call to be seen by the hook only, got %+v and %+v", input, hook, outer)
+		}
+		// the hook is reset however the evaluation ends
+		if env.Runtime().Hook != outer {
+			t.Errorf("input %q: the hook is still set after the evaluation", input)
+		}
+
+		f, _ := env.Get("f")
+		ApplyWithHook(f, nil, env, hook)
+		if hook.calls != 2 || outer.calls != 0 || env.Runtime().Hook != outer {
+			t.Errorf("input %q: expected Apply to run under the hook only, got %+v and %+v", input, hook, outer)
+		}
+	}
+}
+
+func TestInternalErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		stack    string
+	}{
+		{`boom()`, `INTERNAL ERROR: boom (1:1)`, ``},
+		{`let f = fn() { 1 + boom() }; f()`, `INTERNAL ERROR: boom (1:20)`, `f (1:31)`},
+		// programs cannot catch them
+		{`try { boom() } catch (e) { 1 }`, `INTERNAL ERROR: boom (1:7)`, ``},
+		{`assert_error(fn() { boom() })`, `INTERNAL ERROR: boom (1:21)`, ``},
+		// the tree of a program that failed to parse has nil nodes
+		{`-`, `INTERNAL ERROR: runtime error: invalid memory address or nil pointer dereference (1:1)`, ``},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.Set("boom", &object.Builtin{Name: "boom", Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			panic("boom")
+		}})
+		evaluated := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok || errObj.Kind != object.InternalError {
+			t.Errorf("input %q: expected an internal error, got %#v", tt.input, evaluated)
+			continue
+		}
+		if errObj.Inspect() != tt.expected || strings.Join(errObj.Stack, ", ") != tt.stack {
+			t.Errorf("input %q: expected %q at %q, got %q at %q", tt.input, tt.expected, tt.stack, errObj.Inspect(), errObj.Stack)
+		}
+	}
+
+	boom := &object.Builtin{Name: "boom", Fn: func(env *object.Environment, args ...object.Object) object.Object {
+		return args[0]
+	}}
+	evaluated := Apply(boom, nil, object.NewEnvironment())
+	if evaluated.Inspect() != "INTERNAL ERROR: runtime error: index out of range [0] with length 0" {
+		t.Errorf("expected Apply to recover, got %s", evaluated.Inspect())
+	}
+}
+
+// budget is a hook stopping the evaluation once it has evaluated steps nodes
+type budget struct{ steps int }
+
+func (b *budget) Before(node ast.Node, env *object.Environment) *object.Error {
+	if b.steps--; b.steps < 0 {
+		return newError(object.CancelledError, "out of steps")
+	}
+	return nil
+}
+func (b *budget) After(node ast.Node, env *object.Environment, result object.Object) {}
+func (b *budget) Call(fn *object.Function, args []object.Object)                     {}
+func (b *budget) Return(fn *object.Function, result object.Object)                   {}
+
+// FuzzEval checks that the evaluator never panics, whatever the program it
+// runs. Every program is stopped after a number of steps, so that loops and
+// recursions end.
+func FuzzEval(f *testing.F) {
+	for _, seed := range []string{
+		"1 / 0",
+		"let f = fn(a, b) { a + b }; f(1)",
+		"len(); push([1]); str(); assert(); assert_eq(1); assert_error()",
+		"fn f(n) { f(n + 1) } f(0)",
+		"while (true) {}",
+		"try { [1][5] } catch (e) { {}[fn() {}] } finally { -true }",
+		"match ([1, 2]) { [a, b] => a / (b - 2), _ => 0 }",
+		`import "x" as x; x.y`,
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return
+		}
+		env := object.NewEnvironment()
+		env.Runtime().Hook = &budget{steps: 10000}
+		// Eval recovers from panics, which come back as internal errors
+		if err, ok := Eval(program, env).(*object.Error); ok && err.Kind == object.InternalError {
+			t.Fatalf("%q panics: %s", input, err.Message)
+		}
+	})
+}
@@ -0,0 +1,502 @@
+// Package format prints Monkey programs in a canonical layout: one statement
+// per line, blocks indented with tabs, single spaces around binary operators
+// and parentheses only where precedence requires them. Comments are kept, and
+// so are single blank lines between statements.
+package format
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"sort"
+	"strings"
+)
+
+// Source formats a Monkey program. It fails if the program does not parse.
+func Source(src string) (string, error) {
+	l := lexer.New(src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if errors := p.PositionedErrors(); len(errors) != 0 {
+		return "", fmt.Errorf("%d:%d: %s", errors[0].Line, errors[0].Column, errors[0].Message)
+	}
+
+	pr := &printer{comments: l.Comments(), tokens: tokens(src)}
+	pr.statements(program.Statements, false)
+	pr.flushComments(ast.Position{Line: len(src) + 1})
+	return pr.out.String(), nil
+}
+
+// tokens returns the tokens of src, comments left out
+func tokens(src string) []token.Token {
+	l := lexer.New(src)
+	tokens := []token.Token{}
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		tokens = append(tokens, tok)
+	}
+	return tokens
+}
+
+// the precedences of the parser, from the loosest to the tightest
+const (
+	_ int = iota
+	lowest
+	equals
+	lessGreater
+	sum
+	product
+	prefix
+	call
+	atom
+)
+
+var precedences = map[string]int{
+	"==": equals,
+	"!=": equals,
+	"<":  lessGreater,
+	">":  lessGreater,
+	"+":  sum,
+	"-":  sum,
+	"*":  product,
+	"/":  product,
+}
+
+type printer struct {
+	out    strings.Builder
+	indent int
+	// comments are the comments of the source not printed yet
+	comments []token.Token
+	// tokens are the tokens of the source, to find where statements end
+	tokens []token.Token
+	// line is the last line of the source that was printed, to keep the
+	// blank lines that follow it. It is 0 at the start of a block.
+	line int
+	// lineStart is set after a newline, the indentation is written along
+	// with the first text of the line so that blank lines stay empty
+	lineStart bool
+}
+
+func (p *printer) write(s string) {
+	if p.lineStart {
+		p.out.WriteString(strings.Repeat("\t", p.indent))
+		p.lineStart = false
+	}
+	p.out.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.out.WriteString("\n")
+	p.lineStart = true
+}
+
+// flushComments prints the comments written before pos on lines of their own
+func (p *printer) flushComments(pos ast.Position) {
+	for len(p.comments) > 0 && before(p.comments[0], pos) {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+		p.blankLine(c.Line)
+		p.write(c.Literal)
+		p.newline()
+		p.line = c.Line
+	}
+}
+
+// blankLine prints a blank line when the source has one between the last
+// line printed and line
+func (p *printer) blankLine(line int) {
+	if p.line > 0 && line > p.line+1 {
+		p.newline()
+	}
+}
+
+func before(c token.Token, pos ast.Position) bool {
+	return c.Line < pos.Line || (c.Line == pos.Line && c.Column < pos.Column)
+}
+
+// statements prints the statements of a program or of a block, each on a
+// line of its own. The last statement of a block is its value, it is not
+// followed by a semicolon.
+func (p *printer) statements(statements []ast.Statement, block bool) {
+	for i, stmt := range statements {
+		span := ast.SpanOf(stmt)
+		p.flushComments(span.Start)
+		p.blankLine(span.Start.Line)
+
+		p.statement(stmt, block && i == len(statements)-1)
+		p.line = p.endLine(span)
+
+		// the comments on the lines of the statement follow it
+		for len(p.comments) > 0 && p.comments[0].Line <= p.line {
+			p.write(" " + p.comments[0].Literal)
+			p.comments = p.comments[1:]
+		}
+		if i < len(statements)-1 || !block {
+			p.newline()
+		}
+	}
+}
+
+// endLine returns the line the statement covering span ends on in the
+// source. The span stops at the last token stored in the tree, so the
+// closing delimiters and the semicolon after it are found in the tokens.
+func (p *printer) endLine(span ast.Span) int {
+	i := sort.Search(len(p.tokens), func(i int) bool { return !before(p.tokens[i], span.Start) })
+	open := 0
+	for ; i < len(p.tokens) && before(p.tokens[i], span.End); i++ {
+		open += nesting(p.tokens[i].Type)
+	}
+	line := span.End.Line
+	for ; i < len(p.tokens) && open > 0; i++ {
+		open += nesting(p.tokens[i].Type)
+		line = p.tokens[i].Line
+	}
+	if i < len(p.tokens) && p.tokens[i].Type == token.SEMICOLON {
+		line = p.tokens[i].Line
+	}
+	return line
+}
+
+// nesting returns 1 for the tokens opening a group, -1 for those closing one
+func nesting(t token.Type) int {
+	switch t {
+	case token.LPAREN, token.LBRACKET, token.LBRACE:
+		return 1
+	case token.RPAREN, token.RBRACKET, token.RBRACE:
+		return -1
+	}
+	return 0
+}
+
+// statement prints a statement. last is set for the value of a block.
+func (p *printer) statement(stmt ast.Statement, last bool) {
+	switch node := stmt.(type) {
+	case *ast.LetStatement, *ast.ConstStatement, *ast.AssignStatement:
+		p.simpleStatement(node)
+		p.write(";")
+
+	case *ast.ReturnStatement:
+		p.write("return")
+		if node.Value != nil {
+			p.write(" ")
+			p.expression(node.Value, lowest)
+		}
+		p.write(";")
+
+	case *ast.ThrowStatement:
+		p.write("throw ")
+		p.expression(node.Value, lowest)
+		p.write(";")
+
+	case *ast.BreakStatement:
+		p.write("break;")
+
+	case *ast.ContinueStatement:
+		p.write("continue;")
+
+	case *ast.ExpressionStatement:
+		p.expression(node.Expression, lowest)
+		switch node.Expression.(type) {
+		case *ast.IfExpression, *ast.MatchExpression:
+		default:
+			if !last {
+				p.write(";")
+			}
+		}
+
+	case *ast.FunctionStatement:
+		p.write("fn " + node.Name.Value)
+		p.signature(node.Function)
+		p.write(" ")
+		p.block(node.Function.Body)
+
+	case *ast.WhileStatement:
+		p.write("while (")
+		p.expression(node.Condition, lowest)
+		p.write(") ")
+		p.block(node.Consequence)
+
+	case *ast.ForStatement:
+		p.write("for (")
+		if node.Init != nil {
+			p.simpleStatement(node.Init)
+		}
+		p.write(";")
+		if node.Condition != nil {
+			p.write(" ")
+			p.expression(node.Condition, lowest)
+		}
+		p.write(";")
+		if node.Post != nil {
+			p.write(" ")
+			p.simpleStatement(node.Post)
+		}
+		p.write(") ")
+		p.block(node.Body)
+
+	case *ast.ForInStatement:
+		p.write("for " + node.Variable.Value + " in ")
+		p.expression(node.Iterable, lowest)
+		p.write(" ")
+		p.block(node.Body)
+
+	case *ast.TryStatement:
+		p.write("try ")
+		p.block(node.Block)
+		if node.Catch != nil {
+			p.write(" catch ")
+			if node.Parameter != nil {
+				p.write("(" + node.Parameter.Value + ") ")
+			}
+			p.block(node.Catch)
+		}
+		if node.Finally != nil {
+			p.write(" finally ")
+			p.block(node.Finally)
+		}
+
+	case *ast.ImportStatement:
+		if node.Alias != nil {
+			p.write(`import "` + node.Path + `" as ` + node.Alias.Value + ";")
+			return
+		}
+		names := []string{}
+		for _, name := range node.Names {
+			names = append(names, name.Value)
+		}
+		p.write("import { " + strings.Join(names, ", ") + ` } from "` + node.Path + `";`)
+
+	case *ast.ExportStatement:
+		p.write("export ")
+		p.statement(node.Statement, false)
+	}
+}
+
+// simpleStatement prints the statements allowed in the header of a for loop,
+// without their semicolon
+func (p *printer) simpleStatement(stmt ast.Statement) {
+	switch node := stmt.(type) {
+	case *ast.LetStatement:
+		p.write("let " + declaration(node.Name) + " = ")
+		p.expression(node.Value, lowest)
+	case *ast.ConstStatement:
+		p.write("const " + declaration(node.Name) + " = ")
+		p.expression(node.Value, lowest)
+	case *ast.AssignStatement:
+		p.write(node.Name.Value + " = ")
+		p.expression(node.Value, lowest)
+	case *ast.ExpressionStatement:
+		p.expression(node.Expression, lowest)
+	}
+}
+
+func declaration(ident *ast.Identifier) string {
+	if ident.Type != nil {
+		return ident.Value + ": " + ident.Type.String()
+	}
+	return ident.Value
+}
+
+func (p *printer) signature(fn *ast.FunctionLiteral) {
+	params := []string{}
+	for _, param := range fn.Parameters {
+		params = append(params, declaration(param))
+	}
+	p.write("(" + strings.Join(params, ", ") + ")")
+	if fn.ReturnType != nil {
+		p.write(": " + fn.ReturnType.String())
+	}
+}
+
+// block prints a block in braces. A block written on a single line stays on
+// one when its content fits on it.
+func (p *printer) block(block *ast.BlockStatement) {
+	if line, ok := p.singleLine(block); ok {
+		p.write(line)
+		return
+	}
+
+	p.write("{")
+	p.indent++
+	p.newline()
+	p.line = 0
+	p.statements(block.Statements, true)
+	p.flushTrailingComments(block)
+	p.indent--
+	p.newline()
+	p.write("}")
+	p.line = block.End.Line
+}
+
+// flushTrailingComments prints the comments between the last statement of
+// a block and its closing brace
+func (p *printer) flushTrailingComments(block *ast.BlockStatement) {
+	end := ast.Position{Line: block.End.Line, Column: block.End.Column}
+	for len(p.comments) > 0 && before(p.comments[0], end) {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+		if len(block.Statements) > 0 || p.line > 0 {
+			p.newline()
+		}
+		p.blankLine(c.Line)
+		p.write(c.Literal)
+		p.line = c.Line
+	}
+}
+
+// singleLine returns block printed on one line, if it was written on one
+// line with at most one statement and no comment
+func (p *printer) singleLine(block *ast.BlockStatement) (string, bool) {
+	if block.End.Line != block.Token.Line || len(block.Statements) > 1 {
+		return "", false
+	}
+	end := ast.Position{Line: block.End.Line, Column: block.End.Column}
+	if len(p.comments) > 0 && before(p.comments[0], end) {
+		return "", false
+	}
+	if len(block.Statements) == 0 {
+		return "{}", true
+	}
+
+	inner := &printer{}
+	inner.statement(block.Statements[0], true)
+	if strings.Contains(inner.out.String(), "\n") {
+		return "", false
+	}
+	return "{ " + inner.out.String() + " }", true
+}
+
+func precedence(expression ast.Expression) int {
+	switch node := expression.(type) {
+	case *ast.InfixExpression:
+		return precedences[node.Operator]
+	case *ast.PrefixExpression:
+		return prefix
+	case *ast.CallExpression, *ast.IndexExpression, *ast.MemberExpression:
+		// postfix operators apply to any postfix expression before them
+		return call
+	}
+	return atom
+}
+
+// expression prints an expression that is an operand of an operator of
+// precedence outer, in parentheses when it binds looser than that operator
+func (p *printer) expression(expression ast.Expression, outer int) {
+	if precedence(expression) < outer {
+		p.write("(")
+		defer p.write(")")
+	}
+
+	switch node := expression.(type) {
+	case *ast.Identifier:
+		p.write(node.Value)
+
+	case *ast.IntegerLiteral:
+		p.write(node.Token.Literal)
+
+	case *ast.StringLiteral:
+		p.write(`"` + node.Value + `"`)
+
+	case *ast.Boolean:
+		p.write(node.Token.Literal)
+
+	case *ast.PrefixExpression:
+		p.write(node.Operator)
+		p.expression(node.Right, prefix)
+
+	case *ast.InfixExpression:
+		// operators are left associative, so the right operand needs
+		// parentheses even at the same precedence
+		op := precedences[node.Operator]
+		p.expression(node.Left, op)
+		p.write(" " + node.Operator + " ")
+		p.expression(node.Right, op+1)
+
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(node.Condition, lowest)
+		p.write(") ")
+		p.block(node.Consequence)
+		if node.Alternative == nil {
+			return
+		}
+		p.write(" else ")
+		// else if is parsed as an else block holding only the if
+		if node.Alternative.Token.Type == token.IF {
+			p.expression(node.Alternative.Statements[0].(*ast.ExpressionStatement).Expression, lowest)
+			return
+		}
+		p.block(node.Alternative)
+
+	case *ast.FunctionLiteral:
+		p.write("fn")
+		p.signature(node)
+		p.write(" ")
+		p.block(node.Body)
+
+	case *ast.CallExpression:
+		p.expression(node.Function, call)
+		p.write("(")
+		p.list(node.Arguments)
+		p.write(")")
+
+	case *ast.ArrayLiteral:
+		p.write("[")
+		p.list(node.Elements)
+		p.write("]")
+
+	case *ast.IndexExpression:
+		p.expression(node.Left, call)
+		p.write("[")
+		p.expression(node.Index, lowest)
+		p.write("]")
+
+	case *ast.MemberExpression:
+		p.expression(node.Object, call)
+		p.write("." + node.Property.Value)
+
+	case *ast.HashLiteral:
+		p.write("{")
+		for i, pair := range node.Pairs {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(pair.Key, lowest)
+			p.write(": ")
+			p.expression(pair.Value, lowest)
+		}
+		p.write("}")
+
+	case *ast.MatchExpression:
+		p.write("match (")
+		p.expression(node.Subject, lowest)
+		p.write(") {")
+		p.indent++
+		for _, arm := range node.Arms {
+			p.newline()
+			p.expression(arm.Pattern, lowest)
+			p.write(" => ")
+			// an arm is either a block or an expression, which the parser
+			// wraps in a block of its own
+			if arm.Body.Token.Type == token.LBRACE {
+				p.block(arm.Body)
+			} else {
+				p.expression(arm.Body.Statements[0].(*ast.ExpressionStatement).Expression, lowest)
+			}
+			p.write(",")
+		}
+		p.indent--
+		p.newline()
+		p.write("}")
+	}
+}
+
+func (p *printer) list(expressions []ast.Expression) {
+	for i, e := range expressions {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.expression(e, lowest)
+	}
+}
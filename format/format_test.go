@@ -0,0 +1,103 @@
+package format
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/stdlib"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let   x=1+2*3 ;", "let x = 1 + 2 * 3;\n"},
+		{"(1 + 2) * 3; 1 - (2 - 3); (1 - 2) - 3; -(a + b); (-a)[0]; -a[0]", "(1 + 2) * 3;\n1 - (2 - 3);\n1 - 2 - 3;\n-(a + b);\n(-a)[0];\n-a[0];\n"},
+		{`m.f(1,2)[0].x; {"a":[1,2],true:fn(x){x}}`, "m.f(1, 2)[0].x;\n{\"a\": [1, 2], true: fn(x) { x }};\n"},
+		{"fn add(a: int, b): [int] { a }", "fn add(a: int, b): [int] { a }\n"},
+		{"fn f(a) {\nlet b = a;\n    b\n}", "fn f(a) {\n\tlet b = a;\n\tb\n}\n"},
+		{"fn f() { let a = 1; a }", "fn f() {\n\tlet a = 1;\n\ta\n}\n"},
+		{"if (x) { 1 }\nelse if (y) { 2 } else { 3 }", "if (x) { 1 } else if (y) { 2 } else { 3 }\n"},
+		{"for (let i=0;i<3;i=i+1) { puts(i); }\nfor (;;) { break; }", "for (let i = 0; i < 3; i = i + 1) { puts(i) }\nfor (;;) { break; }\n"},
+		{"for x in xs {\nputs(x);\ncontinue;\n}", "for x in xs {\n\tputs(x);\n\tcontinue;\n}\n"},
+		{"while (true) {}", "while (true) {}\n"},
+		{"try { throw \"x\" } catch { 1 }\ntry { 1 } catch (e) { e } finally { 2 }", "try { throw \"x\"; } catch { 1 }\ntry { 1 } catch (e) { e } finally { 2 }\n"},
+		{"match (x) { 1 => \"one\", [a, -1] => { a }, {\"k\": v} => v, _ => null }",
+			"match (x) {\n\t1 => \"one\",\n\t[a, -1] => { a },\n\t{\"k\": v} => v,\n\t_ => null,\n}\n"},
+		{"import \"std/math\" as math\nimport {a,b} from \"./lib\"\nexport const c = 1", "import \"std/math\" as math;\nimport { a, b } from \"./lib\";\nexport const c = 1;\n"},
+
+		// comments and blank lines
+		{"// a\n\n\n// b\nlet x = 1; // c\nx", "// a\n\n// b\nlet x = 1; // c\nx;\n"},
+		{"fn f() {\n\n  // first\n  let a = 1;\n\n\n  a // value\n  // last\n}\n// end", "fn f() {\n\t// first\n\tlet a = 1;\n\n\ta // value\n\t// last\n}\n// end\n"},
+		{"fn f() { // why\n  1\n}", "fn f() {\n\t// why\n\t1\n}\n"},
+		{"fn f() {\n  // nothing\n}", "fn f() {\n\t// nothing\n}\n"},
+		{"", ""},
+
+		// statements spread over lines end with their closing delimiter
+		{"let h = {\n  \"a\": 1,\n  \"b\": 2\n}; // h\nh", "let h = {\"a\": 1, \"b\": 2}; // h\nh;\n"},
+		{"f(\n  1,\n  2\n) // call\nf", "f(1, 2); // call\nf;\n"},
+		{"let xs = [\n  1\n]\nxs", "let xs = [1];\nxs;\n"},
+		{"match (x) { 1 => 2, _ => 3 }\nx", "match (x) {\n\t1 => 2,\n\t_ => 3,\n}\nx;\n"},
+		{"fn f(x) {\n  match (x) {\n    _ => 1,\n  } // all\n}", "fn f(x) {\n\tmatch (x) {\n\t\t_ => 1,\n\t} // all\n}\n"},
+	}
+
+	for _, tt := range tests {
+		got, err := Source(tt.input)
+		if err != nil {
+			t.Errorf("input %q: %v", tt.input, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("input %q:\nexpected %q\ngot      %q", tt.input, tt.expected, got)
+			continue
+		}
+		checkFormatted(t, tt.input, got)
+	}
+}
+
+// checkFormatted checks that formatting output again leaves it unchanged,
+// and that it parses to the same program as input
+func checkFormatted(t *testing.T, input, output string) {
+	t.Helper()
+	again, err := Source(output)
+	if err != nil || again != output {
+		t.Errorf("formatting %q again: got %q, %v", output, again, err)
+	}
+	if parse(t, input) != parse(t, output) {
+		t.Errorf("input %q: the formatted program differs:\n%s\n%s", input, parse(t, input), parse(t, output))
+	}
+}
+
+func parse(t *testing.T, input string) string {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("input %q: parser errors %v", input, p.Errors())
+	}
+	return program.String()
+}
+
+func TestStdlibIsFormatted(t *testing.T) {
+	for _, path := range []string{"std/math", "std/strings", "std/functional"} {
+		source, err := stdlib.Resolver{}.Read(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Source(source)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if got != source {
+			t.Errorf("%s is not formatted:\n%s", path, got)
+		}
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	_, err := Source("let x = ;")
+	if err == nil || err.Error() != "1:9: no prefix parse function for ; found" {
+		t.Errorf("expected a syntax error, got %v", err)
+	}
+}
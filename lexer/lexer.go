@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"monkey/token"
+	"strings"
 )
 
 type Lexer struct {
@@ -9,6 +10,9 @@ type Lexer struct {
 	currPosition int // currPosition is the current position of the char
 	nextPosition int // nextPosition is used to query the char and store it in the char field and is incremented by 1
 	char         byte
+	line         int // line is the 1-based line of char
+	column       int // column is the 1-based column of char
+	comments     []token.Token
 }
 
 func New(input string) *Lexer {
@@ -17,6 +21,8 @@ func New(input string) *Lexer {
 		currPosition: 0,
 		nextPosition: 0,
 		char:         0,
+		line:         1,
+		column:       0,
 	}
 	l.readChar()
 	return l
@@ -27,6 +33,8 @@ func (l *Lexer) NextToken() token.Token {
 	l.skipWhitespace()
 
 	var tok token.Token
+	tok.Line = l.line
+	tok.Column = l.column
 	switch l.char {
 	case '=':
 		nextChar := l.peekChar()
@@ -34,6 +42,10 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Literal = string(nextChar) + string(l.char)
 			tok.Type = token.EQ
 			l.readChar()
+		} else if nextChar == '>' {
+			tok.Literal = string(l.char) + string(nextChar)
+			tok.Type = token.ARROW
+			l.readChar()
 		} else {
 			tok.Literal = string(l.char)
 			tok.Type = token.ASSIGN
@@ -52,6 +64,14 @@ func (l *Lexer) NextToken() token.Token {
 		tok.Literal = string(l.char)
 		tok.Type = token.SEMICOLON
 
+	case '.':
+		tok.Literal = string(l.char)
+		tok.Type = token.DOT
+
+	case ':':
+		tok.Literal = string(l.char)
+		tok.Type = token.COLON
+
 	case '>':
 		tok.Literal = string(l.char)
 		tok.Type = token.GT
@@ -96,13 +116,26 @@ func (l *Lexer) NextToken() token.Token {
 		tok.Literal = string(l.char)
 		tok.Type = token.RBRACE
 
+	case '[':
+		tok.Literal = string(l.char)
+		tok.Type = token.LBRACKET
+
+	case ']':
+		tok.Literal = string(l.char)
+		tok.Type = token.RBRACKET
+
 	case 0:
 		tok.Literal = string(l.char)
 		tok.Type = token.EOF
 
 	case '"':
-		tok.Literal = l.readString()
+		literal, terminated := l.readString()
+		tok.Literal = literal
 		tok.Type = token.STRING
+		if !terminated {
+			tok.Literal = `"` + literal
+			tok.Type = token.ILLEGAL
+		}
 
 
 	default:
@@ -130,17 +163,42 @@ func (l *Lexer) NextToken() token.Token {
 
 }
 
-// skipWhitespace removes all sorts of whitespaces such as spaces, new lines, tabs and carriage return
+// Comments returns the comments skipped so far, in order. They are not
+// tokens of the grammar, but tools such as formatters keep them.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
+// skipWhitespace removes all sorts of whitespaces such as spaces, new lines, tabs and carriage return,
+// along with comments which run from // to the end of the line
 func (l *Lexer) skipWhitespace() {
-	for l.char == '\n' || l.char == '\t' || l.char == '\r' || l.char == ' ' {
-		l.readChar()
+	for {
+		switch {
+		case l.char == '\n' || l.char == '\t' || l.char == '\r' || l.char == ' ':
+			l.readChar()
+		case l.char == '/' && l.peekChar() == '/':
+			comment := token.Token{Type: token.COMMENT, Line: l.line, Column: l.column}
+			position := l.currPosition
+			for l.char != '\n' && l.char != 0 {
+				l.readChar()
+			}
+			comment.Literal = strings.TrimRight(l.input[position:l.currPosition], " \t\r")
+			l.comments = append(l.comments, comment)
+		default:
+			return
+		}
 	}
-
 }
 
 // readChar reads a character and advances Lexer positions.
 // Reads Lexer.char, increments Lexer.currPosition, and Lexer.nextPosition.
+// Lexer.line and Lexer.column follow the character that was read.
 func (l *Lexer) readChar() {
+	if l.char == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
 	if l.nextPosition >= len(l.input) {
 		l.char = 0
 	} else {
@@ -150,13 +208,18 @@ func (l *Lexer) readChar() {
 	l.nextPosition += 1
 }
 
-func (l *Lexer) readString() string {
+// readString reads a string literal up to its closing quote, and reports
+// whether there is one before the end of the input
+func (l *Lexer) readString() (string, bool) {
 	position := l.currPosition + 1
 	l.readChar()
 	for l.char != '"' {
+		if l.char == 0 && l.currPosition >= len(l.input) {
+			return l.input[position:], false
+		}
 		l.readChar()
 	}
-	return l.input[position: l.currPosition]
+	return l.input[position:l.currPosition], true
 }
 
 // peekChar peeks the next char from the input
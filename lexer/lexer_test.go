@@ -75,6 +75,51 @@ func TestLexer(t *testing.T) {
 				newToken(token.ILLEGAL, "%"),
 			},
 		},
+		{
+			input: "for x in [1, 2] { break; continue; }",
+			output: []token.Token{
+				newToken(token.FOR, "for"),
+				newToken(token.IDENT, "x"),
+				newToken(token.IN, "in"),
+				newToken(token.LBRACKET, "["),
+				newToken(token.INT, "1"),
+				newToken(token.COMMA, ","),
+				newToken(token.INT, "2"),
+				newToken(token.RBRACKET, "]"),
+				newToken(token.LBRACE, "{"),
+				newToken(token.BREAK, "break"),
+				newToken(token.SEMICOLON, ";"),
+				newToken(token.CONTINUE, "continue"),
+				newToken(token.SEMICOLON, ";"),
+				newToken(token.RBRACE, "}"),
+			},
+		},
+		{
+			input: `match (x) { {"a": 1} => true }`,
+			output: []token.Token{
+				newToken(token.MATCH, "match"),
+				newToken(token.LPAREN, "("),
+				newToken(token.IDENT, "x"),
+				newToken(token.RPAREN, ")"),
+				newToken(token.LBRACE, "{"),
+				newToken(token.LBRACE, "{"),
+				newToken(token.STRING, "a"),
+				newToken(token.COLON, ":"),
+				newToken(token.INT, "1"),
+				newToken(token.RBRACE, "}"),
+				newToken(token.ARROW, "=>"),
+				newToken(token.TRUE, "true"),
+				newToken(token.RBRACE, "}"),
+			},
+		},
+		{
+			input: "// a comment\nx / y // trailing\n// last",
+			output: []token.Token{
+				newToken(token.IDENT, "x"),
+				newToken(token.SLASH, "/"),
+				newToken(token.IDENT, "y"),
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -103,3 +148,109 @@ func TestLexer(t *testing.T) {
 func newToken(tokenType token.Type, literal string) token.Token {
 	return token.Token{Type: tokenType, Literal: literal}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x + \"ab\"\n"
+
+	expected := []struct {
+		literal string
+		line    int
+		column  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"x", 2, 3},
+		{"+", 2, 5},
+		{"ab", 2, 7},
+	}
+
+	l := New(input)
+	for _, e := range expected {
+		tok := l.NextToken()
+		if tok.Literal != e.literal {
+			t.Fatalf("wrong literal. expected=%q, got=%q", e.literal, tok.Literal)
+		}
+		if tok.Line != e.line || tok.Column != e.column {
+			t.Errorf("token %q: wrong position. expected=%d:%d, got=%d:%d", tok.Literal, e.line, e.column, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestUnterminatedString(t *testing.T) {
+	expected := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "s"},
+		{token.ASSIGN, "="},
+		{token.ILLEGAL, "\"abc;"},
+		{token.EOF, "\x00"},
+	}
+
+	l := New(`let s = "abc;`)
+	for i, e := range expected {
+		tok := l.NextToken()
+		if tok.Type != e.expectedType || tok.Literal != e.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %s %q, got %s %q", i, e.expectedType, e.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "// header\nlet x = 1; // one  \n\n  // indented\nx"
+	l := New(input)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+	}
+
+	expected := []token.Token{
+		{Type: token.COMMENT, Literal: "// header", Line: 1, Column: 1},
+		{Type: token.COMMENT, Literal: "// one", Line: 2, Column: 12},
+		{Type: token.COMMENT, Literal: "// indented", Line: 4, Column: 3},
+	}
+	comments := l.Comments()
+	if len(comments) != len(expected) {
+		t.Fatalf("expected %d comments, got %v", len(expected), comments)
+	}
+	for i, e := range expected {
+		if comments[i] != e {
+			t.Errorf("comment %d: expected %+v, got %+v", i, e, comments[i])
+		}
+	}
+}
+
+// FuzzNextToken checks that the lexer always reaches the end of its input,
+// reading at most a token per byte of it, and never goes back
+func FuzzNextToken(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		`"abc`,
+		`"`,
+		"// comment",
+		"let x = 5 == 6 != 7;",
+		"a => b",
+		"@#$",
+		"0x1f",
+		"fn add(a, b) {\n\t// sum\n\ta + b\n}\nadd(1, \"two\")",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		l := New(input)
+		last := token.Token{Line: 1}
+		for i := 0; i <= len(input); i++ {
+			tok := l.NextToken()
+			if tok.Line < last.Line || tok.Line == last.Line && tok.Column < last.Column {
+				t.Fatalf("token %d of %q goes back from %+v to %+v", i, input, last, tok)
+			}
+			if tok.Type == token.EOF {
+				return
+			}
+			last = tok
+		}
+		t.Fatalf("no EOF after %d tokens of %q", len(input)+1, input)
+	})
+}
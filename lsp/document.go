@@ -0,0 +1,162 @@
+package lsp
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/resolver"
+	"monkey/types"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Document is a source file and what the analysis of its text found out
+// about it. The server analyses a document again on every change.
+type Document struct {
+	uri   string
+	lines []string
+
+	program     *ast.Program
+	parseErrors []parser.Error
+	index       *resolver.Index
+	diagnostics []resolver.Diagnostic
+	// types is nil when the program does not parse, its inferred types would
+	// be misleading
+	types *types.Result
+}
+
+// NewDocument analyses text, the content of the document at uri
+func NewDocument(uri, text string) *Document {
+	d := &Document{uri: uri, lines: strings.Split(text, "\n")}
+
+	p := parser.New(lexer.New(text))
+	d.program = p.ParseProgram()
+	d.parseErrors = p.PositionedErrors()
+	// the index of a program that does not parse still serves completion
+	// and navigation while the user is typing
+	d.index, d.diagnostics = resolver.Analyze(d.program, nil)
+	if len(d.parseErrors) == 0 {
+		d.types = types.Check(d.program)
+	}
+	return d
+}
+
+// toLSP converts a 1-based line and byte column to a protocol position
+func (d *Document) toLSP(pos ast.Position) Position {
+	line := pos.Line - 1
+	if line < 0 || line >= len(d.lines) {
+		return Position{Line: max(line, 0)}
+	}
+	text := d.lines[line]
+	column := min(max(pos.Column-1, 0), len(text))
+	return Position{Line: line, Character: utf16Length(text[:column])}
+}
+
+// fromLSP converts a protocol position to a 1-based line and byte column
+func (d *Document) fromLSP(pos Position) ast.Position {
+	if pos.Line < 0 || pos.Line >= len(d.lines) {
+		return ast.Position{Line: pos.Line + 1, Column: 1}
+	}
+	text := d.lines[pos.Line]
+	units := 0
+	for i, r := range text {
+		if units >= pos.Character {
+			return ast.Position{Line: pos.Line + 1, Column: i + 1}
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return ast.Position{Line: pos.Line + 1, Column: len(text) + 1}
+}
+
+// PositionAt converts an offset in the text, counted in UTF-16 code units
+// like the indexes of JavaScript strings, to a position
+func (d *Document) PositionAt(offset int) Position {
+	for line, text := range d.lines {
+		length := utf16Length(text)
+		if offset <= length || line == len(d.lines)-1 {
+			return Position{Line: line, Character: min(max(offset, 0), length)}
+		}
+		offset -= length + 1 // the newline
+	}
+	return Position{}
+}
+
+// OffsetAt converts a position to an offset in the text, counted in UTF-16
+// code units
+func (d *Document) OffsetAt(pos Position) int {
+	offset := 0
+	for line := 0; line < pos.Line && line < len(d.lines); line++ {
+		offset += utf16Length(d.lines[line]) + 1
+	}
+	return offset + pos.Character
+}
+
+func utf16Length(s string) int {
+	n := 0
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return n
+}
+
+// rangeOf returns the range of the source a node was parsed from
+func (d *Document) rangeOf(node ast.Node) Range {
+	span := ast.SpanOf(node)
+	return Range{Start: d.toLSP(span.Start), End: d.toLSP(span.End)}
+}
+
+// rangeAt returns the range of the word starting at the 1-based position
+// line:column, or of a single character when there is none
+func (d *Document) rangeAt(line, column int) Range {
+	start := ast.Position{Line: line, Column: column}
+	end := ast.Position{Line: line, Column: column + 1}
+	if line >= 1 && line <= len(d.lines) {
+		text := d.lines[line-1]
+		i := column - 1
+		for i < len(text) && isLetter(text[i]) {
+			i++
+		}
+		if i > column-1 {
+			end.Column = i + 1
+		}
+	}
+	return Range{Start: d.toLSP(start), End: d.toLSP(end)}
+}
+
+// identifierAt returns the identifier at pos that declares or refers to a
+// binding
+func (d *Document) identifierAt(pos ast.Position) (*ast.Identifier, *resolver.Binding) {
+	for _, b := range d.index.Bindings() {
+		if covers(b.Name, pos) {
+			return b.Name, b
+		}
+		for _, ref := range b.References {
+			if covers(ref, pos) {
+				return ref, b
+			}
+		}
+	}
+	return nil, nil
+}
+
+// covers reports whether pos is within ident, or right after it where the
+// cursor is when the user has just typed it
+func covers(ident *ast.Identifier, pos ast.Position) bool {
+	tok := ident.Token
+	return tok.Line == pos.Line && tok.Column <= pos.Column && pos.Column <= tok.Column+len(tok.Literal)
+}
+
+// typeOf returns the inferred type of the name b declares, or nil
+func (d *Document) typeOf(b *resolver.Binding) types.Type {
+	if d.types == nil {
+		return nil
+	}
+	return d.types.Declarations[b.Name]
+}
+
+func isLetter(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch == '_'
+}
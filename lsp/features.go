@@ -0,0 +1,259 @@
+package lsp
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/resolver"
+	"monkey/token"
+	"monkey/types"
+)
+
+// Diagnostics returns the problems of the document. When it does not parse
+// only the syntax errors are reported, the rest of the analysis of a broken
+// tree is noise.
+func (d *Document) Diagnostics() []Diagnostic {
+	diagnostics := []Diagnostic{}
+	for _, err := range d.parseErrors {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    d.rangeAt(err.Line, err.Column),
+			Severity: SeverityError,
+			Source:   "parser",
+			Message:  err.Message,
+		})
+	}
+	if len(d.parseErrors) != 0 {
+		return diagnostics
+	}
+
+	for _, diag := range d.diagnostics {
+		severity := SeverityWarning
+		if diag.Severity == resolver.Error {
+			severity = SeverityError
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    d.rangeAt(diag.Line, diag.Column),
+			Severity: severity,
+			Source:   "resolver",
+			Message:  diag.Message,
+		})
+	}
+	for _, err := range d.types.Errors {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    Range{Start: d.toLSP(err.Span.Start), End: d.toLSP(err.Span.End)},
+			Severity: SeverityError,
+			Source:   "types",
+			Message:  err.Message,
+		})
+	}
+	return diagnostics
+}
+
+// Hover describes the binding at pos: the signature of a function, or the
+// kind and type of any other name
+func (d *Document) Hover(pos Position) *Hover {
+	ident, b := d.identifierAt(d.fromLSP(pos))
+	if b == nil {
+		return nil
+	}
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```monkey\n" + d.describe(b) + "\n```"},
+		Range:    d.rangeOf(ident),
+	}
+}
+
+// describe returns the declaration of b as it would be written with a type
+// annotation, such as let x: int or fn add(a: int, b: int): int
+func (d *Document) describe(b *resolver.Binding) string {
+	name := b.Name.Value
+	t := d.typeOf(b)
+	if fn := function(b); fn != nil {
+		params := []string{}
+		for _, param := range fn.Parameters {
+			params = append(params, param.Value)
+		}
+		return types.Signature(name, params, t)
+	}
+
+	description := b.Kind + " " + name
+	switch b.Kind {
+	case "variable":
+		description = "let " + name
+	case "constant":
+		description = "const " + name
+	}
+	if t != nil {
+		description += ": " + t.String()
+	}
+	return description
+}
+
+// function returns the function literal b is bound to, if any
+func function(b *resolver.Binding) *ast.FunctionLiteral {
+	switch node := b.Node.(type) {
+	case *ast.FunctionStatement:
+		return node.Function
+	case *ast.LetStatement:
+		fn, _ := node.Value.(*ast.FunctionLiteral)
+		return fn
+	case *ast.ConstStatement:
+		fn, _ := node.Value.(*ast.FunctionLiteral)
+		return fn
+	}
+	return nil
+}
+
+// Definition returns where the name at pos is declared
+func (d *Document) Definition(pos Position) *Location {
+	_, b := d.identifierAt(d.fromLSP(pos))
+	if b == nil {
+		return nil
+	}
+	return &Location{URI: d.uri, Range: d.rangeOf(b.Name)}
+}
+
+// Rename returns the edits that rename the binding at pos and every
+// reference to it
+func (d *Document) Rename(pos Position, newName string) (*WorkspaceEdit, error) {
+	if !isIdentifier(newName) {
+		return nil, fmt.Errorf("%q is not a valid identifier", newName)
+	}
+	_, b := d.identifierAt(d.fromLSP(pos))
+	if b == nil {
+		return nil, fmt.Errorf("there is no variable to rename here")
+	}
+
+	edits := []TextEdit{{Range: d.rangeOf(b.Name), NewText: newName}}
+	for _, ref := range b.References {
+		edits = append(edits, TextEdit{Range: d.rangeOf(ref), NewText: newName})
+	}
+	return &WorkspaceEdit{Changes: map[string][]TextEdit{d.uri: edits}}, nil
+}
+
+func isIdentifier(name string) bool {
+	if name == "" || token.LookupIdent(name) != token.IDENT {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isLetter(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Completion returns the names that can be written at pos: the variables in
+// scope there, the builtins and the keywords
+func (d *Document) Completion(pos Position) []CompletionItem {
+	at := d.fromLSP(pos)
+	// members of a module are not known statically
+	if line := at.Line - 1; line >= 0 && line < len(d.lines) {
+		text := d.lines[line][:min(at.Column-1, len(d.lines[line]))]
+		for len(text) > 0 && isLetter(text[len(text)-1]) {
+			text = text[:len(text)-1]
+		}
+		if len(text) > 0 && text[len(text)-1] == '.' {
+			return []CompletionItem{}
+		}
+	}
+
+	items := []CompletionItem{}
+	seen := map[string]bool{}
+	for _, b := range d.index.Visible(at) {
+		seen[b.Name.Value] = true
+		items = append(items, CompletionItem{Label: b.Name.Value, Kind: completionKind(b), Detail: d.describe(b)})
+	}
+	for _, name := range evaluator.Builtins() {
+		if !seen[name] {
+			items = append(items, CompletionItem{Label: name, Kind: CompletionFunction, Detail: "builtin"})
+		}
+	}
+	for _, keyword := range token.Keywords() {
+		items = append(items, CompletionItem{Label: keyword, Kind: CompletionKeyword})
+	}
+	return items
+}
+
+func completionKind(b *resolver.Binding) CompletionItemKind {
+	switch {
+	case function(b) != nil:
+		return CompletionFunction
+	case b.Kind == "constant":
+		return CompletionConstant
+	case b.Kind == "module":
+		return CompletionModule
+	}
+	return CompletionVariable
+}
+
+// Symbols returns the declarations of the document, with the declarations
+// inside a function nested in its symbol
+func (d *Document) Symbols() []DocumentSymbol {
+	return d.symbolsOf(d.program.Statements)
+}
+
+func (d *Document) symbolsOf(statements []ast.Statement) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	for _, statement := range statements {
+		symbols = append(symbols, d.statementSymbols(statement)...)
+	}
+	return symbols
+}
+
+func (d *Document) statementSymbols(statement ast.Statement) []DocumentSymbol {
+	switch node := statement.(type) {
+	case *ast.LetStatement:
+		return []DocumentSymbol{d.symbol(node, node.Name, SymbolVariable, node.Value)}
+	case *ast.ConstStatement:
+		return []DocumentSymbol{d.symbol(node, node.Name, SymbolConstant, node.Value)}
+	case *ast.FunctionStatement:
+		return []DocumentSymbol{d.symbol(node, node.Name, SymbolFunction, node.Function)}
+	case *ast.ExportStatement:
+		return d.statementSymbols(node.Statement)
+	case *ast.ImportStatement:
+		if node.Alias != nil {
+			return []DocumentSymbol{d.symbol(node, node.Alias, SymbolModule, nil)}
+		}
+	case *ast.ExpressionStatement:
+		if ifExpression, ok := node.Expression.(*ast.IfExpression); ok {
+			return append(d.blockSymbols(ifExpression.Consequence), d.blockSymbols(ifExpression.Alternative)...)
+		}
+	case *ast.WhileStatement:
+		return d.blockSymbols(node.Consequence)
+	case *ast.ForStatement:
+		return d.blockSymbols(node.Body)
+	case *ast.ForInStatement:
+		return d.blockSymbols(node.Body)
+	case *ast.TryStatement:
+		symbols := d.blockSymbols(node.Block)
+		symbols = append(symbols, d.blockSymbols(node.Catch)...)
+		return append(symbols, d.blockSymbols(node.Finally)...)
+	}
+	return nil
+}
+
+func (d *Document) blockSymbols(block *ast.BlockStatement) []DocumentSymbol {
+	if block == nil {
+		return nil
+	}
+	return d.symbolsOf(block.Statements)
+}
+
+// symbol describes the declaration of name by node. A function value gets
+// the declarations of its body as children.
+func (d *Document) symbol(node ast.Node, name *ast.Identifier, kind SymbolKind, value ast.Expression) DocumentSymbol {
+	symbol := DocumentSymbol{
+		Name:           name.Value,
+		Kind:           kind,
+		Range:          d.rangeOf(node),
+		SelectionRange: d.rangeOf(name),
+	}
+	if b, ok := d.index.Lookup(name); ok {
+		symbol.Detail = d.describe(b)
+	}
+	if fn, ok := value.(*ast.FunctionLiteral); ok && fn != nil {
+		symbol.Kind = SymbolFunction
+		symbol.Children = d.blockSymbols(fn.Body)
+	}
+	return symbol
+}
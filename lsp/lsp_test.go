@@ -0,0 +1,370 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const uri = "file:///main.monkey"
+
+const source = `let limit = 10;
+fn add(a, b) { a + b }
+let total = add(1, limit);
+let greet = fn(name) {
+  let message = "hi " + name;
+  message
+};
+undefined_name;
+`
+
+// session sends requests to a server and returns the messages it wrote
+type session struct {
+	input bytes.Buffer
+	id    int
+}
+
+func (s *session) send(method string, params any) {
+	msg := map[string]any{"jsonrpc": "2.0", "method": method, "params": params}
+	if !strings.HasPrefix(method, "textDocument/did") && method != "initialized" && method != "exit" {
+		s.id++
+		msg["id"] = s.id
+	}
+	body, _ := json.Marshal(msg)
+	fmt.Fprintf(&s.input, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+type reply struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+func (s *session) run(t *testing.T) []reply {
+	t.Helper()
+	var out bytes.Buffer
+	if err := Serve(&s.input, &out); err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+
+	replies := []reply{}
+	reader := bufio.NewReader(&out)
+	for {
+		header, err := textproto.NewReader(reader).ReadMIMEHeader()
+		if err == io.EOF {
+			return replies
+		}
+		if err != nil {
+			t.Fatalf("invalid header: %v", err)
+		}
+		length, _ := strconv.Atoi(header.Get("Content-Length"))
+		body := make([]byte, length)
+		io.ReadFull(reader, body)
+
+		var r reply
+		if err := json.Unmarshal(body, &r); err != nil {
+			t.Fatalf("invalid message %s: %v", body, err)
+		}
+		replies = append(replies, r)
+	}
+}
+
+func open(text string) *session {
+	s := &session{}
+	s.send("initialize", map[string]any{"capabilities": map[string]any{}})
+	s.send("initialized", map[string]any{})
+	s.send("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uri, "languageId": "monkey", "version": 1, "text": text},
+	})
+	return s
+}
+
+func at(line, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     map[string]any{"line": line, "character": character},
+	}
+}
+
+// result runs a session ending with one request and decodes its result
+func result(t *testing.T, s *session, v any) {
+	t.Helper()
+	id := s.id
+	s.send("exit", nil)
+	for _, r := range s.run(t) {
+		if r.ID != nil && *r.ID == id {
+			if r.Error != nil {
+				t.Fatalf("request failed: %s", r.Error.Message)
+			}
+			if err := json.Unmarshal(r.Result, v); err != nil {
+				t.Fatalf("invalid result %s: %v", r.Result, err)
+			}
+			return
+		}
+	}
+	t.Fatalf("no response to request %d", id)
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{source, []string{
+			"7:0-7:14 error resolver: undefined identifier undefined_name",
+		}},
+		{"let x = ;", []string{
+			"0:8-0:9 error parser: no prefix parse function for ; found",
+		}},
+		{"let s = \"abc", []string{
+			"0:8-0:9 error parser: no prefix parse function for ILLEGAL found",
+		}},
+		{"fn f() { let unused = 1; 1 + \"a\" }", []string{
+			"0:13-0:19 warning resolver: unused variable unused",
+			"0:25-0:32 error types: operator + not defined on int and string",
+		}},
+	}
+
+	for _, tt := range tests {
+		s := open(tt.input)
+		s.send("exit", nil)
+		replies := s.run(t)
+
+		var params publishDiagnosticsParams
+		for _, r := range replies {
+			if r.Method == "textDocument/publishDiagnostics" {
+				json.Unmarshal(r.Params, &params)
+			}
+		}
+		if params.URI != uri {
+			t.Fatalf("input %q: no diagnostics published", tt.input)
+		}
+
+		got := []string{}
+		for _, d := range params.Diagnostics {
+			severity := "error"
+			if d.Severity == SeverityWarning {
+				severity = "warning"
+			}
+			got = append(got, fmt.Sprintf("%d:%d-%d:%d %s %s: %s", d.Range.Start.Line, d.Range.Start.Character,
+				d.Range.End.Line, d.Range.End.Character, severity, d.Source, d.Message))
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("input %q:\nexpected %q\ngot      %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestHover(t *testing.T) {
+	tests := []struct {
+		line, character int
+		expected        string
+	}{
+		{0, 5, "let limit: int"},
+		{2, 22, "let limit: int"},
+		{1, 4, "fn add(a: a, b: a): a"},
+		{2, 13, "fn add(a: a, b: a): a"},
+		{1, 16, "parameter a: a"},
+		{3, 6, "fn greet(name: string): string"},
+		{4, 9, "let message: string"},
+		{2, 17, ""},
+		{7, 3, ""},
+	}
+
+	for _, tt := range tests {
+		s := open(source)
+		s.send("textDocument/hover", at(tt.line, tt.character))
+		var hover *Hover
+		result(t, s, &hover)
+
+		got := ""
+		if hover != nil {
+			got = strings.TrimSuffix(strings.TrimPrefix(hover.Contents.Value, "```monkey\n"), "\n```")
+		}
+		if got != tt.expected {
+			t.Errorf("hover at %d:%d: expected %q, got %q", tt.line, tt.character, tt.expected, got)
+		}
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	tests := []struct {
+		line, character int
+		expected        *Range
+	}{
+		{2, 23, &Range{Start: Position{0, 4}, End: Position{0, 9}}},
+		{1, 16, &Range{Start: Position{1, 7}, End: Position{1, 8}}},
+		{2, 13, &Range{Start: Position{1, 3}, End: Position{1, 6}}},
+		{5, 3, &Range{Start: Position{4, 6}, End: Position{4, 13}}},
+		{7, 3, nil},
+	}
+
+	for _, tt := range tests {
+		s := open(source)
+		s.send("textDocument/definition", at(tt.line, tt.character))
+		var location *Location
+		result(t, s, &location)
+
+		if tt.expected == nil {
+			if location != nil {
+				t.Errorf("definition at %d:%d: expected none, got %+v", tt.line, tt.character, location)
+			}
+			continue
+		}
+		if location == nil || location.URI != uri || location.Range != *tt.expected {
+			t.Errorf("definition at %d:%d: expected %+v, got %+v", tt.line, tt.character, tt.expected, location)
+		}
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	s := open(source)
+	s.send("textDocument/documentSymbol", map[string]any{"textDocument": map[string]any{"uri": uri}})
+	var symbols []DocumentSymbol
+	result(t, s, &symbols)
+
+	var describe func(symbols []DocumentSymbol) string
+	describe = func(symbols []DocumentSymbol) string {
+		names := []string{}
+		for _, symbol := range symbols {
+			name := fmt.Sprintf("%s(%d)", symbol.Name, symbol.Kind)
+			if len(symbol.Children) > 0 {
+				name += "[" + describe(symbol.Children) + "]"
+			}
+			names = append(names, name)
+		}
+		return strings.Join(names, " ")
+	}
+
+	expected := "limit(13) add(12) total(13) greet(12)[message(13)]"
+	if got := describe(symbols); got != expected {
+		t.Errorf("expected symbols %q, got %q", expected, got)
+	}
+	if symbols[1].Range != (Range{Start: Position{1, 0}, End: Position{1, 22}}) {
+		t.Errorf("wrong range of add: %+v", symbols[1].Range)
+	}
+}
+
+func TestRename(t *testing.T) {
+	s := open(source)
+	s.send("textDocument/rename", map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     map[string]any{"line": 0, "character": 6},
+		"newName":      "max",
+	})
+	var edit WorkspaceEdit
+	result(t, s, &edit)
+
+	edits := edit.Changes[uri]
+	expected := []Range{
+		{Start: Position{0, 4}, End: Position{0, 9}},
+		{Start: Position{2, 19}, End: Position{2, 24}},
+	}
+	if len(edits) != len(expected) {
+		t.Fatalf("expected %d edits, got %+v", len(expected), edits)
+	}
+	for i, e := range edits {
+		if e.Range != expected[i] || e.NewText != "max" {
+			t.Errorf("edit %d: expected %+v, got %+v", i, expected[i], e)
+		}
+	}
+
+	for _, name := range []string{"let", "two words", "x1", ""} {
+		s := open(source)
+		s.send("textDocument/rename", map[string]any{
+			"textDocument": map[string]any{"uri": uri},
+			"position":     map[string]any{"line": 0, "character": 6},
+			"newName":      name,
+		})
+		s.send("exit", nil)
+		for _, r := range s.run(t) {
+			if r.ID != nil && *r.ID == s.id && r.Error == nil {
+				t.Errorf("renaming to %q: expected an error", name)
+			}
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	tests := []struct {
+		line, character int
+		included        []string
+		excluded        []string
+	}{
+		// inside greet, after message is declared
+		{5, 2, []string{"message", "name", "greet", "add", "limit", "total", "len", "fn", "while"}, nil},
+		// in the body of add, message is not in scope
+		{1, 15, []string{"a", "b", "add", "greet"}, []string{"message"}},
+		// at the top of the program, later variables are not declared yet
+		{0, 0, []string{"add", "puts"}, []string{"total", "limit"}},
+	}
+
+	for _, tt := range tests {
+		s := open(source)
+		s.send("textDocument/completion", at(tt.line, tt.character))
+		var items []CompletionItem
+		result(t, s, &items)
+
+		labels := map[string]bool{}
+		for _, item := range items {
+			labels[item.Label] = true
+		}
+		for _, name := range tt.included {
+			if !labels[name] {
+				t.Errorf("completion at %d:%d: %s is missing", tt.line, tt.character, name)
+			}
+		}
+		for _, name := range tt.excluded {
+			if labels[name] {
+				t.Errorf("completion at %d:%d: %s is not in scope", tt.line, tt.character, name)
+			}
+		}
+	}
+}
+
+// TestIncompleteSource analyses every prefix of a program, as the server
+// sees it while it is typed, and queries every position of it
+func TestIncompleteSource(t *testing.T) {
+	text := source + `for x in [1, 2] { if (x > 1) { puts("a" } }
+match (total) { [a, b] => a, _ => 0 }
+try { throw "x" } catch (e) { e.message } finally { 1 }
+while (true) { break; }
+import "std/math" as math; math.`
+
+	for i := 0; i <= len(text); i++ {
+		d := NewDocument(uri, text[:i])
+		d.Diagnostics()
+		d.Symbols()
+		for line := range d.lines {
+			for character := 0; character <= len(d.lines[line]); character++ {
+				pos := Position{Line: line, Character: character}
+				d.Hover(pos)
+				d.Definition(pos)
+				d.Completion(pos)
+			}
+		}
+	}
+}
+
+func TestUnknownMethod(t *testing.T) {
+	s := open(source)
+	s.send("textDocument/formatting", map[string]any{})
+	s.send("exit", nil)
+	for _, r := range s.run(t) {
+		if r.ID != nil && *r.ID == s.id {
+			if r.Error == nil || r.Error.Code != codeMethodNotFound {
+				t.Errorf("expected method not found, got %+v", r)
+			}
+			return
+		}
+	}
+	t.Errorf("no response")
+}
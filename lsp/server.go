@@ -0,0 +1,236 @@
+// Package lsp implements a Language Server Protocol server for Monkey, so
+// that any editor with an LSP client gets diagnostics, hover, go to
+// definition, document symbols, rename and completion.
+//
+// Documents are synchronized in full on every change and analysed with the
+// parser, the resolver and the type checker.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// Serve answers the requests read from in, writing the responses and the
+// diagnostics to out, until the client sends the exit notification or in
+// is closed
+func Serve(in io.Reader, out io.Writer) error {
+	s := &server{
+		reader:    bufio.NewReader(in),
+		out:       out,
+		documents: map[string]*Document{},
+	}
+	for {
+		msg, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg == nil {
+			continue
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+type server struct {
+	reader    *bufio.Reader
+	out       io.Writer
+	documents map[string]*Document
+}
+
+// read reads the next message. A message that is not valid JSON is answered
+// with an error right away and read returns nil.
+func (s *server) read() (*message, error) {
+	header, err := textproto.NewReader(s.reader).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, body); err != nil {
+		return nil, err
+	}
+
+	msg := &message{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, s.reply(nil, nil, &responseError{Code: codeParseError, Message: err.Error()})
+	}
+	return msg, nil
+}
+
+func (s *server) write(v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (s *server) reply(id *json.RawMessage, result any, err *responseError) error {
+	return s.write(response{JSONRPC: "2.0", ID: id, Result: result, Error: err})
+}
+
+func (s *server) notify(method string, params any) error {
+	return s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// handle answers a request, or acts on a notification, which has no id
+func (s *server) handle(msg *message) error {
+	if msg.ID == nil {
+		return s.handleNotification(msg)
+	}
+
+	result, err := s.handleRequest(msg)
+	if err != nil {
+		return s.reply(msg.ID, nil, err)
+	}
+	return s.reply(msg.ID, result, nil)
+}
+
+func (s *server) handleNotification(msg *message) error {
+	switch msg.Method {
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil
+		}
+		return s.update(params.TextDocument.URI, params.TextDocument.Text)
+
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil || len(params.ContentChanges) == 0 {
+			return nil
+		}
+		// the server asks for full synchronization, so the last change
+		// holds the whole text
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		return s.update(params.TextDocument.URI, text)
+
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+	}
+	// other notifications, such as initialized, need no answer
+	return nil
+}
+
+// update analyses the new text of a document and publishes its diagnostics
+func (s *server) update(uri, text string) error {
+	d := NewDocument(uri, text)
+	s.documents[uri] = d
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: d.Diagnostics(),
+	})
+}
+
+func (s *server) handleRequest(msg *message) (any, *responseError) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":       1, // full
+				"hoverProvider":          true,
+				"definitionProvider":     true,
+				"documentSymbolProvider": true,
+				"renameProvider":         true,
+				"completionProvider":     map[string]any{},
+			},
+			"serverInfo": map[string]any{"name": "monkey"},
+		}, nil
+
+	case "shutdown":
+		return nil, nil
+
+	case "textDocument/hover":
+		d, params, err := s.position(msg)
+		if err != nil {
+			return nil, err
+		}
+		// a nil result is encoded as null, which means there is nothing to show
+		return d.Hover(params.Position), nil
+
+	case "textDocument/definition":
+		d, params, err := s.position(msg)
+		if err != nil {
+			return nil, err
+		}
+		return d.Definition(params.Position), nil
+
+	case "textDocument/completion":
+		d, params, err := s.position(msg)
+		if err != nil {
+			return nil, err
+		}
+		return d.Completion(params.Position), nil
+
+	case "textDocument/documentSymbol":
+		var params documentSymbolParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		d, err := s.document(params.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		return d.Symbols(), nil
+
+	case "textDocument/rename":
+		var params renameParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		d, err := s.document(params.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		edit, renameErr := d.Rename(params.Position, params.NewName)
+		if renameErr != nil {
+			return nil, &responseError{Code: codeInvalidParams, Message: renameErr.Error()}
+		}
+		return edit, nil
+	}
+
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+}
+
+func (s *server) document(uri string) (*Document, *responseError) {
+	d, ok := s.documents[uri]
+	if !ok {
+		return nil, &responseError{Code: codeInvalidRequest, Message: "document is not open: " + uri}
+	}
+	return d, nil
+}
+
+// position decodes the parameters of a request about a position in a document
+func (s *server) position(msg *message) (*Document, textDocumentPositionParams, *responseError) {
+	var params textDocumentPositionParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return nil, params, &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	d, err := s.document(params.TextDocument.URI)
+	return d, params, err
+}
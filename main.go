@@ -4,60 +4,134 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"io"
 	"monkey/evaluator"
 	"monkey/lexer"
+	"monkey/module"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/resolver"
+	"monkey/stdlib"
+	"monkey/types"
 	"strings"
 	"syscall/js"
 )
 
-const defaultOuput = "No Result. Code executed successfully."
-
 func main() {
 	ch := make(chan bool)
 	js.Global().Set("interpret", js.FuncOf(func(this js.Value, args []js.Value) any {
-		if len(args) != 1 {
+		if len(args) != 1 && len(args) != 2 {
 			return js.ValueOf("err: wrong data")
 		}
-		result, isError := run(args[0].String())
+
+		// the optional second argument maps module paths to their source
+		modules := module.MapResolver{}
+		if len(args) == 2 {
+			modules = modulesFromJS(args[1])
+		}
+
+		var stdout, stderr strings.Builder
+		result, isError := run(context.Background(), args[0].String(), modules, &stdout, &stderr)
+		if isError {
+			stderr.WriteString(result + "\n")
+			result = ""
+		}
 
 		response := map[string]any{
 			"result":   result,
+			"stdout":   stdout.String(),
+			"stderr":   stderr.String(),
 			"is_error": isError,
 		}
 		return js.ValueOf(response)
 	}))
 
-	js.Global().Set("getAST", js.FuncOf(func(this js.Value, args []js.Value) any {
+	js.Global().Set("interpretAsync", js.FuncOf(interpretAsync))
+
+	js.Global().Set("getAST", js.FuncOf(func(this js.Value, args []js.Value) (response any) {
+		defer recoverResponse(&response)
 		if len(args) != 1 {
 			return js.ValueOf("err: wrong data")
 		}
 		result, isError := getAST(args[0].String())
 
-		response := map[string]any{
+		return js.ValueOf(map[string]any{
 			"result":   result,
 			"is_error": isError,
+		})
+	}))
+
+	js.Global().Set("typecheck", js.FuncOf(func(this js.Value, args []js.Value) (response any) {
+		defer recoverResponse(&response)
+		if len(args) != 1 {
+			return js.ValueOf("err: wrong data")
 		}
-		return js.ValueOf(response)
+		result, isError := typecheck(args[0].String())
+
+		return js.ValueOf(map[string]any{
+			"result":   result,
+			"is_error": isError,
+		})
 	}))
 
+	registerEditorFunctions()
+
 	<-ch
 
 }
 
+// modulesFromJS reads an object mapping module paths to their source
+func modulesFromJS(value js.Value) module.MapResolver {
+	modules := module.MapResolver{}
+	if value.Type() != js.TypeObject {
+		return modules
+	}
+	keys := js.Global().Get("Object").Call("keys", value)
+	for i := 0; i < keys.Length(); i++ {
+		path := keys.Index(i).String()
+		modules[path] = value.Get(path).String()
+	}
+	return modules
+}
+
+// recoverResponse turns a panic of a js.FuncOf callback into the response
+// {result, is_error} of an internal error rather than ending the instance.
+// It must be deferred with the named result of the callback.
+func recoverResponse(response *any) {
+	if r := recover(); r != nil {
+		*response = js.ValueOf(map[string]any{"result": printPanic(r), "is_error": true})
+	}
+}
+
 // run returns result and whether error occurred after
-// lexing -> parsing -> evaluation
-func run(code string) (string, bool) {
+// lexing -> parsing -> evaluation. The output of the program is written
+// to stdout and stderr, evaluation stops with an error once ctx is done.
+// A panic is returned as an internal error, as run also serves
+// interpretAsync on a goroutine of its own.
+func run(ctx context.Context, code string, modules module.MapResolver, stdout, stderr io.Writer) (result string, isError bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, isError = printPanic(r), true
+		}
+	}()
+
 	l := lexer.New(code)
 	p := parser.New(l)
 	program := p.ParseProgram()
 	env := object.NewEnvironment()
+	env.Runtime().Loader = module.NewLoader(stdlib.Resolver{Next: modules})
+	env.Runtime().Stdout = stdout
+	env.Runtime().Stderr = stderr
+	env.Runtime().Context = ctx
 
 	if len(p.Errors()) != 0 {
 		return printParserErrors(p.Errors()), true
 	}
+	if errors := resolver.Errors(resolver.Resolve(program, nil)); len(errors) != 0 {
+		return printResolverErrors(errors), true
+	}
 
 	evaluated := evaluator.Eval(program, env)
 
@@ -65,8 +139,8 @@ func run(code string) (string, bool) {
 		return defaultOuput, false
 	}
 
-	if _, ok := evaluated.(*object.Error); ok {
-		return evaluated.Inspect(), true
+	if errObj, ok := evaluated.(*object.Error); ok {
+		return printRuntimeError(errObj), true
 	}
 
 	return evaluated.Inspect(), false
@@ -89,13 +163,22 @@ func getAST(code string) (string, bool) {
 
 }
 
-func printParserErrors(errors []string) string {
+// typecheck returns the type errors of code as a JSON array of objects with
+// the span and the message of each error
+func typecheck(code string) (string, bool) {
+	p := parser.New(lexer.New(code))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return printParserErrors(p.Errors()), true
+	}
 
-	out := strings.Builder{}
-	out.WriteString("Woops! We ran into some monkey business here!\n")
-	out.WriteString(" parser errors:\n")
-	for _, msg := range errors {
-		out.WriteString("\t" + msg + "\n")
+	errors := types.Check(program).Errors
+	if errors == nil {
+		errors = []types.Error{}
 	}
-	return out.String()
+	bytes, err := json.Marshal(errors)
+	if err != nil {
+		return err.Error(), true
+	}
+	return string(bytes), false
 }
@@ -0,0 +1,87 @@
+package module
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/resolver"
+	"strings"
+)
+
+// Loader loads and evaluates imported modules. Every module is evaluated at
+// most once, later imports of the same module share its exports.
+// Loader implements object.ModuleLoader.
+type Loader struct {
+	resolver Resolver
+	modules  map[string]*object.Module
+	loading  []string // loading is the chain of modules being evaluated, used to report cycles
+}
+
+func NewLoader(resolver Resolver) *Loader {
+	return &Loader{
+		resolver: resolver,
+		modules:  map[string]*object.Module{},
+	}
+}
+
+func (l *Loader) Load(importPath string, env *object.Environment) (*object.Module, error) {
+	resolved, err := l.resolver.Resolve(importPath, env.Module())
+	if err != nil {
+		return nil, err
+	}
+
+	if module, ok := l.modules[resolved]; ok {
+		return module, nil
+	}
+
+	for i, loading := range l.loading {
+		if loading == resolved {
+			cycle := append(append([]string{}, l.loading[i:]...), resolved)
+			return nil, fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	source, err := l.resolver.Read(resolved)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("cannot parse module %s: %s", resolved, strings.Join(p.Errors(), "; "))
+	}
+	if errors := resolver.Errors(resolver.Resolve(program, nil)); len(errors) != 0 {
+		return nil, fmt.Errorf("cannot resolve module %s: %s", resolved, strings.Join(errors, "; "))
+	}
+
+	l.loading = append(l.loading, resolved)
+	defer func() { l.loading = l.loading[:len(l.loading)-1] }()
+
+	moduleEnv := object.NewModuleEnvironment(env, resolved)
+	if errObj, ok := evaluator.Eval(program, moduleEnv).(*object.Error); ok {
+		return nil, &object.ModuleError{Path: resolved, Err: errObj}
+	}
+
+	module := &object.Module{Path: resolved, Exports: exports(program, moduleEnv)}
+	l.modules[resolved] = module
+	return module, nil
+}
+
+// exports collects the values of the names exported by program
+func exports(program *ast.Program, env *object.Environment) map[string]object.Object {
+	values := map[string]object.Object{}
+	for _, statement := range program.Statements {
+		export, ok := statement.(*ast.ExportStatement)
+		if !ok {
+			continue
+		}
+		if value, ok := env.Get(export.Name()); ok {
+			values[export.Name()] = value
+		}
+	}
+	return values
+}
@@ -0,0 +1,158 @@
+package module
+
+import (
+	"context"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestImports(t *testing.T) {
+	modules := MapResolver{
+		"lib/math.monkey": `
+			export fn add(a, b) { a + b }
+			export const zero = 0;
+			let hidden = 1;
+			export let twice = fn(x) { double(x) };
+			fn double(x) { x * 2 }
+		`,
+		"lib/greet.monkey": `
+			import { add } from "math.monkey"
+			export let greet = fn(name) { "hello " + name };
+			export let three = add(1, 2);
+		`,
+		"cycle/a.monkey": `import "b.monkey" as b`,
+		"cycle/b.monkey": `import "a.monkey" as a`,
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "lib/math.monkey" as math; math.add(2, 3)`, `5`},
+		{`import { add, zero } from "lib/math.monkey"; add(zero, 7)`, `7`},
+		{`import "lib/math.monkey" as math; math.twice(4)`, `8`},
+		{`import "lib/greet.monkey" as g; g.greet("monkey")`, `hello monkey`},
+		{`import "lib/greet.monkey" as g; g.three`, `3`},
+		{`import "./lib/../lib/math.monkey" as a; import "lib/math.monkey" as b; a == b`, `true`},
+		{`import "lib/math.monkey" as math; math.hidden`, `ERROR: module lib/math.monkey has no export hidden`},
+		{`import { double } from "lib/math.monkey"`, `ERROR: module lib/math.monkey has no export double`},
+		{`import "lib/missing.monkey" as m`, `ERROR: module not found: lib/missing.monkey`},
+		{`import "cycle/a.monkey" as a`, `ERROR: error in module cycle/a.monkey: error in module cycle/b.monkey: import cycle: cycle/a.monkey -> cycle/b.monkey -> cycle/a.monkey`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input, NewLoader(modules))
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestModulesAreEvaluatedOnce(t *testing.T) {
+	modules := MapResolver{
+		"counter.monkey": `
+			let count = 0;
+			export fn next() { count = count + 1; count }
+		`,
+		"user.monkey": `
+			import "counter.monkey" as counter
+			export let first = counter.next();
+		`,
+	}
+
+	input := `
+		import "counter.monkey" as counter
+		import "user.monkey" as user
+		[user.first, counter.next()]
+	`
+	evaluated := testEval(t, input, NewLoader(modules))
+	if evaluated.Inspect() != "[1, 2]" {
+		t.Errorf("expected=%q, got=%q", "[1, 2]", evaluated.Inspect())
+	}
+}
+
+func TestModuleErrors(t *testing.T) {
+	modules := MapResolver{
+		"fail.monkey": "fn fail() {\n\t1 / 0\n}\nfail()",
+		"loop.monkey": `while (true) {}`,
+	}
+	tests := []struct {
+		input   string
+		context bool
+		kind    object.ErrorKind
+		message string
+		stack   []string
+	}{
+		{`import "fail.monkey" as f`, false, object.RuntimeError, "error in module fail.monkey: division by zero", []string{"fail (4:5)"}},
+		{`try { import "fail.monkey" as f } catch (e) { e }`, false, "", "", nil},
+		// the cancellation of a module cannot be caught by the importer
+		{`try { import "loop.monkey" as l } catch (e) { e }`, true, object.CancelledError, "error in module loop.monkey: evaluation cancelled: context canceled", nil},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		env := object.NewEnvironment()
+		env.Runtime().Loader = NewLoader(modules)
+		if tt.context {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			env.Runtime().Context = ctx
+		}
+		evaluated := evaluator.Eval(p.ParseProgram(), env)
+
+		errObj, ok := evaluated.(*object.Error)
+		if tt.kind == "" {
+			if ok {
+				t.Errorf("input %q: expected the error to be caught, got %s", tt.input, errObj.Inspect())
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("input %q: expected an error, got %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if errObj.Kind != tt.kind || errObj.Message != tt.message || !reflect.DeepEqual(errObj.Stack, tt.stack) {
+			t.Errorf("input %q: expected %s %q at %q, got %s %q at %q",
+				tt.input, tt.kind, tt.message, tt.stack, errObj.Kind, errObj.Message, errObj.Stack)
+		}
+	}
+}
+
+func TestFileResolver(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "lib"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"lib/strings.monkey": `import { suffix } from "suffix.monkey"; export fn shout(s) { s + suffix }`,
+		"lib/suffix.monkey":  `export const suffix = "!";`,
+	}
+	for name, source := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	evaluated := testEval(t, `import "lib/strings.monkey" as s; s.shout("hey")`, NewLoader(FileResolver{Dir: dir}))
+	if evaluated.Inspect() != "hey!" {
+		t.Errorf("expected=%q, got=%q", "hey!", evaluated.Inspect())
+	}
+}
+
+func testEval(t *testing.T, input string, loader *Loader) object.Object {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	env := object.NewEnvironment()
+	env.Runtime().Loader = loader
+	return evaluator.Eval(program, env)
+}
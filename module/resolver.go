@@ -0,0 +1,84 @@
+package module
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Resolver locates the source of imported modules
+type Resolver interface {
+	// Resolve turns the path written in an import into the canonical path of
+	// the module. Relative paths are resolved against the directory of
+	// importer, which is empty for the main program.
+	Resolve(importPath, importer string) (string, error)
+
+	// Read returns the source of the module at a path returned by Resolve
+	Read(resolved string) (string, error)
+}
+
+// FileResolver reads modules from the file system. Relative imports of the
+// main program are resolved against Dir, or the working directory when Dir is empty.
+type FileResolver struct {
+	Dir string
+}
+
+func (r FileResolver) Resolve(importPath, importer string) (string, error) {
+	if filepath.IsAbs(importPath) {
+		return filepath.Clean(importPath), nil
+	}
+
+	dir := r.Dir
+	if importer != "" {
+		dir = filepath.Dir(importer)
+	}
+
+	resolved, err := filepath.Abs(filepath.Join(dir, importPath))
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve %q: %w", importPath, err)
+	}
+	return resolved, nil
+}
+
+func (r FileResolver) Read(resolved string) (string, error) {
+	source, err := os.ReadFile(resolved)
+	if err != nil {
+		return "", fmt.Errorf("cannot read module %s: %w", resolved, err)
+	}
+	return string(source), nil
+}
+
+// MapResolver serves modules from memory, keyed by slash separated paths
+// relative to the root, such as "lib/math.monkey". It is used where there
+// is no file system, like the browser editor.
+type MapResolver map[string]string
+
+func (r MapResolver) Resolve(importPath, importer string) (string, error) {
+	resolved := path.Clean(path.Join(path.Dir(importer), importPath))
+	if path.IsAbs(importPath) {
+		resolved = path.Clean(importPath)
+	}
+	resolved = trimRoot(resolved)
+
+	if _, ok := r[resolved]; !ok {
+		return "", fmt.Errorf("module not found: %s", importPath)
+	}
+	return resolved, nil
+}
+
+func (r MapResolver) Read(resolved string) (string, error) {
+	source, ok := r[resolved]
+	if !ok {
+		return "", fmt.Errorf("module not found: %s", resolved)
+	}
+	return source, nil
+}
+
+// trimRoot makes a cleaned path relative to the root of a MapResolver
+func trimRoot(p string) string {
+	for len(p) > 0 && p[0] == '/' {
+		p = p[1:]
+	}
+	return p
+}
@@ -0,0 +1,257 @@
+package monkey
+
+import (
+	"errors"
+	"fmt"
+	"monkey/evaluator"
+	"monkey/object"
+	"reflect"
+	"slices"
+)
+
+var (
+	objectType   = reflect.TypeOf((*object.Object)(nil)).Elem()
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	callbackType = reflect.TypeOf(func(...any) (any, error) { return nil, nil })
+)
+
+// supportedTypes are the Go types a registered function may take and return
+var supportedTypes = map[reflect.Type]bool{
+	reflect.TypeOf(0):                  true,
+	reflect.TypeOf(int64(0)):           true,
+	reflect.TypeOf(""):                 true,
+	reflect.TypeOf(false):              true,
+	reflect.TypeOf([]any{}):            true,
+	reflect.TypeOf(map[string]any{}):   true,
+	reflect.TypeOf((*any)(nil)).Elem(): true,
+	objectType:                         true,
+	callbackType:                       true,
+}
+
+// toObject converts a Go value to Monkey
+func toObject(value any) (object.Object, error) {
+	switch value := value.(type) {
+	case nil:
+		return evaluator.NullObj, nil
+	case object.Object:
+		return value, nil
+	case bool:
+		if value {
+			return evaluator.TrueObj, nil
+		}
+		return evaluator.FalseObj, nil
+	case int:
+		return &object.Integer{Value: int64(value)}, nil
+	case int64:
+		return &object.Integer{Value: value}, nil
+	case string:
+		return &object.String{Value: value}, nil
+	case []any:
+		array := &object.Array{Elements: make([]object.Object, 0, len(value))}
+		for _, element := range value {
+			obj, err := toObject(element)
+			if err != nil {
+				return nil, err
+			}
+			array.Elements = append(array.Elements, obj)
+		}
+		return array, nil
+	case map[string]any:
+		// Go maps have no order, sort the keys so that the hash always has the same
+		hash := object.NewHash()
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			obj, err := toObject(value[key])
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(&object.String{Value: key}, obj)
+		}
+		return hash, nil
+	}
+
+	if reflect.TypeOf(value).Kind() == reflect.Func {
+		return newBuiltin("<host function>", value)
+	}
+	return nil, fmt.Errorf("unsupported type %T", value)
+}
+
+// fromObject converts a Monkey value to Go. Functions are called back from
+// env when the host calls them.
+func fromObject(obj object.Object, env *object.Environment) any {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value
+	case *object.String:
+		return obj.Value
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return nil
+	case *object.Array:
+		values := make([]any, 0, len(obj.Elements))
+		for _, element := range obj.Elements {
+			values = append(values, fromObject(element, env))
+		}
+		return values
+	case *object.Hash:
+		values := map[string]any{}
+		for _, pair := range obj.Pairs() {
+			values[pair.Key.Inspect()] = fromObject(pair.Value, env)
+		}
+		return values
+	case *object.Function, *object.Builtin:
+		return callback(obj, env)
+	}
+	return obj
+}
+
+// callback wraps a Monkey function into a Go function
+func callback(fn object.Object, env *object.Environment) func(...any) (any, error) {
+	return func(args ...any) (any, error) {
+		objs := make([]object.Object, 0, len(args))
+		for _, arg := range args {
+			obj, err := toObject(arg)
+			if err != nil {
+				return nil, err
+			}
+			objs = append(objs, obj)
+		}
+
+		result := evaluator.Apply(fn, objs, env)
+		if errObj, ok := result.(*object.Error); ok {
+			return nil, newRuntimeError(errObj)
+		}
+		if result == nil {
+			return nil, nil
+		}
+		return fromObject(result, env), nil
+	}
+}
+
+// newBuiltin wraps the Go function fn into a Monkey builtin called name
+func newBuiltin(name string, fn any) (*object.Builtin, error) {
+	fnValue := reflect.ValueOf(fn)
+	fnType := fnValue.Type()
+	if fnType.Kind() != reflect.Func {
+		return nil, fmt.Errorf("cannot register %s: %T is not a function", name, fn)
+	}
+
+	for i := 0; i < fnType.NumIn(); i++ {
+		in := fnType.In(i)
+		if fnType.IsVariadic() && i == fnType.NumIn()-1 {
+			in = in.Elem()
+		}
+		if !isSupported(in) {
+			return nil, fmt.Errorf("cannot register %s: unsupported parameter type %s", name, in)
+		}
+	}
+	results := fnType.NumOut()
+	if results > 0 && fnType.Out(results-1) == errorType {
+		results--
+	}
+	if results > 1 {
+		return nil, fmt.Errorf("cannot register %s: more than one result besides error", name)
+	}
+	if results == 1 && !isSupported(fnType.Out(0)) {
+		return nil, fmt.Errorf("cannot register %s: unsupported result type %s", name, fnType.Out(0))
+	}
+
+	return &object.Builtin{
+		Name: name,
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			in, err := convertArgs(fnType, args, env)
+			if err != nil {
+				return &object.Error{Kind: object.TypeError, Message: fmt.Sprintf("%s: %s", name, err)}
+			}
+			return convertResults(name, fnValue.Call(in))
+		},
+	}, nil
+}
+
+// isSupported reports whether t is one of the types listed by RegisterFunc.
+// Named types are rejected even when their underlying type is listed, since
+// the values converted from Monkey cannot be assigned to them.
+func isSupported(t reflect.Type) bool {
+	return supportedTypes[t]
+}
+
+// convertArgs converts the Monkey arguments of a call to the parameters of fnType
+func convertArgs(fnType reflect.Type, args []object.Object, env *object.Environment) ([]reflect.Value, error) {
+	want := fnType.NumIn()
+	if fnType.IsVariadic() {
+		if len(args) < want-1 {
+			return nil, fmt.Errorf("wrong number of arguments: want at least %d, got=%d", want-1, len(args))
+		}
+	} else if len(args) != want {
+		return nil, fmt.Errorf("wrong number of arguments: want=%d, got=%d", want, len(args))
+	}
+
+	in := make([]reflect.Value, 0, len(args))
+	for i, arg := range args {
+		var param reflect.Type
+		if fnType.IsVariadic() && i >= want-1 {
+			param = fnType.In(want - 1).Elem()
+		} else {
+			param = fnType.In(i)
+		}
+
+		value, err := convertArg(arg, param, env)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+		in = append(in, value)
+	}
+	return in, nil
+}
+
+func convertArg(arg object.Object, param reflect.Type, env *object.Environment) (reflect.Value, error) {
+	if param == objectType {
+		return reflect.ValueOf(&arg).Elem(), nil
+	}
+
+	value := fromObject(arg, env)
+	if value == nil {
+		if param.Kind() == reflect.Interface || param.Kind() == reflect.Slice || param.Kind() == reflect.Map || param.Kind() == reflect.Func {
+			return reflect.Zero(param), nil
+		}
+		return reflect.Value{}, fmt.Errorf("cannot use null as %s", param)
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Type().AssignableTo(param) {
+		return v, nil
+	}
+	if param.Kind() == reflect.Int && v.Kind() == reflect.Int64 {
+		return v.Convert(param), nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot use %s as %s", arg.Type(), param)
+}
+
+// convertResults turns the results of a Go function into a single Monkey value
+func convertResults(name string, out []reflect.Value) object.Object {
+	if len(out) > 0 && out[len(out)-1].Type() == errorType {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			var runtimeErr *RuntimeError
+			if errors.As(err, &runtimeErr) {
+				return &object.Error{Kind: object.ErrorKind(runtimeErr.Kind), Message: runtimeErr.Message, Stack: runtimeErr.Stack}
+			}
+			return &object.Error{Kind: object.RuntimeError, Message: fmt.Sprintf("%s: %s", name, err)}
+		}
+		out = out[:len(out)-1]
+	}
+
+	if len(out) == 0 {
+		return evaluator.NullObj
+	}
+
+	obj, err := toObject(out[0].Interface())
+	if err != nil {
+		return &object.Error{Kind: object.TypeError, Message: fmt.Sprintf("%s: %s", name, err)}
+	}
+	return obj
+}
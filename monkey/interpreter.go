@@ -0,0 +1,148 @@
+// Package monkey embeds the Monkey interpreter into Go programs.
+//
+//	interp := monkey.New()
+//	interp.RegisterFunc("double", func(n int64) int64 { return n * 2 })
+//	result, err := interp.Eval(ctx, `double(21)`) // int64(42)
+package monkey
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/module"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/resolver"
+	"monkey/stdlib"
+	"strings"
+)
+
+// Interpreter evaluates Monkey source in a global scope that persists across
+// calls to Eval. An Interpreter must not be used by several goroutines at once.
+type Interpreter struct {
+	env *object.Environment
+}
+
+// New returns an Interpreter whose programs can import the standard library
+// but nothing else, see SetResolver. Output is discarded until SetStdout and
+// SetStderr are called.
+func New() *Interpreter {
+	env := object.NewEnvironment()
+	env.Runtime().Loader = module.NewLoader(stdlib.Resolver{})
+	return &Interpreter{env: env}
+}
+
+// SetStdout sets where the output of programs is written
+func (i *Interpreter) SetStdout(w io.Writer) {
+	i.env.Runtime().Stdout = w
+}
+
+// SetStderr sets where the error output of programs is written
+func (i *Interpreter) SetStderr(w io.Writer) {
+	i.env.Runtime().Stderr = w
+}
+
+// SetResolver lets programs import the modules served by r, in addition to
+// the standard library. Modules imported before are evaluated again the next
+// time they are imported.
+func (i *Interpreter) SetResolver(r module.Resolver) {
+	i.env.Runtime().Loader = module.NewLoader(stdlib.Resolver{Next: r})
+}
+
+// Eval parses and evaluates src and returns the value of its last statement,
+// converted to Go as described by Get. Evaluation stops with an error once
+// ctx is done. Errors are a *ParseError or a *RuntimeError.
+func (i *Interpreter) Eval(ctx context.Context, src string) (any, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Messages: p.Errors()}
+	}
+	defined := func(name string) bool {
+		_, ok := i.env.Get(name)
+		return ok
+	}
+	if errors := resolver.Errors(resolver.Resolve(program, defined)); len(errors) != 0 {
+		return nil, &ParseError{Messages: errors}
+	}
+
+	rt := i.env.Runtime()
+	rt.Context = ctx
+	defer func() { rt.Context = nil }()
+
+	evaluated := evaluator.Eval(program, i.env)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		return nil, newRuntimeError(errObj)
+	}
+	if evaluated == nil {
+		return nil, nil
+	}
+	return fromObject(evaluated, i.env), nil
+}
+
+// Set binds name to value in the global scope, replacing any earlier binding.
+// Values are converted to Monkey as described by RegisterFunc.
+func (i *Interpreter) Set(name string, value any) error {
+	obj, err := toObject(value)
+	if err != nil {
+		return fmt.Errorf("cannot set %s: %w", name, err)
+	}
+	i.env.Set(name, obj)
+	return nil
+}
+
+// Get returns the value bound to name in the global scope. Integers become
+// int64, strings string, booleans bool, null nil, arrays []any, hashes
+// map[string]any keyed by the Inspect form of their keys and functions
+// func(...any) (any, error).
+func (i *Interpreter) Get(name string) (any, bool) {
+	obj, ok := i.env.Get(name)
+	if !ok {
+		return nil, false
+	}
+	return fromObject(obj, i.env), true
+}
+
+// RegisterFunc makes the Go function fn callable from Monkey as name.
+//
+// Parameters and results may be int, int64, string, bool, []any,
+// map[string]any, any, object.Object or func(...any) (any, error), which
+// receives Monkey functions. fn may be variadic. A last result of type
+// error is turned into a Monkey error when it is not nil, fn may have one
+// other result, which becomes the return value.
+func (i *Interpreter) RegisterFunc(name string, fn any) error {
+	builtin, err := newBuiltin(name, fn)
+	if err != nil {
+		return err
+	}
+	i.env.Set(name, builtin)
+	return nil
+}
+
+// ParseError lists the reasons why a source was rejected before running it:
+// syntax errors, and names that are undefined or used before their declaration
+type ParseError struct {
+	Messages []string
+}
+
+func (e *ParseError) Error() string {
+	return "parse error: " + strings.Join(e.Messages, "; ")
+}
+
+// RuntimeError is an error that the program raised and did not catch. Its
+// Kind is InternalError when the interpreter itself failed instead.
+type RuntimeError struct {
+	Kind    string
+	Message string
+	Stack   []string // Stack lists the calls the error went through, innermost first
+}
+
+func newRuntimeError(err *object.Error) *RuntimeError {
+	return &RuntimeError{Kind: string(err.Kind), Message: err.Message, Stack: err.Stack}
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Kind + ": " + e.Message
+}
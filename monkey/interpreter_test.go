@@ -0,0 +1,295 @@
+package monkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`1 + 2`, int64(3)},
+		{`"mon" + "key"`, "monkey"},
+		{`1 < 2`, true},
+		{`if (false) { 1 }`, nil},
+		{`[1, "two", [true]]`, []any{int64(1), "two", []any{true}}},
+		{`{"a": 1, 2: "b"}`, map[string]any{"a": int64(1), "2": "b"}},
+		{`import "std/math" as math; math.max(3, 9)`, int64(9)},
+		{`let x = 1;`, nil},
+	}
+
+	for _, tt := range tests {
+		interp := New()
+		result, err := interp.Eval(context.Background(), tt.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("%q: expected %#v, got %#v", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestEvalKeepsGlobals(t *testing.T) {
+	interp := New()
+	ctx := context.Background()
+
+	if _, err := interp.Eval(ctx, `let count = 1; fn inc() { count = count + 1 }`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := interp.Eval(ctx, `inc(); inc();`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	count, ok := interp.Get("count")
+	if !ok || count != int64(3) {
+		t.Errorf("expected count to be 3, got %#v (%t)", count, ok)
+	}
+	if _, ok := interp.Get("missing"); ok {
+		t.Errorf("expected missing to be unbound")
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	interp := New()
+	ctx := context.Background()
+
+	_, err := interp.Eval(ctx, `let = 1`)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || len(parseErr.Messages) == 0 {
+		t.Errorf("expected a *ParseError, got %#v", err)
+	}
+
+	_, err = interp.Eval(ctx, `fn f() { missing }`)
+	if !errors.As(err, &parseErr) || parseErr.Messages[0] != "1:10: error: undefined identifier missing" {
+		t.Errorf("expected an undefined identifier error, got %#v", err)
+	}
+
+	_, err = interp.Eval(ctx, "fn fail() { throw \"boom\" }\nfail()")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected a *RuntimeError, got %#v", err)
+	}
+	if runtimeErr.Kind != "Error" || runtimeErr.Message != "boom" {
+		t.Errorf("unexpected error: %s", runtimeErr)
+	}
+	if !reflect.DeepEqual(runtimeErr.Stack, []string{"fail (2:5)"}) {
+		t.Errorf("unexpected stack: %q", runtimeErr.Stack)
+	}
+}
+
+func TestEvalCancelled(t *testing.T) {
+	interp := New()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := interp.Eval(ctx, `try { while (true) {} } catch (e) { 1 }`)
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.Kind != "CancelledError" {
+		t.Fatalf("expected a CancelledError, got %#v", err)
+	}
+
+	result, err := interp.Eval(context.Background(), `1`)
+	if err != nil || result != int64(1) {
+		t.Errorf("expected the interpreter to be usable after cancellation, got %#v, %v", result, err)
+	}
+}
+
+func TestEvalPanics(t *testing.T) {
+	interp := New()
+	interp.RegisterFunc("crash", func(n int64) int64 { return 10 / n })
+
+	_, err := interp.Eval(context.Background(), "let f = fn() { crash(0) };\nf()")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.Kind != "InternalError" {
+		t.Fatalf("expected an InternalError, got %#v", err)
+	}
+	if runtimeErr.Message != "runtime error: integer divide by zero (1:16)" || !reflect.DeepEqual(runtimeErr.Stack, []string{"f (2:2)"}) {
+		t.Errorf("unexpected error: %s at %q", runtimeErr, runtimeErr.Stack)
+	}
+
+	result, err := interp.Eval(context.Background(), `crash(5)`)
+	if err != nil || result != int64(2) {
+		t.Errorf("expected the interpreter to be usable after a panic, got %#v, %v", result, err)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	var stdout strings.Builder
+	interp := New()
+	interp.SetStdout(&stdout)
+
+	if _, err := interp.Eval(context.Background(), `puts("hello"); print(1, 2)`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if stdout.String() != "hello\n1 2" {
+		t.Errorf("unexpected output %q", stdout.String())
+	}
+}
+
+func TestSet(t *testing.T) {
+	interp := New()
+	values := map[string]any{
+		"n":     42,
+		"s":     "str",
+		"b":     true,
+		"list":  []any{int64(1), "x"},
+		"hash":  map[string]any{"key": []any{false}},
+		"empty": nil,
+	}
+	for name, value := range values {
+		if err := interp.Set(name, value); err != nil {
+			t.Fatalf("Set(%s): unexpected error: %s", name, err)
+		}
+	}
+
+	result, err := interp.Eval(context.Background(),
+		`[n + 1, s + "!", !b, list[1], hash["key"][0], empty]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []any{int64(43), "str!", false, "x", false, nil}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %#v, got %#v", expected, result)
+	}
+
+	// hashes built from Go maps list their keys in order
+	for i := 0; i < 10; i++ {
+		if err := interp.Set("h", map[string]any{"c": 3, "a": 1, "b": 2, "d": 4}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result, err := interp.Eval(context.Background(), `str(h)`)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if expected := "{a: 1, b: 2, c: 3, d: 4}"; result != expected {
+			t.Fatalf("expected %s, got %v", expected, result)
+		}
+	}
+
+	if err := interp.Set("c", make(chan int)); err == nil {
+		t.Errorf("expected an error for an unsupported type")
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	interp := New()
+	funcs := map[string]any{
+		"double": func(n int64) int64 { return n * 2 },
+		"upper":  strings.ToUpper,
+		"count":  func(items []any) int { return len(items) },
+		"keys":   func(h map[string]any) int { return len(h) },
+		"sum": func(ns ...int) int {
+			total := 0
+			for _, n := range ns {
+				total += n
+			}
+			return total
+		},
+		"nothing": func() {},
+		"check": func(ok bool) (string, error) {
+			if !ok {
+				return "", fmt.Errorf("not ok")
+			}
+			return "ok", nil
+		},
+		"twice": func(f func(...any) (any, error), x any) (any, error) {
+			y, err := f(x)
+			if err != nil {
+				return nil, err
+			}
+			return f(y)
+		},
+	}
+	for name, fn := range funcs {
+		if err := interp.RegisterFunc(name, fn); err != nil {
+			t.Fatalf("RegisterFunc(%s): unexpected error: %s", name, err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected any
+		err      string
+	}{
+		{`double(21)`, int64(42), ""},
+		{`upper("monkey")`, "MONKEY", ""},
+		{`count([1, 2, 3])`, int64(3), ""},
+		{`keys({"a": 1, "b": 2})`, int64(2), ""},
+		{`sum()`, int64(0), ""},
+		{`sum(1, 2, 3)`, int64(6), ""},
+		{`nothing()`, nil, ""},
+		{`check(true)`, "ok", ""},
+		{`twice(fn(x) { x * 3 }, 2)`, int64(18), ""},
+		{`check(false)`, nil, "RuntimeError: check: not ok"},
+		{`try { check(false) } catch (e) { e.message }`, "check: not ok", ""},
+		{`double("x")`, nil, "TypeError: double: argument 1: cannot use STRING as int64"},
+		{`double(1, 2)`, nil, "TypeError: double: wrong number of arguments: want=1, got=2"},
+		{`twice(fn(x) { throw "inner" }, 1)`, nil, "Error: inner"},
+	}
+
+	for _, tt := range tests {
+		result, err := interp.Eval(context.Background(), tt.input)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%q: expected error %q, got %v", tt.input, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("%q: expected %#v, got %#v", tt.input, tt.expected, result)
+		}
+	}
+
+	type ID int64
+	invalid := []struct {
+		fn       any
+		expected string
+	}{
+		{func(f float64) {}, "cannot register bad: unsupported parameter type float64"},
+		{func(id ID) {}, "cannot register bad: unsupported parameter type monkey.ID"},
+		{func() ID { return 0 }, "cannot register bad: unsupported result type monkey.ID"},
+		{func() (int, string) { return 0, "" }, "cannot register bad: more than one result besides error"},
+		{func() (int, string, error) { return 0, "", nil }, "cannot register bad: more than one result besides error"},
+		{1, "cannot register bad: int is not a function"},
+	}
+	for _, tt := range invalid {
+		err := interp.RegisterFunc("bad", tt.fn)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%T: expected error %q, got %v", tt.fn, tt.expected, err)
+		}
+	}
+}
+
+func TestGetFunction(t *testing.T) {
+	interp := New()
+	if _, err := interp.Eval(context.Background(), `fn add(a, b) { a + b }`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	value, ok := interp.Get("add")
+	add, isFunc := value.(func(...any) (any, error))
+	if !ok || !isFunc {
+		t.Fatalf("expected add to be a function, got %#v", value)
+	}
+
+	result, err := add(2, 3)
+	if err != nil || result != int64(5) {
+		t.Errorf("expected 5, got %#v, %v", result, err)
+	}
+	if _, err := add(1); err == nil {
+		t.Errorf("expected an arity error")
+	}
+}
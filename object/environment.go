@@ -1,32 +1,292 @@
 package object
 
+import (
+	"context"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"sort"
+)
+
+// NewEnvironment creates the global scope of a program, with a Runtime of its own
 func NewEnvironment() *Environment {
 	return &Environment{
-		store: map[string]Object{},
-		outer: nil,
+		store:   map[string]*binding{},
+		outer:   nil,
+		runtime: &Runtime{},
 	}
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	return env
+	return &Environment{
+		store:   map[string]*binding{},
+		outer:   outer,
+		runtime: outer.runtime,
+		module:  outer.module,
+	}
+}
+
+// NewModuleEnvironment creates the global scope of the module at path. The
+// module does not see the bindings of from, but shares its Runtime.
+func NewModuleEnvironment(from *Environment, path string) *Environment {
+	return &Environment{
+		store:   map[string]*binding{},
+		outer:   nil,
+		runtime: from.runtime,
+		module:  path,
+	}
+}
+
+// binding is a single entry of an Environment. It remembers whether the
+// name was declared with const so that later assignments can be rejected.
+type binding struct {
+	value    Object
+	constant bool
 }
 
+// Environment is a single lexical scope. Closures capture it by reference.
+//
+// Every function call, block and loop iteration evaluates in a new Environment
+// enclosing the one it was written in. A function value keeps a pointer to the
+// Environment it was created in, so it sees later changes to the variables
+// around it, and assignments made from inside a closure update the binding
+// where it was declared rather than creating a new one. Two closures created
+// by the same call therefore share their captured variables, while every
+// call, and every iteration of a loop, gets bindings of its own.
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store   map[string]*binding
+	slots   []*binding // slots holds the bindings declared with a slot, see DeclareAt
+	outer   *Environment
+	runtime *Runtime
+	module  string // module is the resolved path of the module the scope belongs to, empty for the main program
+}
+
+// Runtime holds the state shared by every environment of a running program,
+// including the environments of the modules it imports
+type Runtime struct {
+	Loader ModuleLoader // Loader resolves imports, they fail when it is nil
+
+	// Stdout and Stderr receive the output of the program, it is
+	// discarded when they are nil
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Context stops the evaluation once it is done, when it is not nil
+	Context context.Context
+
+	// Hook observes the evaluation when it is not nil
+	Hook Hook
+
+	// Depth is the number of function calls in progress, the evaluator
+	// keeps it to stop a runaway recursion before it overflows the stack
+	Depth int
+}
+
+// Hook observes a running program. Debuggers set it on the Runtime to stop
+// the program at breakpoints and to follow the calls it makes, tracers to
+// record what every node evaluates to.
+type Hook interface {
+	// Before is called before node is evaluated in env. When it returns an
+	// error the evaluation of node stops with it.
+	Before(node ast.Node, env *Environment) *Error
+	// After is called once node is evaluated in env to result, which may be
+	// nil for statements. It is not called when Before returns an error.
+	After(node ast.Node, env *Environment, result Object)
+	// Call is called when fn is called with args, before its body runs
+	Call(fn *Function, args []Object)
+	// Return is called when the call of fn returns result
+	Return(fn *Function, result Object)
+}
+
+// TailCallNester is implemented by the hooks that need a call in tail
+// position nested in the call making it, like any other call: debuggers to
+// show a frame for every call, tracers to record the value of every node.
+// Such calls then take stack space. The other hooks see a tail call after
+// the call making it has returned, and the nodes leading to it, that call
+// included, evaluate to a value of type TAIL_CALL standing for it.
+type TailCallNester interface {
+	NestTailCalls() bool
+}
+
+// ModuleLoader loads the module imported as path by code running in env
+type ModuleLoader interface {
+	Load(path string, env *Environment) (*Module, error)
+}
+
+// ModuleError is returned by a ModuleLoader when the module at Path fails
+// while it is evaluated, Err is the error it failed with
+type ModuleError struct {
+	Path string
+	Err  *Error
+}
+
+func (e *ModuleError) Error() string {
+	return fmt.Sprintf("error in module %s: %s", e.Path, e.Err.Message)
+}
+
+func (e *Environment) Runtime() *Runtime {
+	return e.runtime
+}
+
+// Outer returns the scope enclosing e, or nil when e is the global scope
+// of a program or a module
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// Names returns the names declared in this scope, sorted
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Module returns the resolved path of the module the scope belongs to
+func (e *Environment) Module() string {
+	return e.module
+}
+
+// SetModule sets the path that imports made from this scope are relative to
+func (e *Environment) SetModule(path string) {
+	e.module = path
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
+	b, ok := e.store[name]
 	if !ok && e.outer != nil {
-		obj, ok = e.outer.Get(name)
+		return e.outer.Get(name)
 	}
-	return obj, ok
+	if !ok {
+		return nil, false
+	}
+	return b.value, true
 }
 
+// Set binds name to val in the current scope, overwriting any existing binding.
 func (e *Environment) Set(name string, val Object) Object {
-	e.store[name] = val
+	e.store[name] = &binding{value: val}
 	return val
 }
+
+// Declare binds name in the current scope. It reports false, without
+// changing anything, when the name is already declared in this scope.
+func (e *Environment) Declare(name string, val Object, constant bool) bool {
+	if _, ok := e.store[name]; ok {
+		return false
+	}
+	e.store[name] = &binding{value: val, constant: constant}
+	return true
+}
+
+// IsConstant reports whether the nearest binding of name was declared with const.
+func (e *Environment) IsConstant(name string) bool {
+	b, ok := e.store[name]
+	if !ok && e.outer != nil {
+		return e.outer.IsConstant(name)
+	}
+	return ok && b.constant
+}
+
+// Assign updates the nearest existing binding of name, walking out through
+// the enclosing scopes. It reports false when name is not declared anywhere.
+func (e *Environment) Assign(name string, val Object) bool {
+	b, ok := e.store[name]
+	if !ok {
+		if e.outer == nil {
+			return false
+		}
+		return e.outer.Assign(name, val)
+	}
+	b.value = val
+	return true
+}
+
+// DeclareAt is Declare for a variable the resolver assigned to slot index,
+// which later lookups through GetAt use instead of its name
+func (e *Environment) DeclareAt(index int, name string, val Object, constant bool) bool {
+	if !e.Declare(name, val, constant) {
+		return false
+	}
+	e.setSlot(index, e.store[name])
+	return true
+}
+
+// SetAt is Set for a variable the resolver assigned to slot index
+func (e *Environment) SetAt(index int, name string, val Object) {
+	e.Set(name, val)
+	e.setSlot(index, e.store[name])
+}
+
+func (e *Environment) setSlot(index int, b *binding) {
+	for len(e.slots) <= index {
+		e.slots = append(e.slots, nil)
+	}
+	e.slots[index] = b
+}
+
+// at returns the binding in slot index of the scope depth levels out, or
+// nil when that slot is empty
+func (e *Environment) at(depth, index int) *binding {
+	for ; depth > 0 && e != nil; depth-- {
+		e = e.outer
+	}
+	if e == nil || index >= len(e.slots) {
+		return nil
+	}
+	return e.slots[index]
+}
+
+// GetAt returns the value in slot index of the scope depth levels out.
+// It reports false when the slot is empty, in which case the caller
+// falls back to Get.
+func (e *Environment) GetAt(depth, index int) (Object, bool) {
+	b := e.at(depth, index)
+	if b == nil {
+		return nil, false
+	}
+	return b.value, true
+}
+
+// IsConstantAt reports whether the variable in slot index of the scope
+// depth levels out was declared with const
+func (e *Environment) IsConstantAt(depth, index int) bool {
+	b := e.at(depth, index)
+	return b != nil && b.constant
+}
+
+// AssignAt updates the variable in slot index of the scope depth levels
+// out. It reports false when the slot is empty.
+func (e *Environment) AssignAt(depth, index int, val Object) bool {
+	b := e.at(depth, index)
+	if b == nil {
+		return false
+	}
+	b.value = val
+	return true
+}
+
+// Copy returns a new environment with the same outer environment and a copy
+// of the bindings of e. Loops use it to give every iteration its own loop
+// variables, so closures created by different iterations do not share them.
+func (e *Environment) Copy() *Environment {
+	env := &Environment{
+		store:   map[string]*binding{},
+		outer:   e.outer,
+		runtime: e.runtime,
+		module:  e.module,
+	}
+	copies := map[*binding]*binding{}
+	for name, b := range e.store {
+		copies[b] = &binding{value: b.value, constant: b.constant}
+		env.store[name] = copies[b]
+	}
+	for index, b := range e.slots {
+		if b != nil {
+			env.setSlot(index, copies[b])
+		}
+	}
+	return env
+}
@@ -2,6 +2,7 @@ package object
 
 import (
 	"fmt"
+	"hash/fnv"
 	"monkey/ast"
 	"strings"
 )
@@ -16,6 +17,12 @@ const (
 	ErrorObj       ObjectType = "ERROR"
 	FunctionObj    ObjectType = "FUNCTION"
 	StringObj      ObjectType = "STRING"
+	ArrayObj       ObjectType = "ARRAY"
+	BreakObj       ObjectType = "BREAK"
+	ContinueObj    ObjectType = "CONTINUE"
+	HashObj        ObjectType = "HASH"
+	ModuleObj      ObjectType = "MODULE"
+	BuiltinObj     ObjectType = "BUILTIN"
 )
 
 type Object interface {
@@ -69,8 +76,33 @@ func (r *Return) Type() ObjectType {
 	return ReturnTypeObj
 }
 
+// ErrorKind tells apart the different sources of an Error
+type ErrorKind string
+
+const (
+	RuntimeError   ErrorKind = "RuntimeError"
+	TypeError      ErrorKind = "TypeError"
+	ReferenceError ErrorKind = "ReferenceError"
+	ThrownError    ErrorKind = "Error" // ThrownError is the default kind of values passed to throw
+	AssertionError ErrorKind = "AssertionError"
+
+	// CancelledError stops a program whose Runtime.Context is done. It
+	// cannot be caught by the program.
+	CancelledError ErrorKind = "CancelledError"
+
+	// InternalError is a Go panic of the interpreter itself, recovered
+	// while it evaluated the program. It is a bug of the interpreter rather
+	// than of the program, and cannot be caught by the program either.
+	InternalError ErrorKind = "InternalError"
+)
+
+// Error unwinds evaluation until it is caught by a try statement or reaches
+// the top of the program. Stack grows by one entry for every function call
+// the error propagates out of, innermost call first.
 type Error struct {
 	Message string
+	Kind    ErrorKind
+	Stack   []string
 }
 
 func (e *Error) Type() ObjectType {
@@ -78,10 +110,44 @@ func (e *Error) Type() ObjectType {
 }
 
 func (e *Error) Inspect() string {
+	if e.Kind == InternalError {
+		return "INTERNAL ERROR: " + e.Message
+	}
 	return "ERROR: " + e.Message
 }
 
+// repeatedFrames is the number of times a frame repeated in a row is
+// printed before the rest of the run is summed up
+const repeatedFrames = 3
+
+// PrintedStack returns the frames of e to print. A deep recursion leaves
+// the same frame thousands of times in a row, such a run is cut after a
+// few frames and a frame counting the ones left out.
+func (e *Error) PrintedStack() []string {
+	lines := []string{}
+	for i := 0; i < len(e.Stack); {
+		run := 1
+		for i+run < len(e.Stack) && e.Stack[i+run] == e.Stack[i] {
+			run++
+		}
+		for j := 0; j < min(run, repeatedFrames); j++ {
+			lines = append(lines, e.Stack[i])
+		}
+		if run > repeatedFrames {
+			lines = append(lines, fmt.Sprintf("%s, repeated %d more times", e.Stack[i], run-repeatedFrames))
+		}
+		i += run
+	}
+	return lines
+}
+
+// Catchable reports whether a try statement can catch e
+func (e *Error) Catchable() bool {
+	return e.Kind != CancelledError && e.Kind != InternalError
+}
+
 type Function struct {
+	Name       string // Name is empty for anonymous functions
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
@@ -99,6 +165,9 @@ func (f *Function) Inspect() string {
 	}
 
 	out.WriteString("fn")
+	if f.Name != "" {
+		out.WriteString(" " + f.Name)
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") {\n")
@@ -117,4 +186,158 @@ func (s *String) Inspect() string {
 
 func (s *String) Type() ObjectType {
 	return StringObj
-}
\ No newline at end of file
+}
+
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType {
+	return ArrayObj
+}
+
+func (a *Array) Inspect() string {
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// Break is returned by a break statement and travels up through the
+// enclosing blocks, the same way Return does, until a loop consumes it
+type Break struct{}
+
+func (b *Break) Type() ObjectType {
+	return BreakObj
+}
+
+func (b *Break) Inspect() string {
+	return "break"
+}
+
+// Continue is returned by a continue statement and travels up to the
+// enclosing loop, which then moves on to its next iteration
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType {
+	return ContinueObj
+}
+
+func (c *Continue) Inspect() string {
+	return "continue"
+}
+
+// HashKey identifies a key of a Hash. Keys of different types never collide
+// because the type is part of the key.
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Hashable is implemented by every object that can be used as a hash key
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash keeps its pairs in insertion order so that Inspect and iteration
+// are deterministic.
+type Hash struct {
+	pairs map[HashKey]int
+	order []HashPair
+}
+
+func NewHash() *Hash {
+	return &Hash{pairs: map[HashKey]int{}}
+}
+
+func (h *Hash) Type() ObjectType {
+	return HashObj
+}
+
+func (h *Hash) Inspect() string {
+	pairs := []string{}
+	for _, pair := range h.order {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// Set stores value under key, keeping the position of a key that already exists
+func (h *Hash) Set(key Hashable, value Object) {
+	if idx, ok := h.pairs[key.HashKey()]; ok {
+		h.order[idx].Value = value
+		return
+	}
+	h.pairs[key.HashKey()] = len(h.order)
+	h.order = append(h.order, HashPair{Key: key.(Object), Value: value})
+}
+
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	idx, ok := h.pairs[key.HashKey()]
+	if !ok {
+		return nil, false
+	}
+	return h.order[idx].Value, true
+}
+
+// Pairs returns the pairs of the hash in insertion order
+func (h *Hash) Pairs() []HashPair {
+	return h.order
+}
+
+// Module is the value bound by import "path" as name. Its exports are
+// reached with name.export.
+type Module struct {
+	Path    string
+	Exports map[string]Object
+}
+
+func (m *Module) Type() ObjectType {
+	return ModuleObj
+}
+
+func (m *Module) Inspect() string {
+	return "module(" + m.Path + ")"
+}
+
+// BuiltinFunction implements a Builtin. env is the environment of the call,
+// builtins reach the Runtime of the program through it.
+type BuiltinFunction func(env *Environment, args ...Object) Object
+
+// Builtin is a function implemented by the host instead of in Monkey
+type Builtin struct {
+	Name string
+	Fn   BuiltinFunction
+}
+
+func (b *Builtin) Type() ObjectType {
+	return BuiltinObj
+}
+
+func (b *Builtin) Inspect() string {
+	return "builtin function " + b.Name
+}
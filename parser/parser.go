@@ -16,7 +16,8 @@ const (
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
-	CALL        // myFunction(X) It also has the highest priority
+	CALL        // myFunction(X)
+	INDEX       // array[index] It has the highest priority
 )
 
 var precedences = map[token.Type]int{
@@ -29,6 +30,8 @@ var precedences = map[token.Type]int{
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
 	token.LPAREN:   CALL,
+	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
 }
 
 // Parser can be assumed as a state
@@ -37,8 +40,18 @@ type Parser struct {
 	currToken        token.Token
 	peekToken        token.Token
 	errors           []string
+	positions        []token.Token // positions holds the token each error was found at
 	prefixParseFnMap map[token.Type]prefixParseFn
 	infixParseFnMap  map[token.Type]infixParseFn
+
+	// scopes mirrors the environments the evaluator will create. Every scope
+	// maps a declared name to whether it was declared with const, so that
+	// redeclarations and assignments to constants are reported while parsing.
+	scopes []map[string]bool
+
+	// loopDepth counts the loops enclosing the current token inside the
+	// current function, so break and continue can be rejected outside of them
+	loopDepth int
 }
 
 type prefixParseFn func() ast.Expression
@@ -50,6 +63,7 @@ func New(l *lexer.Lexer) *Parser {
 		errors:           []string{},
 		prefixParseFnMap: map[token.Type]prefixParseFn{},
 		infixParseFnMap:  map[token.Type]infixParseFn{},
+		scopes:           []map[string]bool{{}},
 	}
 
 	p.registerPrefixFn(token.IDENT, p.parseIdentifier)
@@ -62,6 +76,9 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefixFn(token.IF, p.parseIfExpression)
 	p.registerPrefixFn(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefixFn(token.STRING, p.parseStringLiteral)
+	p.registerPrefixFn(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefixFn(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefixFn(token.MATCH, p.parseMatchExpression)
 
 	p.registerInfixFn(token.EQ, p.parseInfixExpressions)
 	p.registerInfixFn(token.NOTEQ, p.parseInfixExpressions)
@@ -72,6 +89,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfixFn(token.LT, p.parseInfixExpressions)
 	p.registerInfixFn(token.GT, p.parseInfixExpressions)
 	p.registerInfixFn(token.LPAREN, p.parseCallExpression)
+	p.registerInfixFn(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfixFn(token.DOT, p.parseMemberExpression)
 
 	// p.nextToken() is done to populate the pointer of currToken and peekToken
 	p.nextToken()
@@ -83,9 +102,31 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// Error is a syntax error and the 1-based position of the token it was found at
+type Error struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+// PositionedErrors returns the errors of Errors along with their positions
+func (p *Parser) PositionedErrors() []Error {
+	errors := make([]Error, len(p.errors))
+	for i, msg := range p.errors {
+		errors[i] = Error{Line: p.positions[i].Line, Column: p.positions[i].Column, Message: msg}
+	}
+	return errors
+}
+
+// errorAt records an error found at tok
+func (p *Parser) errorAt(tok token.Token, msg string) {
+	p.errors = append(p.errors, msg)
+	p.positions = append(p.positions, tok)
+}
+
 func (p *Parser) peekError(t token.Type) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s (value=%s) instead", t, p.peekToken.Type, p.peekToken.Literal)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.peekToken, msg)
 }
 
 func (p *Parser) registerPrefixFn(tokenType token.Type, fn prefixParseFn) {
@@ -106,8 +147,9 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for p.currToken.Type != token.EOF {
-		stmt := p.parseStatement()
-		program.Statements = append(program.Statements, stmt)
+		if stmt := p.parseStatement(); stmt != nil {
+			program.Statements = append(program.Statements, stmt)
+		}
 		p.nextToken()
 	}
 
@@ -116,23 +158,78 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 func (p *Parser) parseStatement() ast.Statement {
 
+	// the statements are returned through a variable of the interface type,
+	// so that a statement that failed to parse is a nil interface rather
+	// than an interface holding a nil pointer
+	var stmt ast.Statement
 	if p.currTokenIs(token.LET) {
-		return p.parseLetStatement()
+		if let := p.parseLetStatement(); let != nil {
+			stmt = let
+		}
+		return stmt
+	}
+
+	if p.currTokenIs(token.CONST) {
+		if constant := p.parseConstStatement(); constant != nil {
+			stmt = constant
+		}
+		return stmt
 	}
 
 	if p.currTokenIs(token.RETURN) {
-		return p.parseReturnStatement()
+		if ret := p.parseReturnStatement(); ret != nil {
+			stmt = ret
+		}
+		return stmt
 	}
 
 	if p.currTokenIs(token.WHILE) {
 		return p.parseWhileStatement()
 	}
 
+	if p.currTokenIs(token.FOR) {
+		return p.parseForStatement()
+	}
+
+	if p.currTokenIs(token.THROW) {
+		return p.parseThrowStatement()
+	}
+
+	if p.currTokenIs(token.TRY) {
+		return p.parseTryStatement()
+	}
+
+	if p.currTokenIs(token.IMPORT) {
+		return p.parseImportStatement()
+	}
+
+	if p.currTokenIs(token.EXPORT) {
+		return p.parseExportStatement()
+	}
+
+	if p.currTokenIs(token.BREAK) {
+		return p.parseBreakStatement()
+	}
+
+	if p.currTokenIs(token.CONTINUE) {
+		return p.parseContinueStatement()
+	}
+
+	if p.currTokenIs(token.FUNCTION) && p.peekTokenIs(token.IDENT) {
+		return p.parseFunctionStatement()
+	}
+
 	if p.currTokenIs(token.IDENT) && p.peekTokenIs(token.ASSIGN) {
-		return p.parseAssignStatement()
+		if assign := p.parseAssignStatement(); assign != nil {
+			stmt = assign
+		}
+		return stmt
 	}
 
-	return p.parseExpressionStatement()
+	if expression := p.parseExpressionStatement(); expression != nil {
+		stmt = expression
+	}
+	return stmt
 
 }
 
@@ -145,6 +242,9 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		Token: p.currToken,
 		Value: p.currToken.Literal,
 	}
+	if !p.parseTypeAnnotation(stmt.Name) {
+		return nil
+	}
 
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
@@ -153,14 +253,153 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	p.nextToken()
 
 	stmt.Value = p.parseExpression(LOWEST)
+	nameFunctionLiteral(stmt.Value, stmt.Name.Value)
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
+	p.declare(stmt.Name.Value, false)
 	return stmt
 
 }
 
+func (p *Parser) parseConstStatement() *ast.ConstStatement {
+	stmt := &ast.ConstStatement{Token: p.currToken}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{
+		Token: p.currToken,
+		Value: p.currToken.Literal,
+	}
+	if !p.parseTypeAnnotation(stmt.Name) {
+		return nil
+	}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+	nameFunctionLiteral(stmt.Value, stmt.Name.Value)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	p.declare(stmt.Name.Value, true)
+	return stmt
+}
+
+// nameFunctionLiteral gives an anonymous function literal bound by let or
+// const the name it is bound to, so it shows up in Inspect and stack traces
+func nameFunctionLiteral(exp ast.Expression, name string) {
+	if fl, ok := exp.(*ast.FunctionLiteral); ok && fl.Name == "" {
+		fl.Name = name
+	}
+}
+
+func (p *Parser) parseFunctionStatement() ast.Statement {
+	stmt := &ast.FunctionStatement{Token: p.currToken}
+
+	p.nextToken()
+	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	p.declare(stmt.Name.Value, false)
+
+	stmt.Function = p.parseFunction(&ast.FunctionLiteral{Token: stmt.Token, Name: stmt.Name.Value})
+	if stmt.Function == nil {
+		return nil
+	}
+	return stmt
+}
+
+// parseTypeAnnotation parses the optional ': type' after a declared name
+// into ident. It reports false when the annotation is invalid.
+func (p *Parser) parseTypeAnnotation(ident *ast.Identifier) bool {
+	if !p.peekTokenIs(token.COLON) {
+		return true
+	}
+	p.nextToken()
+	p.nextToken()
+	ident.Type = p.parseType()
+	return ident.Type != nil
+}
+
+// parseType parses a type annotation starting at the current token:
+// int, string, bool, null, any, [T], {K: V} or fn(T, U): R
+func (p *Parser) parseType() ast.Type {
+	switch p.currToken.Type {
+	case token.IDENT:
+		switch p.currToken.Literal {
+		case "int", "string", "bool", "null", "any":
+			return &ast.NamedType{Token: p.currToken, Name: p.currToken.Literal}
+		}
+		msg := fmt.Sprintf("unknown type: %s", p.currToken.Literal)
+		p.errorAt(p.currToken, msg)
+		return nil
+
+	case token.LBRACKET:
+		array := &ast.ArrayType{Token: p.currToken}
+		p.nextToken()
+		if array.Element = p.parseType(); array.Element == nil {
+			return nil
+		}
+		if !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+		return array
+
+	case token.LBRACE:
+		hash := &ast.HashType{Token: p.currToken}
+		p.nextToken()
+		if hash.Key = p.parseType(); hash.Key == nil {
+			return nil
+		}
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+		if hash.Value = p.parseType(); hash.Value == nil {
+			return nil
+		}
+		if !p.expectPeek(token.RBRACE) {
+			return nil
+		}
+		return hash
+
+	case token.FUNCTION:
+		fn := &ast.FunctionType{Token: p.currToken, Parameters: []ast.Type{}}
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		for !p.peekTokenIs(token.RPAREN) {
+			p.nextToken()
+			param := p.parseType()
+			if param == nil {
+				return nil
+			}
+			fn.Parameters = append(fn.Parameters, param)
+			if !p.peekTokenIs(token.RPAREN) && !p.expectPeek(token.COMMA) {
+				return nil
+			}
+		}
+		p.nextToken()
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			p.nextToken()
+			if fn.Return = p.parseType(); fn.Return == nil {
+				return nil
+			}
+		}
+		return fn
+	}
+
+	msg := fmt.Sprintf("invalid type: %s", p.currToken.Literal)
+	p.errorAt(p.currToken, msg)
+	return nil
+}
+
 func (p *Parser) parseAssignStatement() *ast.AssignStatement {
 	stmt := &ast.AssignStatement{Token: p.currToken}
 
@@ -169,6 +408,11 @@ func (p *Parser) parseAssignStatement() *ast.AssignStatement {
 		Value: p.currToken.Literal,
 	}
 
+	if p.isConstant(stmt.Name.Value) {
+		msg := fmt.Sprintf("cannot assign to constant: %s", stmt.Name.Value)
+		p.errorAt(p.currToken, msg)
+	}
+
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
@@ -212,6 +456,37 @@ func (p *Parser) expectPeek(t token.Type) bool {
 	return false
 }
 
+func (p *Parser) openScope() {
+	p.scopes = append(p.scopes, map[string]bool{})
+}
+
+func (p *Parser) closeScope() {
+	p.scopes = p.scopes[:len(p.scopes)-1]
+}
+
+// declare records name in the innermost scope and reports a redeclaration
+func (p *Parser) declare(name string, constant bool) {
+	scope := p.scopes[len(p.scopes)-1]
+	if _, ok := scope[name]; ok {
+		msg := fmt.Sprintf("identifier already declared: %s", name)
+		p.errorAt(p.currToken, msg)
+		return
+	}
+	scope[name] = constant
+}
+
+// isConstant reports whether the nearest declaration of name is a const.
+// Names that were never declared are not constants as far as the parser
+// knows; they are reported by the evaluator instead.
+func (p *Parser) isConstant(name string) bool {
+	for i := len(p.scopes) - 1; i >= 0; i-- {
+		if constant, ok := p.scopes[i][name]; ok {
+			return constant
+		}
+	}
+	return false
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.currToken}
 	stmt.Expression = p.parseExpression(LOWEST)
@@ -269,7 +544,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 func (p *Parser) parseIntegerError() {
 	msg := fmt.Sprintf("cannot parse %q as integer value", p.currToken.Literal)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.currToken, msg)
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
@@ -284,7 +559,7 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 
 func (p *Parser) noPrefixParseFnError(t token.Token) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t.Type)
-	p.errors = append(p.errors, msg)
+	p.errorAt(t, msg)
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -351,15 +626,26 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
-	expression.Consequence = p.parseBlockStatement()
+	expression.Consequence = p.parseScopedBlockStatement()
 
 	if p.peekTokenIs(token.ELSE) {
 		p.nextToken()
+
+		// else if (...) { } is sugar for else { if (...) { } }
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+			block := &ast.BlockStatement{Token: p.currToken}
+			stmt := &ast.ExpressionStatement{Token: p.currToken}
+			stmt.Expression = p.parseIfExpression()
+			block.Statements = []ast.Statement{stmt}
+			expression.Alternative = block
+			return expression
+		}
+
 		if !p.expectPeek(token.LBRACE) {
 			return nil
 		}
-		expression.Alternative = p.parseBlockStatement()
-		p.nextToken()
+		expression.Alternative = p.parseScopedBlockStatement()
 	}
 
 	return expression
@@ -381,8 +667,259 @@ func (p *Parser) parseWhileStatement() ast.Statement {
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
-	stmt.Consequence = p.parseBlockStatement()
+	stmt.Consequence = p.parseLoopBody()
+
+	return stmt
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
+	if p.peekTokenIs(token.IDENT) {
+		return p.parseForInStatement()
+	}
+
+	stmt := &ast.ForStatement{
+		Token: p.currToken,
+	}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	// the init statement lives in a scope of its own which wraps every iteration
+	p.openScope()
+	defer p.closeScope()
+
+	p.nextToken()
+	if !p.currTokenIs(token.SEMICOLON) {
+		stmt.Init = p.parseStatement()
+		// let and assign statements already consume their trailing semicolon
+		if !p.currTokenIs(token.SEMICOLON) && !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	if !p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+		stmt.Condition = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+
+	if !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		stmt.Post = p.parseStatement()
+	}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+func (p *Parser) parseForInStatement() ast.Statement {
+	stmt := &ast.ForInStatement{
+		Token: p.currToken,
+	}
+	p.nextToken()
+	stmt.Variable = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	// the loop variable and the body share the scope of a single iteration
+	p.openScope()
+	defer p.closeScope()
+	p.declare(stmt.Variable.Value, false)
+
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+	stmt.Body = p.parseBlockStatement()
+
+	return stmt
+}
+
+// parseLoopBody parses the scoped body of a loop, in which break and continue are allowed
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+	return p.parseScopedBlockStatement()
+}
+
+func (p *Parser) parseThrowStatement() ast.Statement {
+	stmt := &ast.ThrowStatement{Token: p.currToken}
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseTryStatement() ast.Statement {
+	stmt := &ast.TryStatement{Token: p.currToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Block = p.parseScopedBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		// the caught error and the catch block share a scope
+		p.openScope()
+		defer p.closeScope()
+
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			stmt.Parameter = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+			p.declare(stmt.Parameter.Value, false)
+			if !p.expectPeek(token.RPAREN) {
+				return nil
+			}
+		}
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		stmt.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		stmt.Finally = p.parseScopedBlockStatement()
+	}
+
+	if stmt.Catch == nil && stmt.Finally == nil {
+		p.errorAt(stmt.Token, "try without catch or finally")
+	}
+
+	return stmt
+}
+
+// parseImportStatement parses both forms of import. 'as' and 'from' are not
+// keywords, they are only recognised in this position.
+func (p *Parser) parseImportStatement() ast.Statement {
+	stmt := &ast.ImportStatement{Token: p.currToken}
+	if len(p.scopes) > 1 {
+		p.errorAt(p.currToken, "import is only allowed at the top level")
+	}
+
+	if p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		for !p.peekTokenIs(token.RBRACE) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			stmt.Names = append(stmt.Names, &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal})
+			if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+				return nil
+			}
+		}
+		p.nextToken()
+		if !p.expectContextualKeyword("from") || !p.expectPeek(token.STRING) {
+			return nil
+		}
+		stmt.Path = p.currToken.Literal
+		for _, name := range stmt.Names {
+			p.declare(name.Value, true)
+		}
+	} else {
+		if !p.expectPeek(token.STRING) {
+			return nil
+		}
+		stmt.Path = p.currToken.Literal
+		if !p.expectContextualKeyword("as") || !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Alias = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+		p.declare(stmt.Alias.Value, true)
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// expectContextualKeyword advances over an identifier spelled like keyword
+func (p *Parser) expectContextualKeyword(keyword string) bool {
+	if p.peekTokenIs(token.IDENT) && p.peekToken.Literal == keyword {
+		p.nextToken()
+		return true
+	}
+	msg := fmt.Sprintf("expected next token to be %s, got %s (value=%s) instead", keyword, p.peekToken.Type, p.peekToken.Literal)
+	p.errorAt(p.peekToken, msg)
+	return false
+}
+
+func (p *Parser) parseExportStatement() ast.Statement {
+	stmt := &ast.ExportStatement{Token: p.currToken}
+	if len(p.scopes) > 1 {
+		p.errorAt(p.currToken, "export is only allowed at the top level")
+	}
+
+	p.nextToken()
+	switch {
+	case p.currTokenIs(token.LET):
+		if let := p.parseLetStatement(); let != nil {
+			stmt.Statement = let
+		}
+	case p.currTokenIs(token.CONST):
+		if constant := p.parseConstStatement(); constant != nil {
+			stmt.Statement = constant
+		}
+	case p.currTokenIs(token.FUNCTION) && p.peekTokenIs(token.IDENT):
+		stmt.Statement = p.parseFunctionStatement()
+	default:
+		msg := fmt.Sprintf("cannot export %s, only let, const and function declarations", p.currToken.Literal)
+		p.errorAt(p.currToken, msg)
+	}
+
+	if stmt.Statement == nil {
+		return nil
+	}
+	return stmt
+}
 
+func (p *Parser) parseBreakStatement() ast.Statement {
+	stmt := &ast.BreakStatement{Token: p.currToken}
+	if p.loopDepth == 0 {
+		p.errorAt(p.currToken, "break outside of loop")
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseContinueStatement() ast.Statement {
+	stmt := &ast.ContinueStatement{Token: p.currToken}
+	if p.loopDepth == 0 {
+		p.errorAt(p.currToken, "continue outside of loop")
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
 	return stmt
 }
 
@@ -396,31 +933,121 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	p.nextToken()
 
 	for !p.currTokenIs(token.RBRACE) && !p.currTokenIs(token.EOF) {
-		stmt := p.parseStatement()
-		block.Statements = append(block.Statements, stmt)
+		if stmt := p.parseStatement(); stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
 		p.nextToken()
 	}
+	if p.currTokenIs(token.EOF) {
+		p.errorAt(p.currToken, "expected } before the end of the input")
+	}
+	block.End = p.currToken
 	return block
 }
 
+// parseScopedBlockStatement parses a block that the evaluator runs in its own
+// enclosed environment, such as the branches of an if or the body of a while
+func (p *Parser) parseScopedBlockStatement() *ast.BlockStatement {
+	p.openScope()
+	defer p.closeScope()
+	return p.parseBlockStatement()
+}
+
 func (p *Parser) parseFunctionLiteral() ast.Expression {
-	lit := &ast.FunctionLiteral{Token: p.currToken}
+	lit := p.parseFunction(&ast.FunctionLiteral{Token: p.currToken})
+	if lit == nil {
+		return nil
+	}
+	return lit
+}
 
+// parseFunction parses the parameters and the body of lit, starting
+// right before the opening parenthesis of the parameter list
+func (p *Parser) parseFunction(lit *ast.FunctionLiteral) *ast.FunctionLiteral {
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
 
 	lit.Parameters = p.parseFunctionParameters()
+	if lit.Parameters == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		p.nextToken()
+		lit.ReturnType = p.parseType()
+		if lit.ReturnType == nil {
+			return nil
+		}
+	}
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
+	// parameters and the body share a single scope, just like the
+	// environment built by the evaluator when the function is applied
+	p.openScope()
+	defer p.closeScope()
+	for _, param := range lit.Parameters {
+		p.scopes[len(p.scopes)-1][param.Value] = false
+	}
+
+	// a function body starts outside of any loop, even when the
+	// function literal itself is written inside one
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	defer func() { p.loopDepth = loopDepth }()
+
 	lit.Body = p.parseBlockStatement()
+	markTailCalls(lit.Body, true)
 
 	return lit
 }
 
+// markTailCalls marks the calls of a function body whose value the function
+// returns: the last expression of the body, and the values of its return
+// statements. last tells whether the value of block is the one of the body.
+// Nested functions are marked when they are parsed.
+func markTailCalls(block *ast.BlockStatement, last bool) {
+	for i, stmt := range block.Statements {
+		tail := last && i == len(block.Statements)-1
+		switch stmt := stmt.(type) {
+		case *ast.ExpressionStatement:
+			markTailExpression(stmt.Expression, tail)
+		case *ast.ReturnStatement:
+			markTailExpression(stmt.Value, true)
+		case *ast.WhileStatement:
+			markTailCalls(stmt.Consequence, false)
+		case *ast.ForStatement:
+			markTailCalls(stmt.Body, false)
+		case *ast.ForInStatement:
+			markTailCalls(stmt.Body, false)
+		}
+		// a try statement is left alone, as its catch and finally blocks
+		// still have to run once the calls in it return
+	}
+}
+
+// markTailExpression marks exp when it is a call in tail position, and looks
+// for tail calls in the blocks of the if and match expressions
+func markTailExpression(exp ast.Expression, tail bool) {
+	switch exp := exp.(type) {
+	case *ast.CallExpression:
+		exp.Tail = tail
+	case *ast.IfExpression:
+		markTailCalls(exp.Consequence, tail)
+		if exp.Alternative != nil {
+			markTailCalls(exp.Alternative, tail)
+		}
+	case *ast.MatchExpression:
+		for _, arm := range exp.Arms {
+			markTailCalls(arm.Body, tail)
+		}
+	}
+}
+
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
 
@@ -429,15 +1056,25 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		return identifiers
 	}
 
-	p.nextToken()
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
 
 	ident := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	if !p.parseTypeAnnotation(ident) {
+		return nil
+	}
 	identifiers = append(identifiers, ident)
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
-		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
 		ident := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+		if !p.parseTypeAnnotation(ident) {
+			return nil
+		}
 		identifiers = append(identifiers, ident)
 	}
 
@@ -460,25 +1097,227 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseCallArguments() []ast.Expression {
-	args := []ast.Expression{}
+	return p.parseExpressionList(token.RPAREN)
+}
 
-	if p.peekTokenIs(token.RPAREN) {
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.currToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	return array
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.currToken, Left: left}
+
+	p.nextToken()
+	exp.Index = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	return exp
+}
+
+// parseExpressionList parses comma separated expressions up to the end token
+func (p *Parser) parseExpressionList(end token.Type) []ast.Expression {
+	list := []ast.Expression{}
+
+	if p.peekTokenIs(end) {
 		p.nextToken()
-		return args
+		return list
 	}
 
 	p.nextToken()
-
-	args = append(args, p.parseExpression(LOWEST))
+	list = append(list, p.parseExpression(LOWEST))
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST))
+		list = append(list, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+	return list
+}
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.currToken, Pairs: []ast.HashPair{}}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
 	}
 
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return hash
+}
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	expression.Subject = p.parseExpression(LOWEST)
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
-	return args
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) && !p.peekTokenIs(token.EOF) {
+		p.nextToken()
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		expression.Arms = append(expression.Arms, arm)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return expression
+}
+
+// parseMatchArm parses 'pattern => body'. The body is either a block or a
+// single expression, which is wrapped into a block of its own.
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	// names bound by the pattern are only visible inside the arm
+	p.openScope()
+	defer p.closeScope()
+
+	arm := &ast.MatchArm{Pattern: p.parsePattern()}
+	if arm.Pattern == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+	p.nextToken()
+
+	if p.currTokenIs(token.LBRACE) {
+		arm.Body = p.parseBlockStatement()
+		return arm
+	}
+
+	stmt := &ast.ExpressionStatement{Token: p.currToken}
+	stmt.Expression = p.parseExpression(LOWEST)
+	arm.Body = &ast.BlockStatement{Token: stmt.Token, Statements: []ast.Statement{stmt}}
+	return arm
+}
+
+// parsePattern parses the pattern of a match arm. Literals are compared with
+// the value, identifiers bind it and array and hash literals destructure it.
+func (p *Parser) parsePattern() ast.Expression {
+	switch p.currToken.Type {
+	case token.INT:
+		return p.parseIntegerLiteral()
+	case token.STRING:
+		return p.parseStringLiteral()
+	case token.TRUE, token.FALSE:
+		return p.parseBoolean()
+	case token.MINUS:
+		if !p.expectPeek(token.INT) {
+			return nil
+		}
+		lit := p.parseIntegerLiteral().(*ast.IntegerLiteral)
+		lit.Value = -lit.Value
+		lit.Token.Literal = "-" + lit.Token.Literal
+		return lit
+	case token.IDENT:
+		ident := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+		if ident.Value != "_" {
+			p.declare(ident.Value, false)
+		}
+		return ident
+	case token.LBRACKET:
+		array := &ast.ArrayLiteral{Token: p.currToken, Elements: []ast.Expression{}}
+		for !p.peekTokenIs(token.RBRACKET) {
+			p.nextToken()
+			element := p.parsePattern()
+			if element == nil {
+				return nil
+			}
+			array.Elements = append(array.Elements, element)
+			if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+				return nil
+			}
+		}
+		p.nextToken()
+		return array
+	case token.LBRACE:
+		hash := &ast.HashLiteral{Token: p.currToken, Pairs: []ast.HashPair{}}
+		for !p.peekTokenIs(token.RBRACE) {
+			p.nextToken()
+			var key ast.Expression
+			switch p.currToken.Type {
+			case token.STRING:
+				key = p.parseStringLiteral()
+			case token.INT:
+				key = p.parseIntegerLiteral()
+			case token.TRUE, token.FALSE:
+				key = p.parseBoolean()
+			default:
+				p.invalidPatternError()
+				return nil
+			}
+			if !p.expectPeek(token.COLON) {
+				return nil
+			}
+			p.nextToken()
+			value := p.parsePattern()
+			if value == nil {
+				return nil
+			}
+			hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+			if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+				return nil
+			}
+		}
+		p.nextToken()
+		return hash
+	}
+
+	p.invalidPatternError()
+	return nil
+}
+
+func (p *Parser) invalidPatternError() {
+	msg := fmt.Sprintf("invalid pattern: %s", p.currToken.Literal)
+	p.errorAt(p.currToken, msg)
+}
+
+func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: p.currToken, Object: left}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	exp.Property = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	return exp
 }
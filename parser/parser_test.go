@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -685,3 +687,663 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 
 }
+
+func TestConstStatements(t *testing.T) {
+	input := `const x = 5;`
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statments does not contain 1 statement. got %d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ConstStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ConstStatement. got=%T", program.Statements[0])
+	}
+
+	if stmt.Name.Value != "x" {
+		t.Errorf("stmt.Name.Value not %s, got=%s", "x", stmt.Name.Value)
+	}
+
+	testIntegerLiteral(t, stmt.Value, 5)
+}
+
+func TestBindingErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"const x = 5; x = 6;", "cannot assign to constant: x"},
+		{"let x = 5; let x = 6;", "identifier already declared: x"},
+		{"const x = 5; let x = 6;", "identifier already declared: x"},
+		{"fn(x) { let x = 1; }", "identifier already declared: x"},
+		{"const x = 5; if (true) { x = 6; }", "cannot assign to constant: x"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("input %q: expected 1 parser error, got=%v", tt.input, errors)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("input %q: wrong error. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+
+	valid := []string{
+		"let x = 5; if (true) { let x = 6; }",
+		"const x = 5; if (true) { let x = 6; x = 7; }",
+		"let x = 5; fn(x) { x = 2; }",
+	}
+	for _, input := range valid {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		checkParserErrors(t, p)
+	}
+}
+
+func TestForStatementParsing(t *testing.T) {
+	input := `for (let i = 0; i < 10; i = i + 1) { i }`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ForStatement. got=%T", program.Statements[0])
+	}
+
+	if !testLetStatement(t, stmt.Init, "i") {
+		return
+	}
+	if !testInfixExpression(t, stmt.Condition, "i", "<", 10) {
+		return
+	}
+	if !testAssignStatement(t, stmt.Post, "i") {
+		return
+	}
+	if len(stmt.Body.Statements) != 1 {
+		t.Errorf("body is not 1 statement. got=%d", len(stmt.Body.Statements))
+	}
+}
+
+func TestForInStatementParsing(t *testing.T) {
+	input := `for x in [1, 2 * 2] { x; }`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ForInStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ForInStatement. got=%T", program.Statements[0])
+	}
+
+	if !testIdentifier(t, stmt.Variable, "x") {
+		return
+	}
+
+	array, ok := stmt.Iterable.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("stmt.Iterable is not *ast.ArrayLiteral. got=%T", stmt.Iterable)
+	}
+	if len(array.Elements) != 2 {
+		t.Fatalf("len(array.Elements) not 2. got=%d", len(array.Elements))
+	}
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+}
+
+func TestIndexExpressionParsing(t *testing.T) {
+	input := "myArray[1 + 1]"
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, _ := program.Statements[0].(*ast.ExpressionStatement)
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+	testInfixExpression(t, indexExp.Index, 1, "+", 1)
+}
+
+func TestLoopControlParsing(t *testing.T) {
+	tests := []struct {
+		input  string
+		errors []string
+	}{
+		{"while (true) { break; }", nil},
+		{"for x in [1] { if (x) { continue; } }", nil},
+		{"break;", []string{"break outside of loop"}},
+		{"if (true) { continue }", []string{"continue outside of loop"}},
+		{"while (true) { fn() { break; } }", []string{"break outside of loop"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.errors) {
+			t.Errorf("input %q: expected errors %v, got=%v", tt.input, tt.errors, errors)
+			continue
+		}
+		for i, msg := range tt.errors {
+			if errors[i] != msg {
+				t.Errorf("input %q: wrong error. expected=%q, got=%q", tt.input, msg, errors[i])
+			}
+		}
+	}
+}
+
+func TestElseIfParsing(t *testing.T) {
+	input := `if (x < y) { x } else if (x > y) { y } else { z }`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not *ast.IfExpression. got=%T", stmt.Expression)
+	}
+
+	if len(exp.Alternative.Statements) != 1 {
+		t.Fatalf("alternative is not 1 statement. got=%d", len(exp.Alternative.Statements))
+	}
+
+	nested, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("alternative is not an *ast.IfExpression. got=%T", exp.Alternative.Statements[0])
+	}
+	if !testInfixExpression(t, nested.Condition, "x", ">", "y") {
+		return
+	}
+	if nested.Alternative == nil {
+		t.Fatalf("nested.Alternative is nil")
+	}
+}
+
+func TestHashLiteralParsing(t *testing.T) {
+	input := `{"one": 1, "two": 2}`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not *ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	expected := []struct {
+		key   string
+		value int64
+	}{
+		{`"one"`, 1},
+		{`"two"`, 2},
+	}
+	if len(hash.Pairs) != len(expected) {
+		t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+	for i, pair := range hash.Pairs {
+		if pair.Key.String() != expected[i].key {
+			t.Errorf("key is not %q. got=%q", expected[i].key, pair.Key.String())
+		}
+		testIntegerLiteral(t, pair.Value, expected[i].value)
+	}
+}
+
+func TestMatchExpressionParsing(t *testing.T) {
+	input := `match (x) { 1 => "one", [a, _] => a, {"k": v} => { v }, _ => 0 }`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not *ast.MatchExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Subject, "x") {
+		return
+	}
+
+	patterns := []string{`1`, `[a, _]`, `{"k": v}`, `_`}
+	if len(exp.Arms) != len(patterns) {
+		t.Fatalf("wrong number of arms. got=%d", len(exp.Arms))
+	}
+	for i, arm := range exp.Arms {
+		if arm.Pattern.String() != patterns[i] {
+			t.Errorf("arm %d: wrong pattern. expected=%q, got=%q", i, patterns[i], arm.Pattern.String())
+		}
+		if len(arm.Body.Statements) != 1 {
+			t.Errorf("arm %d: body is not 1 statement. got=%d", i, len(arm.Body.Statements))
+		}
+	}
+}
+
+func TestMatchExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match (x) { x + 1 => 1 }", "expected next token to be =>, got + (value=+) instead"},
+		{"match (x) { fn => 1 }", "invalid pattern: fn"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("input %q: expected parser error %q", tt.input, tt.expected)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("input %q: wrong error. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+
+	p := New(lexer.New("match (x) { true => 1 }"))
+	p.ParseProgram()
+	checkParserErrors(t, p)
+}
+
+func TestTryStatementParsing(t *testing.T) {
+	tests := []struct {
+		input      string
+		parameter  string
+		hasCatch   bool
+		hasFinally bool
+	}{
+		{"try { x } catch (e) { e }", "e", true, false},
+		{"try { x } catch { 1 }", "", true, false},
+		{"try { x } finally { 1 }", "", false, true},
+		{"try { x } catch (err) { err } finally { 1 }", "err", true, true},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.TryStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.TryStatement. got=%T", program.Statements[0])
+		}
+
+		if tt.parameter == "" && stmt.Parameter != nil {
+			t.Errorf("input %q: expected no parameter. got=%s", tt.input, stmt.Parameter)
+		}
+		if tt.parameter != "" {
+			testIdentifier(t, stmt.Parameter, tt.parameter)
+		}
+		if (stmt.Catch != nil) != tt.hasCatch {
+			t.Errorf("input %q: wrong catch block. got=%v", tt.input, stmt.Catch)
+		}
+		if (stmt.Finally != nil) != tt.hasFinally {
+			t.Errorf("input %q: wrong finally block. got=%v", tt.input, stmt.Finally)
+		}
+	}
+
+	p := New(lexer.New("try { x }"))
+	p.ParseProgram()
+	if len(p.Errors()) != 1 || p.Errors()[0] != "try without catch or finally" {
+		t.Errorf("expected missing catch error. got=%v", p.Errors())
+	}
+}
+
+func TestThrowStatementParsing(t *testing.T) {
+	p := New(lexer.New(`throw "boom";`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ThrowStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Value.String() != `"boom"` {
+		t.Errorf("wrong thrown value. got=%s", stmt.Value.String())
+	}
+}
+
+func TestFunctionStatementParsing(t *testing.T) {
+	input := `fn add(a, b) { a + b }`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.FunctionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.FunctionStatement. got=%T", program.Statements[0])
+	}
+
+	if !testIdentifier(t, stmt.Name, "add") {
+		return
+	}
+	if stmt.Function.Name != "add" {
+		t.Errorf("function literal has wrong name. got=%q", stmt.Function.Name)
+	}
+	if len(stmt.Function.Parameters) != 2 {
+		t.Fatalf("function has wrong parameters. got=%d", len(stmt.Function.Parameters))
+	}
+	testLiteralExpression(t, stmt.Function.Parameters[0], "a")
+	testLiteralExpression(t, stmt.Function.Parameters[1], "b")
+}
+
+func TestFunctionLiteralNaming(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let square = fn(x) { x * x };", "square"},
+		{"const half = fn(x) { x / 2 };", "half"},
+		{"fn(x) { x };", ""},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		var value ast.Expression
+		switch stmt := program.Statements[0].(type) {
+		case *ast.LetStatement:
+			value = stmt.Value
+		case *ast.ConstStatement:
+			value = stmt.Value
+		case *ast.ExpressionStatement:
+			value = stmt.Expression
+		}
+
+		fn, ok := value.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("value is not *ast.FunctionLiteral. got=%T", value)
+		}
+		if fn.Name != tt.expected {
+			t.Errorf("input %q: wrong function name. expected=%q, got=%q", tt.input, tt.expected, fn.Name)
+		}
+	}
+}
+
+func TestImportStatementParsing(t *testing.T) {
+	tests := []struct {
+		input string
+		path  string
+		alias string
+		names []string
+	}{
+		{`import "lib/math.monkey" as math;`, "lib/math.monkey", "math", nil},
+		{`import { add, sub } from "lib/math.monkey"`, "lib/math.monkey", "", []string{"add", "sub"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ImportStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.ImportStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Path != tt.path {
+			t.Errorf("wrong path. expected=%q, got=%q", tt.path, stmt.Path)
+		}
+		if tt.alias != "" {
+			testIdentifier(t, stmt.Alias, tt.alias)
+		}
+		if len(stmt.Names) != len(tt.names) {
+			t.Fatalf("wrong number of names. expected=%d, got=%d", len(tt.names), len(stmt.Names))
+		}
+		for i, name := range tt.names {
+			testIdentifier(t, stmt.Names[i], name)
+		}
+	}
+}
+
+func TestExportStatementParsing(t *testing.T) {
+	input := `export let a = 1; export const b = 2; export fn c() { 3 }`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	names := []string{"a", "b", "c"}
+	if len(program.Statements) != len(names) {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d", len(names), len(program.Statements))
+	}
+	for i, name := range names {
+		stmt, ok := program.Statements[i].(*ast.ExportStatement)
+		if !ok {
+			t.Fatalf("program.Statements[%d] is not *ast.ExportStatement. got=%T", i, program.Statements[i])
+		}
+		if stmt.Name() != name {
+			t.Errorf("wrong exported name. expected=%q, got=%q", name, stmt.Name())
+		}
+	}
+}
+
+func TestModuleErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`if (true) { export let a = 1; }`, "export is only allowed at the top level"},
+		{`fn f() { import "x" as x }`, "import is only allowed at the top level"},
+		{`export 5`, "cannot export 5, only let, const and function declarations"},
+		{`import "x" to y`, "expected next token to be as, got IDENT (value=to) instead"},
+		{`import "x" as y; y = 1`, "cannot assign to constant: y"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("input %q: expected error %q, got=%v", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestMemberExpressionParsing(t *testing.T) {
+	p := New(lexer.New("math.add(1, 2)"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	call, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not *ast.CallExpression. got=%T", stmt.Expression)
+	}
+
+	member, ok := call.Function.(*ast.MemberExpression)
+	if !ok {
+		t.Fatalf("call.Function is not *ast.MemberExpression. got=%T", call.Function)
+	}
+	testIdentifier(t, member.Object, "math")
+	testIdentifier(t, member.Property, "add")
+}
+
+func TestTypeAnnotationParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: int = 1;", "let x: int = 1;"},
+		{"const names: [string] = [];", "const names: [string] = [];"},
+		{"let h: {string: [int]} = {};", "let h: {string: [int]} = {};"},
+		{"let f: fn(int, any): bool = g;", "let f: fn(int, any): bool = g;"},
+		{"let f: fn() = g;", "let f: fn() = g;"},
+		{"fn add(a: int, b: int): int { a + b }", "fn add(a: int, b: int): int { (a + b) }"},
+		{"let f = fn(a: string, b): null { puts(a) };", "let f = fn(a: string, b): null { puts(a) };"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("input %q: expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestTypeAnnotationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: foo = 1;", "unknown type: foo"},
+		{"let x: 5 = 1;", "invalid type: 5"},
+		{"fn f(a: [int) {}", "expected next token to be ], got ) (value=)) instead"},
+		{"let f = fn(): {string} { 1 };", "expected next token to be :, got } (value=}) instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("input %q: expected error %q, got=%v", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x 5;", "1:7: expected next token to be =, got INT (value=5) instead"},
+		{"let x = 1;\n  let = 2;", "2:7: expected next token to be IDENT, got = (value==) instead"},
+		{"1 +\n;", "2:1: no prefix parse function for ; found"},
+		{"while (true) {}\nbreak;", "2:1: break outside of loop"},
+		{"try { 1 }", "1:1: try without catch or finally"},
+		{"fn f(a, 1) {}", "1:9: expected next token to be IDENT, got INT (value=1) instead"},
+		{"if (x) {\n  1", "2:4: expected } before the end of the input"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.PositionedErrors()
+		if len(errors) == 0 {
+			t.Errorf("input %q: expected an error", tt.input)
+			continue
+		}
+		got := fmt.Sprintf("%d:%d: %s", errors[0].Line, errors[0].Column, errors[0].Message)
+		if got != tt.expected {
+			t.Errorf("input %q: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestInvalidStatementsAreDropped(t *testing.T) {
+	p := New(lexer.New("let = 1; let y = 2; fn f() { let = 3; y }"))
+	program := p.ParseProgram()
+
+	for _, stmt := range program.Statements {
+		if stmt == nil || reflect.ValueOf(stmt).IsNil() {
+			t.Fatalf("program contains a nil statement: %#v", program.Statements)
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the tail calls, in order
+	}{
+		{`fn f() { a(); b() }`, `b()`},
+		{`fn f() { if (x) { a() } else if (y) { b() } else { c(d()) } }`, `a() b() c(d())`},
+		{`fn f() { if (x) { return a() } b() + c() }`, `a()`},
+		{`fn f() { while (x) { a(); return b() } for y in z { return c() } }`, `b() c()`},
+		{`fn f() { match (x) { 1 => a(), _ => { b(); c() } } }`, `a() c()`},
+		{`fn f() { try { return a() } catch (e) { b() } }`, ``},
+		{`fn f() { let g = fn() { a() }; g }`, `a()`},
+		{`a(); fn f() { [b()] }`, ``},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		calls := []string{}
+		ast.Inspect(program, func(node ast.Node) bool {
+			if call, ok := node.(*ast.CallExpression); ok && call.Tail {
+				calls = append(calls, call.String())
+			}
+			return true
+		})
+		if got := strings.Join(calls, " "); got != tt.expected {
+			t.Errorf("input %q: expected the tail calls %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// FuzzParseProgram checks that the parser never panics, and that the String
+// of a program it parses without errors is parsed back to the same program
+func FuzzParseProgram(f *testing.F) {
+	for _, seed := range []string{
+		"a; b; -c",
+		"if (x) { 1 } else if (y) { 2 } else { 3 }(4)",
+		"for (let i = 0; i < 3; i = i + 1) { continue; }",
+		"for (;;) { break }",
+		"try { throw \"x\" } catch (e) { e } finally { 1 }",
+		"match (x) { -1 => 1, [a, _] => { a; a }, {\"k\": v} => v, _ => 0 }",
+		"export fn f(a: int, b: [string]): {string: fn(int): bool} { a }",
+		"import { a, b } from \"m\"; import \"n\" as n; n.x(a)[b]",
+		"let f = fn() { fn g() {} g }",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return
+		}
+
+		printed := program.String()
+		p = New(lexer.New(printed))
+		again := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("%q is printed as %q, which does not parse: %v", input, printed, p.Errors())
+		}
+		if again.String() != printed {
+			t.Fatalf("%q is printed as %q, which is parsed to %q", input, printed, again.String())
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"monkey/object"
+	"strings"
+)
+
+const defaultOuput = "No Result. Code executed successfully."
+
+func printParserErrors(errors []string) string {
+	return printErrors("parser", errors)
+}
+
+// printResolverErrors prints the errors found by the resolver, which stop
+// the program from running just like parser errors
+func printResolverErrors(errors []string) string {
+	return printErrors("resolver", errors)
+}
+
+func printErrors(stage string, errors []string) string {
+	out := strings.Builder{}
+	out.WriteString("Woops! We ran into some monkey business here!\n")
+	out.WriteString(" " + stage + " errors:\n")
+	for _, msg := range errors {
+		out.WriteString("\t" + msg + "\n")
+	}
+	return out.String()
+}
+
+// printRuntimeError prints the error a program stopped with, and points out
+// the internal errors, which the program is not to blame for
+func printRuntimeError(err *object.Error) string {
+	out := strings.Builder{}
+	out.WriteString(err.Inspect())
+	for _, frame := range err.PrintedStack() {
+		out.WriteString("\n\tat " + frame)
+	}
+	if err.Kind == object.InternalError {
+		out.WriteString("\nThis is a bug of the interpreter, not of the program. Please report it.")
+	}
+	return out.String()
+}
+
+// printPanic prints a panic recovered outside of the evaluator, which
+// recovers its own, as an internal error
+func printPanic(r any) string {
+	return printRuntimeError(&object.Error{Kind: object.InternalError, Message: fmt.Sprint(r)})
+}
@@ -0,0 +1,235 @@
+package profile
+
+import (
+	"compress/gzip"
+	"io"
+	"sort"
+)
+
+// The profile is written as the gzipped protocol buffer go tool pprof reads,
+// described by profile.proto in github.com/google/pprof. Only the fields
+// below are written, with the numbers they have in it.
+const (
+	profileSampleType        = 1
+	profileSample            = 2
+	profileMapping           = 3
+	profileLocation          = 4
+	profileFunction          = 5
+	profileStringTable       = 6
+	profileTimeNanos         = 9
+	profileDurationNanos     = 10
+	profilePeriodType        = 11
+	profilePeriod            = 12
+	profileDefaultSampleType = 14
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	mappingID             = 1
+	mappingFilename       = 5
+	mappingHasFunctions   = 7
+	mappingHasFilenames   = 8
+	mappingHasLineNumbers = 9
+
+	locationID        = 1
+	locationMappingID = 2
+	locationLine      = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+	functionStartLine  = 5
+)
+
+// WritePprof writes the call stacks of the program to w in the pprof format.
+// Every stack has two values: count, the number of times the program
+// entered it, and time, the nanoseconds spent in it.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	e := &encoder{strings: map[string]int64{"": 0}, table: []string{""}}
+	e.valueType(profileSampleType, "count", "count")
+	e.valueType(profileSampleType, "time", "nanoseconds")
+
+	locations := map[location]uint64{}
+	functions := map[*Function]uint64{}
+	var walk func(n *node, stack []uint64)
+	walk = func(n *node, stack []uint64) {
+		for _, child := range sortedChildren(n) {
+			id, ok := locations[child.location]
+			if !ok {
+				id = uint64(len(locations) + 1)
+				locations[child.location] = id
+				e.location(id, child.location, functions)
+			}
+			// pprof stacks start with the innermost location
+			childStack := append([]uint64{id}, stack...)
+			if child.count != 0 || child.time != 0 {
+				e.sample(childStack, child.count, int64(child.time))
+			}
+			walk(child, childStack)
+		}
+	}
+	walk(p.root, nil)
+
+	var mapping buffer
+	mapping.uint(mappingID, 1)
+	mapping.int(mappingFilename, e.string("monkey"))
+	mapping.bool(mappingHasFunctions, true)
+	mapping.bool(mappingHasFilenames, true)
+	mapping.bool(mappingHasLineNumbers, true)
+	e.profile.message(profileMapping, mapping)
+
+	e.profile.int(profileTimeNanos, p.start.UnixNano())
+	e.profile.int(profileDurationNanos, int64(p.duration))
+	e.valueType(profilePeriodType, "time", "nanoseconds")
+	e.profile.int(profilePeriod, 1)
+	e.profile.int(profileDefaultSampleType, e.string("time"))
+	// every string is in the table once the other fields are encoded
+	for _, s := range e.table {
+		e.profile.bytes(profileStringTable, []byte(s))
+	}
+
+	z := gzip.NewWriter(w)
+	if _, err := z.Write(e.profile); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// sortedChildren returns the children of n in the order of their lines, for
+// the profile of a program to always be the same
+func sortedChildren(n *node) []*node {
+	children := make([]*node, 0, len(n.children))
+	for _, child := range n.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		a, b := children[i].location, children[j].location
+		if a.function != b.function {
+			if a.function.Module != b.function.Module {
+				return a.function.Module < b.function.Module
+			}
+			if a.function.Line != b.function.Line {
+				return a.function.Line < b.function.Line
+			}
+			return a.function.Name < b.function.Name
+		}
+		return a.line < b.line
+	})
+	return children
+}
+
+// encoder builds the message of a profile, and its table of strings
+type encoder struct {
+	profile buffer
+	strings map[string]int64
+	table   []string
+}
+
+// string returns the index of s in the table of strings
+func (e *encoder) string(s string) int64 {
+	i, ok := e.strings[s]
+	if !ok {
+		i = int64(len(e.table))
+		e.strings[s] = i
+		e.table = append(e.table, s)
+	}
+	return i
+}
+
+func (e *encoder) valueType(field int, typ, unit string) {
+	var b buffer
+	b.int(valueTypeType, e.string(typ))
+	b.int(valueTypeUnit, e.string(unit))
+	e.profile.message(field, b)
+}
+
+func (e *encoder) sample(stack []uint64, count, nanoseconds int64) {
+	var b buffer
+	b.packed(sampleLocationID, stack)
+	b.packed(sampleValue, []uint64{uint64(count), uint64(nanoseconds)})
+	e.profile.message(profileSample, b)
+}
+
+func (e *encoder) location(id uint64, l location, functions map[*Function]uint64) {
+	function, ok := functions[l.function]
+	if !ok {
+		function = uint64(len(functions) + 1)
+		functions[l.function] = function
+		var f buffer
+		f.uint(functionID, function)
+		f.int(functionName, e.string(l.function.Name))
+		f.int(functionSystemName, e.string(l.function.Name))
+		f.int(functionFilename, e.string(l.function.Module))
+		f.int(functionStartLine, int64(l.function.Line))
+		e.profile.message(profileFunction, f)
+	}
+
+	var line buffer
+	line.uint(lineFunctionID, function)
+	line.int(lineLine, int64(l.line))
+	var b buffer
+	b.uint(locationID, id)
+	b.uint(locationMappingID, 1)
+	b.message(locationLine, line)
+	e.profile.message(profileLocation, b)
+}
+
+// buffer is an encoded protocol buffer message. Fields set to their zero
+// value are left out, as the format allows.
+type buffer []byte
+
+func (b *buffer) varint(v uint64) {
+	for v >= 0x80 {
+		*b = append(*b, byte(v)|0x80)
+		v >>= 7
+	}
+	*b = append(*b, byte(v))
+}
+
+// key writes the key of field, whose wire type is 0 for varints and 2 for
+// bytes
+func (b *buffer) key(field int, wireType uint64) {
+	b.varint(uint64(field)<<3 | wireType)
+}
+
+func (b *buffer) uint(field int, v uint64) {
+	if v != 0 {
+		b.key(field, 0)
+		b.varint(v)
+	}
+}
+
+func (b *buffer) int(field int, v int64) {
+	b.uint(field, uint64(v))
+}
+
+func (b *buffer) bool(field int, v bool) {
+	if v {
+		b.uint(field, 1)
+	}
+}
+
+func (b *buffer) bytes(field int, v []byte) {
+	b.key(field, 2)
+	b.varint(uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+func (b *buffer) message(field int, m buffer) {
+	b.bytes(field, m)
+}
+
+func (b *buffer) packed(field int, values []uint64) {
+	var p buffer
+	for _, v := range values {
+		p.varint(v)
+	}
+	b.bytes(field, p)
+}
@@ -0,0 +1,295 @@
+// Package profile measures where Monkey programs spend their time. A
+// Profiler counts the calls of every function and the statements of every
+// line with the time they took, and writes the call stacks it saw in the
+// pprof format, so that go tool pprof shows Monkey functions and lines.
+package profile
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"sort"
+	"time"
+)
+
+// Function is the profile of a Monkey function
+type Function struct {
+	// Name is the name of the function, anonymous@line for an anonymous
+	// function starting on line
+	Name string
+	// Module, Line and Column are where the body of the function starts,
+	// every function defined there shares the profile
+	Module string
+	Line   int
+	Column int
+	Calls  int64
+	// Time is the time spent in the calls of the function, the functions
+	// they call included. A recursive call is only counted once. A call in
+	// tail position replaces the call making it, so its time goes to the
+	// caller of that call instead.
+	Time time.Duration
+
+	active int
+	since  time.Time
+}
+
+// Line is the profile of a line of a module
+type Line struct {
+	Module string
+	Line   int
+	// Count is the number of statements starting on the line that ran
+	Count int64
+	// Time is the time spent running these statements, the functions they
+	// call included
+	Time time.Duration
+
+	active int
+	since  time.Time
+}
+
+type lineKey struct {
+	module string
+	line   int
+}
+
+// Profiler is a Hook profiling the program it runs
+type Profiler struct {
+	// now returns the current time, tests replace it
+	now      func() time.Time
+	start    time.Time
+	duration time.Duration
+
+	functions map[*ast.BlockStatement]*Function
+	// modules holds the functions standing for the top level code of
+	// modules in call stacks
+	modules map[string]*Function
+	main    string
+	lines   map[lineKey]*Line
+	starts  map[ast.Node]int
+
+	// stacks records the time spent in every call stack. frames holds the
+	// function of every call in progress, nil for top level code, and
+	// bases the node the locations of each call hang from.
+	root    *node
+	current *node
+	frames  []*Function
+	bases   []*node
+	last    time.Time
+}
+
+// node is a location in a tree of call stacks, the stack being the path
+// from the root to it
+type node struct {
+	location location
+	children map[location]*node
+	// count is the number of times the stack was entered and time the time
+	// spent in it, and not in its children
+	count int64
+	time  time.Duration
+}
+
+// location is a line of a function
+type location struct {
+	function *Function
+	line     int
+}
+
+func (n *node) child(l location) *node {
+	if n.children == nil {
+		n.children = map[location]*node{}
+	}
+	child, ok := n.children[l]
+	if !ok {
+		child = &node{location: l}
+		n.children[l] = child
+	}
+	return child
+}
+
+// New returns a profiler, ready to run a program
+func New() *Profiler {
+	root := &node{}
+	return &Profiler{
+		now:       time.Now,
+		functions: map[*ast.BlockStatement]*Function{},
+		modules:   map[string]*Function{},
+		lines:     map[lineKey]*Line{},
+		starts:    map[ast.Node]int{},
+		root:      root,
+		current:   root,
+		frames:    []*Function{nil},
+		bases:     []*node{root},
+	}
+}
+
+// Run evaluates program in env under the profiler
+func (p *Profiler) Run(program *ast.Program, env *object.Environment) object.Object {
+	p.main = env.Module()
+	p.start = p.now()
+	p.last = p.start
+	result := evaluator.EvalWithHook(program, env, p)
+	p.charge()
+	p.duration = p.last.Sub(p.start)
+	return result
+}
+
+// Functions returns the profiles of the functions that were called, the
+// most time consuming first
+func (p *Profiler) Functions() []*Function {
+	functions := make([]*Function, 0, len(p.functions))
+	for _, f := range p.functions {
+		functions = append(functions, f)
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		if functions[i].Time != functions[j].Time {
+			return functions[i].Time > functions[j].Time
+		}
+		return before(functions[i].Module, functions[i].Line, functions[j].Module, functions[j].Line)
+	})
+	return functions
+}
+
+// Lines returns the profiles of the lines that ran, in the order of the
+// source
+func (p *Profiler) Lines() []*Line {
+	lines := make([]*Line, 0, len(p.lines))
+	for _, l := range p.lines {
+		lines = append(lines, l)
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		return before(lines[i].Module, lines[i].Line, lines[j].Module, lines[j].Line)
+	})
+	return lines
+}
+
+func before(moduleA string, lineA int, moduleB string, lineB int) bool {
+	if moduleA != moduleB {
+		return moduleA < moduleB
+	}
+	return lineA < lineB
+}
+
+// charge adds the time since the last event to the current call stack
+func (p *Profiler) charge() time.Time {
+	now := p.now()
+	p.current.time += now.Sub(p.last)
+	p.last = now
+	return now
+}
+
+func (p *Profiler) Before(node ast.Node, env *object.Environment) *object.Error {
+	if !ast.RunsCode(node) {
+		return nil
+	}
+	now := p.charge()
+	line := p.line(node)
+
+	key := lineKey{module: env.Module(), line: line}
+	l, ok := p.lines[key]
+	if !ok {
+		l = &Line{Module: key.module, Line: key.line}
+		p.lines[key] = l
+	}
+	l.Count++
+	if l.active == 0 {
+		l.since = now
+	}
+	l.active++
+
+	function := p.frames[len(p.frames)-1]
+	if function == nil {
+		function = p.module(env.Module())
+	}
+	p.current = p.bases[len(p.bases)-1].child(location{function: function, line: line})
+	p.current.count++
+	return nil
+}
+
+func (p *Profiler) After(node ast.Node, env *object.Environment, result object.Object) {
+	if !ast.RunsCode(node) {
+		return
+	}
+	l := p.lines[lineKey{module: env.Module(), line: p.line(node)}]
+	l.active--
+	if l.active == 0 {
+		l.Time += p.now().Sub(l.since)
+	}
+}
+
+func (p *Profiler) Call(fn *object.Function, args []object.Object) {
+	now := p.charge()
+	f, ok := p.functions[fn.Body]
+	if !ok {
+		f = &Function{
+			Name:   displayName(fn),
+			Module: fn.Env.Module(),
+			Line:   fn.Body.Token.Line,
+			Column: fn.Body.Token.Column,
+		}
+		p.functions[fn.Body] = f
+	}
+	f.Calls++
+	if f.active == 0 {
+		f.since = now
+	}
+	f.active++
+
+	p.frames = append(p.frames, f)
+	p.bases = append(p.bases, p.current)
+	p.current = p.current.child(location{function: f, line: f.Line})
+	p.current.count++
+}
+
+func (p *Profiler) Return(fn *object.Function, result object.Object) {
+	now := p.charge()
+	f := p.frames[len(p.frames)-1]
+	f.active--
+	if f.active == 0 {
+		f.Time += now.Sub(f.since)
+	}
+
+	p.current = p.bases[len(p.bases)-1]
+	p.frames = p.frames[:len(p.frames)-1]
+	p.bases = p.bases[:len(p.bases)-1]
+}
+
+// NestTailCalls lets tail calls replace their caller, so that a profiled
+// program runs in the stack it runs in without the profiler
+func (p *Profiler) NestTailCalls() bool { return false }
+
+// line returns the line statement starts on, lines are remembered as they
+// are costly to compute and loops run the same statements again
+func (p *Profiler) line(statement ast.Node) int {
+	line, ok := p.starts[statement]
+	if !ok {
+		line = ast.SpanOf(statement).Start.Line
+		p.starts[statement] = line
+	}
+	return line
+}
+
+// module returns the function standing for the top level code of a module,
+// named main for the program and after its path for the others
+func (p *Profiler) module(path string) *Function {
+	f, ok := p.modules[path]
+	if !ok {
+		name := path
+		if path == p.main {
+			name = "main"
+		}
+		f = &Function{Name: name, Module: path}
+		p.modules[path] = f
+	}
+	return f
+}
+
+// displayName returns the name of fn, anonymous functions are named after
+// the line they start on. The names of pprof leave out what is in angle
+// brackets, as it does for C++ templates, so <anonymous> cannot be used.
+func displayName(fn *object.Function) string {
+	if fn.Name == "" {
+		return fmt.Sprintf("anonymous@%d", fn.Body.Token.Line)
+	}
+	return fn.Name
+}
@@ -0,0 +1,248 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/resolver"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const program = `fn fib(n) {
+	if (n < 2) { return n; }
+	fib(n - 1) + fib(n - 2)
+}
+let twice = fn(f, x) { f(f(x)) };
+let i = 0;
+while (i < 3) {
+	i = i + 1;
+}
+twice(fn(x) { x + fib(i) }, 1)`
+
+// run profiles input with a clock moving one millisecond every time it is
+// read
+func run(t *testing.T, input string) (*Profiler, object.Object) {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	if errors := resolver.Errors(resolver.Resolve(program, nil)); len(errors) != 0 {
+		t.Fatalf("resolver errors: %v", errors)
+	}
+	profiler := New()
+	clock := time.Unix(0, 0)
+	profiler.now = func() time.Time {
+		clock = clock.Add(time.Millisecond)
+		return clock
+	}
+	env := object.NewEnvironment()
+	env.SetModule("main.monkey")
+	result := profiler.Run(program, env)
+	return profiler, result
+}
+
+func TestFunctions(t *testing.T) {
+	profiler, result := run(t, program)
+	if result.Inspect() != "5" {
+		t.Fatalf("expected 5, got %s", result.Inspect())
+	}
+
+	got := []string{}
+	for _, f := range profiler.Functions() {
+		got = append(got, fmt.Sprintf("%s %s:%d:%d %d", f.Name, f.Module, f.Line, f.Column, f.Calls))
+		if f.Time <= 0 || f.Time > profiler.duration {
+			t.Errorf("%s: wrong time %v for a run of %v", f.Name, f.Time, profiler.duration)
+		}
+	}
+	sort.Strings(got)
+	expected := []string{
+		"anonymous@10 main.monkey:10:13 2",
+		"fib main.monkey:1:11 10",
+		"twice main.monkey:5:22 1",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected functions\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	// the anonymous function calls fib. twice calls it too, but the second
+	// time in tail position, once twice has returned.
+	functions := map[string]*Function{}
+	for _, f := range profiler.Functions() {
+		functions[f.Name] = f
+	}
+	if functions["anonymous@10"].Time <= functions["fib"].Time {
+		t.Errorf("expected the time of callers to include their callees")
+	}
+	if functions["twice"].Time >= functions["anonymous@10"].Time {
+		t.Errorf("expected the time of twice to leave out its tail call")
+	}
+	if profiler.Functions()[0].Name != "anonymous@10" {
+		t.Errorf("expected anonymous@10 to come first, got %s", profiler.Functions()[0].Name)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	profiler, _ := run(t, "fn g() { let x = 1; x }\nfn f() { g() }\nfn h() { f() + 0 }\nh()")
+	functions := map[string]*Function{}
+	for _, f := range profiler.Functions() {
+		functions[f.Name] = f
+	}
+	// f is done once it makes its tail call, h waits for g
+	if functions["f"].Time >= functions["g"].Time {
+		t.Errorf("expected the time of f to leave out g, got %v for f and %v for g", functions["f"].Time, functions["g"].Time)
+	}
+	if functions["h"].Time <= functions["f"].Time+functions["g"].Time {
+		t.Errorf("expected the time of h to include f and g, got %v for h", functions["h"].Time)
+	}
+}
+
+func TestLines(t *testing.T) {
+	profiler, _ := run(t, program)
+	got := []string{}
+	for _, l := range profiler.Lines() {
+		got = append(got, fmt.Sprintf("%d:%d", l.Line, l.Count))
+	}
+	// line 2 counts the if of every call of fib and the returns, line 7 the
+	// while statement once and line 8 each iteration
+	expected := "2:16 3:4 5:2 6:1 7:1 8:3 10:3"
+	if strings.Join(got, " ") != expected {
+		t.Errorf("expected lines %s, got %s", expected, strings.Join(got, " "))
+	}
+}
+
+// field is a field of a decoded protocol buffer message, v for varints and
+// b for bytes
+type field struct {
+	v uint64
+	b []byte
+}
+
+func decode(t *testing.T, data []byte) map[int][]field {
+	t.Helper()
+	fields := map[int][]field{}
+	varint := func() uint64 {
+		var v uint64
+		for shift := 0; ; shift += 7 {
+			if len(data) == 0 {
+				t.Fatalf("truncated varint")
+			}
+			c := data[0]
+			data = data[1:]
+			v |= uint64(c&0x7f) << shift
+			if c < 0x80 {
+				return v
+			}
+		}
+	}
+	for len(data) > 0 {
+		key := varint()
+		switch key & 7 {
+		case 0:
+			fields[int(key>>3)] = append(fields[int(key>>3)], field{v: varint()})
+		case 2:
+			n := varint()
+			fields[int(key>>3)] = append(fields[int(key>>3)], field{b: data[:n]})
+			data = data[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+func packed(t *testing.T, data []byte) []uint64 {
+	t.Helper()
+	values := []uint64{}
+	for len(data) > 0 {
+		var v uint64
+		for shift := 0; ; shift += 7 {
+			c := data[0]
+			data = data[1:]
+			v |= uint64(c&0x7f) << shift
+			if c < 0x80 {
+				break
+			}
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+func TestPprof(t *testing.T) {
+	profiler, _ := run(t, program)
+	var out bytes.Buffer
+	if err := profiler.WritePprof(&out); err != nil {
+		t.Fatal(err)
+	}
+	z, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(z)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := decode(t, data)
+	table := []string{}
+	for _, s := range p[profileStringTable] {
+		table = append(table, string(s.b))
+	}
+	if len(table) == 0 || table[0] != "" {
+		t.Fatalf("the string table must start with the empty string, got %q", table)
+	}
+	if defaultType := p[profileDefaultSampleType]; len(defaultType) != 1 || table[defaultType[0].v] != "time" {
+		t.Errorf("expected time to be the default sample type")
+	}
+
+	functions := map[uint64]string{}
+	for _, f := range p[profileFunction] {
+		fields := decode(t, f.b)
+		functions[fields[functionID][0].v] = table[fields[functionName][0].v]
+	}
+	locations := map[uint64]string{}
+	for _, l := range p[profileLocation] {
+		fields := decode(t, l.b)
+		line := decode(t, fields[locationLine][0].b)
+		locations[fields[locationID][0].v] = fmt.Sprintf("%s:%d", functions[line[lineFunctionID][0].v], line[lineLine][0].v)
+	}
+
+	// the time of every stack, the outermost location first
+	stacks := map[string]uint64{}
+	var total uint64
+	for _, s := range p[profileSample] {
+		fields := decode(t, s.b)
+		ids := packed(t, fields[sampleLocationID][0].b)
+		names := []string{}
+		for i := len(ids) - 1; i >= 0; i-- {
+			names = append(names, locations[ids[i]])
+		}
+		values := packed(t, fields[sampleValue][0].b)
+		stacks[strings.Join(names, ";")] += values[1]
+		total += values[1]
+	}
+	// the time before the first statement is in no stack
+	if expected := profiler.duration - profiler.root.time; total != uint64(expected) {
+		t.Errorf("expected the samples to add up to %v, got %v", expected, time.Duration(total))
+	}
+	for _, stack := range []string{
+		"main:7",
+		"main:10;twice:5;anonymous@10:10;fib:2",
+		"main:10;twice:5;anonymous@10:10;fib:3;fib:2",
+		// the tail call of twice replaces it on the stack
+		"main:10;anonymous@10:10;fib:2",
+	} {
+		if stacks[stack] == 0 {
+			t.Errorf("expected time in the stack %s, got stacks %v", stack, stacks)
+		}
+	}
+}
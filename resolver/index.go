@@ -0,0 +1,95 @@
+package resolver
+
+import (
+	"monkey/ast"
+)
+
+// Binding is a name declared by a program, along with the identifiers that
+// refer to it
+type Binding struct {
+	Name *ast.Identifier // Name is the identifier in the declaration
+	// Kind is what declares the name: variable, constant, function,
+	// parameter, module, import, loop variable, catch parameter or pattern
+	// variable
+	Kind string
+	// Node is the statement or expression that declares the name: the let,
+	// const, function, import, for-in, try or match it appears in, or the
+	// function literal of a parameter
+	Node       ast.Node
+	References []*ast.Identifier
+}
+
+// Scope is a part of the source whose declarations are not visible outside
+// of it, such as a block or a function
+type Scope struct {
+	Span     ast.Span // Span is empty for the global scope, which covers every position
+	Parent   *Scope
+	Bindings []*Binding // Bindings are the declarations of the scope, in order
+	function bool
+}
+
+// Index maps the identifiers of a program to what they refer to
+type Index struct {
+	scopes   []*Scope
+	bindings map[*ast.Identifier]*Binding
+}
+
+// Lookup returns the binding ident declares or refers to. Builtins,
+// undefined names and the names defined by the host have none.
+func (ix *Index) Lookup(ident *ast.Identifier) (*Binding, bool) {
+	b, ok := ix.bindings[ident]
+	return b, ok
+}
+
+// Bindings returns every binding of the program, in the order of the scopes
+// they are declared in
+func (ix *Index) Bindings() []*Binding {
+	bindings := []*Binding{}
+	for _, s := range ix.scopes {
+		bindings = append(bindings, s.Bindings...)
+	}
+	return bindings
+}
+
+// ScopeAt returns the innermost scope that covers pos
+func (ix *Index) ScopeAt(pos ast.Position) *Scope {
+	// scopes are recorded before the scopes they enclose, and sibling
+	// scopes do not overlap, so the last scope covering pos is the innermost
+	for i := len(ix.scopes) - 1; i > 0; i-- {
+		if s := ix.scopes[i]; contains(s.Span, pos) {
+			return s
+		}
+	}
+	return ix.scopes[0]
+}
+
+// Visible returns the bindings a name written at pos can refer to, innermost
+// first. Declarations further down a scope are only visible from functions
+// and from before them when they are hoisted function declarations.
+func (ix *Index) Visible(pos ast.Position) []*Binding {
+	visible := []*Binding{}
+	seen := map[string]bool{}
+	crossed := false
+	for s := ix.ScopeAt(pos); s != nil; s = s.Parent {
+		for _, b := range s.Bindings {
+			declared := ast.Position{Line: b.Name.Token.Line, Column: b.Name.Token.Column}
+			if seen[b.Name.Value] || !(crossed || b.Kind == "function" || before(declared, pos)) {
+				continue
+			}
+			seen[b.Name.Value] = true
+			visible = append(visible, b)
+		}
+		if s.function {
+			crossed = true
+		}
+	}
+	return visible
+}
+
+func contains(span ast.Span, pos ast.Position) bool {
+	return !before(pos, span.Start) && !before(span.End, pos)
+}
+
+func before(a, b ast.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
@@ -0,0 +1,583 @@
+// Package resolver analyses a program before it runs. It binds every
+// identifier that refers to a local variable to the slot the evaluator keeps
+// that variable in, and reports names that are undefined, unused, shadowed or
+// used before their declaration, as well as code that can never run.
+package resolver
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/token"
+	"sort"
+	"strings"
+)
+
+type Severity int
+
+const (
+	Error   Severity = iota // Error is a mistake that would fail at runtime
+	Warning                 // Warning is suspicious code that still runs
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// Diagnostic is a problem found in a program, at the given 1-based position
+type Diagnostic struct {
+	Severity Severity
+	Line     int
+	Column   int
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", d.Line, d.Column, d.Severity, d.Message)
+}
+
+// Errors returns the diagnostics with the Error severity, formatted
+func Errors(diagnostics []Diagnostic) []string {
+	errors := []string{}
+	for _, d := range diagnostics {
+		if d.Severity == Error {
+			errors = append(errors, d.String())
+		}
+	}
+	return errors
+}
+
+// Resolve sets the Slot of the identifiers of program that refer to local
+// variables and returns the problems it found, in the order they appear.
+// defined reports the names the host declares in the global scope before the
+// program runs, it may be nil. Builtins are always defined.
+func Resolve(program *ast.Program, defined func(name string) bool) []Diagnostic {
+	_, diagnostics := Analyze(program, defined)
+	return diagnostics
+}
+
+// Analyze resolves program like Resolve does, and also returns the index of
+// the names it declares and of the identifiers that refer to them
+func Analyze(program *ast.Program, defined func(name string) bool) (*Index, []Diagnostic) {
+	r := &resolver{defined: defined, index: &Index{bindings: map[*ast.Identifier]*Binding{}}}
+	r.openScope(globalScope, ast.Span{})
+	r.scan(program.Statements)
+	r.resolveStatements(program.Statements)
+	r.closeScope()
+
+	sort.SliceStable(r.diagnostics, func(i, j int) bool {
+		a, b := r.diagnostics[i], r.diagnostics[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return r.index, r.diagnostics
+}
+
+type scopeKind int
+
+const (
+	globalScope   scopeKind = iota // the global scope of a program or a module, looked up by name
+	functionScope                  // the scope of a function call, holding its parameters and body
+	blockScope                     // any other scope: branches, loop iterations, catch blocks, match arms
+)
+
+// variable is a name declared in a scope
+type variable struct {
+	token token.Token // token is where the variable is declared
+	kind  string      // kind names the declaration in diagnostics
+	slot  int
+	used  bool
+	// binding is what the index records about the variable
+	binding *Binding
+}
+
+// scope mirrors one environment the evaluator creates
+type scope struct {
+	kind      scopeKind
+	variables map[string]*variable
+	// pending are the variables declared further down the scope, whose
+	// declaration has not been reached yet
+	pending map[string]*variable
+	slots   int
+	info    *Scope
+}
+
+type resolver struct {
+	scopes      []*scope
+	defined     func(name string) bool
+	diagnostics []Diagnostic
+	index       *Index
+}
+
+func (r *resolver) report(severity Severity, tok token.Token, format string, args ...any) {
+	r.diagnostics = append(r.diagnostics, Diagnostic{
+		Severity: severity,
+		Line:     tok.Line,
+		Column:   tok.Column,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// openScope starts a scope covering span in the source
+func (r *resolver) openScope(kind scopeKind, span ast.Span) {
+	info := &Scope{Span: span, function: kind == functionScope}
+	if len(r.scopes) > 0 {
+		info.Parent = r.scopes[len(r.scopes)-1].info
+	}
+	r.index.scopes = append(r.index.scopes, info)
+
+	s := &scope{kind: kind, variables: map[string]*variable{}, pending: map[string]*variable{}, info: info}
+	r.scopes = append(r.scopes, s)
+}
+
+// newVariable creates the variable declared by ident in the innermost scope
+func (r *resolver) newVariable(ident *ast.Identifier, kind string, node ast.Node) *variable {
+	b := &Binding{Name: ident, Kind: kind, Node: node}
+	r.index.bindings[ident] = b
+	s := r.scopes[len(r.scopes)-1]
+	s.info.Bindings = append(s.info.Bindings, b)
+	return &variable{token: ident.Token, kind: kind, binding: b}
+}
+
+// use records that ident refers to v
+func (r *resolver) use(ident *ast.Identifier, v *variable) {
+	v.binding.References = append(v.binding.References, ident)
+	r.index.bindings[ident] = v.binding
+}
+
+// scan looks ahead at the statements run in the innermost scope. Function
+// declarations are declared right away, since the evaluator hoists them,
+// and every other declaration is recorded as pending.
+func (r *resolver) scan(statements []ast.Statement) {
+	s := r.scopes[len(r.scopes)-1]
+	for _, statement := range statements {
+		if export, ok := statement.(*ast.ExportStatement); ok {
+			statement = export.Statement
+		}
+		switch statement := statement.(type) {
+		case *ast.FunctionStatement:
+			r.declare(statement.Name, "function", statement)
+		case *ast.LetStatement:
+			r.addPending(s, statement.Name, "variable", statement)
+		case *ast.ConstStatement:
+			r.addPending(s, statement.Name, "constant", statement)
+		case *ast.ImportStatement:
+			if statement.Alias != nil {
+				r.addPending(s, statement.Alias, "module", statement)
+			}
+			for _, name := range statement.Names {
+				r.addPending(s, name, "import", statement)
+			}
+		}
+	}
+}
+
+// addPending records a declaration of s that has not been reached yet. Only
+// the first declaration of a name counts, the parser rejects the others.
+func (r *resolver) addPending(s *scope, ident *ast.Identifier, kind string, node ast.Node) {
+	if _, ok := s.pending[ident.Value]; ok {
+		return
+	}
+	s.pending[ident.Value] = r.newVariable(ident, kind, node)
+}
+
+// closeScope ends the innermost scope and reports its unused local variables
+func (r *resolver) closeScope() {
+	s := r.scopes[len(r.scopes)-1]
+	r.scopes = r.scopes[:len(r.scopes)-1]
+	if s.kind == globalScope {
+		return
+	}
+
+	for name, v := range s.variables {
+		switch v.kind {
+		case "variable", "constant", "function":
+			if !v.used && !strings.HasPrefix(name, "_") {
+				r.report(Warning, v.token, "unused %s %s", v.kind, name)
+			}
+		}
+	}
+}
+
+// declare binds ident in the innermost scope. Local variables get the next
+// slot of the scope, global ones are left to be looked up by name. node is
+// the statement or expression that declares ident.
+func (r *resolver) declare(ident *ast.Identifier, kind string, node ast.Node) {
+	s := r.scopes[len(r.scopes)-1]
+	name := ident.Value
+
+	v, ok := s.variables[name]
+	if ok {
+		// a parameter list may repeat a name, the last one wins
+		ident.Slot = &ast.Slot{Index: v.slot}
+		r.use(ident, v)
+		return
+	}
+	if pending, ok := s.pending[name]; ok {
+		v = pending
+		delete(s.pending, name)
+		if v.binding.Name != ident {
+			v.binding = r.newVariable(ident, kind, node).binding
+		}
+	} else {
+		v = r.newVariable(ident, kind, node)
+	}
+	v.token = ident.Token
+	v.kind = kind
+	s.variables[name] = v
+
+	if kind != "parameter" && s.kind != globalScope && name != "_" {
+		if outer := r.lookupOuter(name); outer != nil {
+			r.report(Warning, ident.Token, "%s shadows the %s declared at %d:%d",
+				name, outer.kind, outer.token.Line, outer.token.Column)
+		}
+	}
+
+	if s.kind == globalScope {
+		return
+	}
+	v.slot = s.slots
+	s.slots++
+	ident.Slot = &ast.Slot{Index: v.slot}
+}
+
+// lookupOuter returns the declaration of name in the scopes enclosing the
+// innermost one, reached or not
+func (r *resolver) lookupOuter(name string) *variable {
+	for i := len(r.scopes) - 2; i >= 0; i-- {
+		if v, ok := r.scopes[i].variables[name]; ok {
+			return v
+		}
+		if v, ok := r.scopes[i].pending[name]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+// resolve binds ident to the variable it refers to, the way the evaluator
+// would look it up at the point where it is written. read is false for the
+// target of an assignment, which does not count as a use.
+func (r *resolver) resolve(ident *ast.Identifier, read bool) {
+	name := ident.Value
+	// crossed is set once the lookup leaves a function: the code is then
+	// run later, when the function is called, so variables declared further
+	// down the enclosing scopes may already exist
+	crossed := false
+	// early is set when the lookup passes a scope that declares name further
+	// down, so the reference is to another variable than it seems
+	early := false
+
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		s := r.scopes[i]
+		if v, ok := s.variables[name]; ok {
+			r.use(ident, v)
+			if read {
+				v.used = true
+			}
+			if early {
+				r.report(Warning, ident.Token, "%s is used before its declaration in this scope, the outer %s is used instead", name, name)
+			}
+			if s.kind != globalScope {
+				ident.Slot = &ast.Slot{Depth: len(r.scopes) - 1 - i, Index: v.slot}
+			}
+			return
+		}
+		if v, ok := s.pending[name]; ok {
+			if crossed {
+				// whether it is declared by the time the function runs is
+				// only known then, so it is looked up by name
+				r.use(ident, v)
+				if read {
+					v.used = true
+				}
+				return
+			}
+			early = true
+		}
+		if s.kind == functionScope {
+			crossed = true
+		}
+	}
+
+	known := evaluator.IsBuiltin(name) || (r.defined != nil && r.defined(name))
+	switch {
+	case known && early:
+		r.report(Warning, ident.Token, "%s is used before its declaration in this scope, the outer %s is used instead", name, name)
+	case known:
+	case early:
+		r.report(Error, ident.Token, "%s is used before its declaration", name)
+	case read:
+		r.report(Error, ident.Token, "undefined identifier %s", name)
+	default:
+		r.report(Error, ident.Token, "assignment to undeclared variable %s", name)
+	}
+}
+
+// resolveStatements resolves the statements of a scope in order, reporting
+// the first statement that follows a return, throw, break or continue
+func (r *resolver) resolveStatements(statements []ast.Statement) {
+	var exit ast.Statement
+	for _, statement := range statements {
+		if exit != nil {
+			// function declarations are hoisted, so they remain reachable
+			if _, ok := statement.(*ast.FunctionStatement); !ok {
+				r.report(Warning, position(statement), "unreachable code after %s", exit.TokenLiteral())
+				exit = nil
+			}
+		}
+		r.resolveStatement(statement)
+
+		switch statement.(type) {
+		case *ast.ReturnStatement, *ast.ThrowStatement, *ast.BreakStatement, *ast.ContinueStatement:
+			if exit == nil {
+				exit = statement
+			}
+		}
+	}
+}
+
+func (r *resolver) resolveStatement(statement ast.Statement) {
+	switch node := statement.(type) {
+	case *ast.LetStatement:
+		r.resolveExpression(node.Value)
+		r.declare(node.Name, "variable", node)
+
+	case *ast.ConstStatement:
+		r.resolveExpression(node.Value)
+		r.declare(node.Name, "constant", node)
+
+	case *ast.AssignStatement:
+		r.resolveExpression(node.Value)
+		r.resolve(node.Name, false)
+
+	case *ast.ReturnStatement:
+		r.resolveExpression(node.Value)
+
+	case *ast.ThrowStatement:
+		r.resolveExpression(node.Value)
+
+	case *ast.ExpressionStatement:
+		r.resolveExpression(node.Expression)
+
+	case *ast.ExportStatement:
+		r.resolveStatement(node.Statement)
+
+	case *ast.FunctionStatement:
+		// the name was declared when the enclosing scope was opened
+		r.resolveFunction(node.Function)
+
+	case *ast.ImportStatement:
+		if node.Alias != nil {
+			r.declare(node.Alias, "module", node)
+		}
+		for _, name := range node.Names {
+			r.declare(name, "import", node)
+		}
+
+	case *ast.WhileStatement:
+		r.resolveExpression(node.Condition)
+		r.resolveBlock(node.Consequence)
+
+	case *ast.ForStatement:
+		// the loop variables live in a scope around the one of the body
+		r.openScope(blockScope, ast.SpanOf(node))
+		if node.Init != nil {
+			r.resolveStatement(node.Init)
+		}
+		r.resolveExpression(node.Condition)
+		r.resolveBlock(node.Body)
+		if node.Post != nil {
+			r.resolveStatement(node.Post)
+		}
+		r.closeScope()
+
+	case *ast.ForInStatement:
+		r.resolveExpression(node.Iterable)
+		r.openScope(blockScope, ast.SpanOf(node))
+		r.declare(node.Variable, "loop variable", node)
+		r.scan(node.Body.Statements)
+		r.resolveStatements(node.Body.Statements)
+		r.closeScope()
+
+	case *ast.TryStatement:
+		r.resolveBlock(node.Block)
+		if node.Catch != nil {
+			r.openScope(blockScope, ast.SpanOf(node.Catch))
+			if node.Parameter != nil {
+				r.declare(node.Parameter, "catch parameter", node)
+			}
+			r.scan(node.Catch.Statements)
+			r.resolveStatements(node.Catch.Statements)
+			r.closeScope()
+		}
+		if node.Finally != nil {
+			r.resolveBlock(node.Finally)
+		}
+	}
+}
+
+// resolveBlock resolves a block that runs in an environment of its own
+func (r *resolver) resolveBlock(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	r.openScope(blockScope, ast.SpanOf(block))
+	r.scan(block.Statements)
+	r.resolveStatements(block.Statements)
+	r.closeScope()
+}
+
+func (r *resolver) resolveFunction(fn *ast.FunctionLiteral) {
+	if fn == nil || fn.Body == nil {
+		return
+	}
+	// the body shares the scope of the parameters
+	r.openScope(functionScope, ast.SpanOf(fn))
+	for _, param := range fn.Parameters {
+		r.declare(param, "parameter", fn)
+	}
+	r.scan(fn.Body.Statements)
+	r.resolveStatements(fn.Body.Statements)
+	r.closeScope()
+}
+
+func (r *resolver) resolveExpression(expression ast.Expression) {
+	switch node := expression.(type) {
+	case *ast.Identifier:
+		r.resolve(node, true)
+
+	case *ast.PrefixExpression:
+		r.resolveExpression(node.Right)
+
+	case *ast.InfixExpression:
+		r.resolveExpression(node.Left)
+		r.resolveExpression(node.Right)
+
+	case *ast.IfExpression:
+		r.resolveExpression(node.Condition)
+		r.resolveBlock(node.Consequence)
+		r.resolveBlock(node.Alternative)
+
+	case *ast.FunctionLiteral:
+		r.resolveFunction(node)
+
+	case *ast.CallExpression:
+		r.resolveExpression(node.Function)
+		for _, arg := range node.Arguments {
+			r.resolveExpression(arg)
+		}
+
+	case *ast.ArrayLiteral:
+		for _, element := range node.Elements {
+			r.resolveExpression(element)
+		}
+
+	case *ast.IndexExpression:
+		r.resolveExpression(node.Left)
+		r.resolveExpression(node.Index)
+
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			r.resolveExpression(pair.Key)
+			r.resolveExpression(pair.Value)
+		}
+
+	case *ast.MemberExpression:
+		// the property is a name looked up in the object, not in scope
+		r.resolveExpression(node.Object)
+
+	case *ast.MatchExpression:
+		r.resolveExpression(node.Subject)
+		for _, arm := range node.Arms {
+			span := ast.SpanOf(arm.Body)
+			span.Start = ast.SpanOf(arm.Pattern).Start
+			r.openScope(blockScope, span)
+			r.declarePattern(arm.Pattern, node)
+			r.scan(arm.Body.Statements)
+			r.resolveStatements(arm.Body.Statements)
+			r.closeScope()
+		}
+		r.checkBooleanExhaustiveness(node)
+	}
+}
+
+// checkBooleanExhaustiveness warns about a match whose patterns are all
+// boolean literals but which does not cover both true and false, the
+// subject it misses yields null
+func (r *resolver) checkBooleanExhaustiveness(match *ast.MatchExpression) {
+	covered := map[bool]bool{}
+	for _, arm := range match.Arms {
+		b, ok := arm.Pattern.(*ast.Boolean)
+		if !ok {
+			return
+		}
+		covered[b.Value] = true
+	}
+
+	for _, value := range []bool{true, false} {
+		if len(covered) > 0 && !covered[value] {
+			r.report(Warning, match.Token, "non-exhaustive match: missing pattern %t", value)
+		}
+	}
+}
+
+// declarePattern declares the identifiers bound by a pattern of match
+func (r *resolver) declarePattern(pattern ast.Expression, match *ast.MatchExpression) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			r.declare(pattern, "pattern variable", match)
+		}
+	case *ast.ArrayLiteral:
+		for _, element := range pattern.Elements {
+			r.declarePattern(element, match)
+		}
+	case *ast.HashLiteral:
+		for _, pair := range pattern.Pairs {
+			r.declarePattern(pair.Value, match)
+		}
+	}
+}
+
+// position returns the first token of a statement
+func position(statement ast.Statement) token.Token {
+	switch node := statement.(type) {
+	case *ast.LetStatement:
+		return node.Token
+	case *ast.ConstStatement:
+		return node.Token
+	case *ast.AssignStatement:
+		return node.Token
+	case *ast.ReturnStatement:
+		return node.Token
+	case *ast.WhileStatement:
+		return node.Token
+	case *ast.ForStatement:
+		return node.Token
+	case *ast.ForInStatement:
+		return node.Token
+	case *ast.BreakStatement:
+		return node.Token
+	case *ast.ContinueStatement:
+		return node.Token
+	case *ast.ThrowStatement:
+		return node.Token
+	case *ast.TryStatement:
+		return node.Token
+	case *ast.FunctionStatement:
+		return node.Token
+	case *ast.ImportStatement:
+		return node.Token
+	case *ast.ExportStatement:
+		return node.Token
+	case *ast.ExpressionStatement:
+		return node.Token
+	}
+	return token.Token{}
+}
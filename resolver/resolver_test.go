@@ -0,0 +1,222 @@
+package resolver
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`let x = 1; x`, nil},
+		{`fn f() { g() } fn g() { 1 } f()`, nil},
+		{`let f = fn() { later }; let later = 1; f()`, nil},
+		{`len("abc") + str(1)`, nil},
+		{`let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(3)`, nil},
+		{`y`, []string{"1:1: error: undefined identifier y"}},
+		{`fn f() { y = 1 } f()`, []string{"1:10: error: assignment to undeclared variable y"}},
+		{`puts(x); let x = 1;`, []string{"1:6: error: x is used before its declaration"}},
+		{`let x = x;`, []string{"1:9: error: x is used before its declaration"}},
+		{"let x = 1;\nif (true) { puts(x); let x = 2; puts(x) }", []string{
+			"2:18: warning: x is used before its declaration in this scope, the outer x is used instead",
+			"2:26: warning: x shadows the variable declared at 1:5",
+		}},
+		{"fn f() {\n  let unused = 1;\n  let _ignored = 2;\n  fn helper() { 1 }\n  0\n}\nf()", []string{
+			"2:7: warning: unused variable unused",
+			"4:6: warning: unused function helper",
+		}},
+		{"fn f(x) {\n  return x;\n  puts(x);\n}\nf(1)", []string{
+			"3:3: warning: unreachable code after return",
+		}},
+		{"fn f() {\n  return g();\n  fn g() { 1 }\n}\nf()", nil},
+		{"while (true) {\n  break;\n  puts(1);\n}", []string{
+			"3:3: warning: unreachable code after break",
+		}},
+		{"let e = 1;\ntry { throw 1 } catch (e) { e }", []string{
+			"2:24: warning: e shadows the variable declared at 1:5",
+		}},
+		{`let x = 1; let f = fn(x) { x }; f(x)`, nil},
+		{`match ([1, 2]) { [a, _] => a, _ => 0 }`, nil},
+		{`let b = true; match (b) { true => 1 }`, []string{"1:15: warning: non-exhaustive match: missing pattern false"}},
+		{`let b = true; match (b) { false => 1, false => 2 }`, []string{"1:15: warning: non-exhaustive match: missing pattern true"}},
+		{`let b = true; match (b) { true => 1, false => 0 }`, nil},
+		{`for x in [1] { puts(x) } for (let i = 0; i < 1; i = i + 1) { puts(i) }`, nil},
+		{`let h = {"a": 1}; h.a`, nil},
+	}
+
+	for _, tt := range tests {
+		diagnostics := Resolve(parse(t, tt.input), nil)
+		got := []string{}
+		for _, d := range diagnostics {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("input %q:\nexpected %q\ngot      %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestDefined(t *testing.T) {
+	program := parse(t, `host + 1`)
+	defined := func(name string) bool { return name == "host" }
+	if diagnostics := Resolve(program, defined); len(diagnostics) != 0 {
+		t.Errorf("unexpected diagnostics: %v", diagnostics)
+	}
+	if errors := Errors(Resolve(parse(t, `other`), defined)); len(errors) != 1 {
+		t.Errorf("expected 1 error, got %v", errors)
+	}
+}
+
+func TestSlots(t *testing.T) {
+	program := parse(t, `let g = 1; fn f(a, b) { let c = a; fn() { c + b + g } }`)
+	Resolve(program, nil)
+
+	// collect the slots of the identifiers in the order they are written
+	slots := map[string][]*ast.Slot{}
+	fn := program.Statements[1].(*ast.FunctionStatement).Function
+	for _, param := range fn.Parameters {
+		slots[param.Value] = append(slots[param.Value], param.Slot)
+	}
+	let := fn.Body.Statements[0].(*ast.LetStatement)
+	slots["c"] = append(slots["c"], let.Name.Slot)
+	slots["a"] = append(slots["a"], let.Value.(*ast.Identifier).Slot)
+
+	inner := fn.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	sum := inner.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	left := sum.Left.(*ast.InfixExpression)
+	slots["c"] = append(slots["c"], left.Left.(*ast.Identifier).Slot)
+	slots["b"] = append(slots["b"], left.Right.(*ast.Identifier).Slot)
+	slots["g"] = append(slots["g"], sum.Right.(*ast.Identifier).Slot)
+
+	expected := map[string][]*ast.Slot{
+		"a": {{Depth: 0, Index: 0}, {Depth: 0, Index: 0}},
+		"b": {{Depth: 0, Index: 1}, {Depth: 1, Index: 1}},
+		"c": {{Depth: 0, Index: 2}, {Depth: 1, Index: 2}},
+		"g": {nil},
+	}
+	for name, want := range expected {
+		for i, slot := range slots[name] {
+			if (slot == nil) != (want[i] == nil) || (slot != nil && *slot != *want[i]) {
+				t.Errorf("%s #%d: expected slot %+v, got %+v", name, i, want[i], slot)
+			}
+		}
+	}
+}
+
+// TestResolvedEvaluation runs programs with and without resolved slots,
+// which must not change their results
+func TestResolvedEvaluation(t *testing.T) {
+	inputs := []string{
+		`fn fib(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } } fib(15)`,
+		`let counter = fn() { let n = 0; fn() { n = n + 1; n } }; let c = counter(); c(); c(); c()`,
+		`let fs = []; for (let i = 0; i < 3; i = i + 1) { fs = push(fs, fn() { i }) } [fs[0](), fs[1](), fs[2]()]`,
+		`let total = 0; for x in [1, 2, 3] { let y = x * 2; total = total + y } total`,
+		`fn f() { let r = []; let i = 0; while (i < 3) { let j = i; r = push(r, fn() { j }); i = i + 1 } r[1]() } f()`,
+		`fn f(x) { match (x) { [a, b] => a + b, {"k": v} => v, _ => 0 } } [f([1, 2]), f({"k": 5}), f(3)]`,
+		`fn f() { try { throw "boom" } catch (e) { e.message } } f()`,
+		`fn f() { const k = 1; let a = [k]; a[0] - "x" } f()`,
+		`fn f() { let later = fn() { v }; let v = 7; later() } f()`,
+		`let x = 1; fn f() { if (true) { let x = 2; x } } [f(), x]`,
+		`fn f(a, a) { a } f(1, 2)`,
+	}
+
+	for _, input := range inputs {
+		unresolved := evaluator.Eval(parse(t, input), object.NewEnvironment())
+
+		program := parse(t, input)
+		Resolve(program, nil)
+		resolved := evaluator.Eval(program, object.NewEnvironment())
+
+		if unresolved.Inspect() != resolved.Inspect() {
+			t.Errorf("input %q: expected %s, got %s", input, unresolved.Inspect(), resolved.Inspect())
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	input := `let x = 1;
+fn f(a) {
+  let x = a + x;
+  g(x)
+}
+fn g(b) { b }
+for i in [x] { puts(i) }`
+	index, _ := Analyze(parse(t, input), nil)
+
+	// every binding, with the positions of its references
+	tests := []struct {
+		name       string
+		kind       string
+		declared   string
+		references []string
+	}{
+		{"x", "variable", "1:5", []string{"3:15", "7:11"}},
+		{"f", "function", "2:4", nil},
+		{"g", "function", "6:4", []string{"4:3"}},
+		{"a", "parameter", "2:6", []string{"3:11"}},
+		{"x", "variable", "3:7", []string{"4:5"}},
+		{"b", "parameter", "6:6", []string{"6:11"}},
+		{"i", "loop variable", "7:5", []string{"7:21"}},
+	}
+
+	position := func(ident *ast.Identifier) string {
+		return fmt.Sprintf("%d:%d", ident.Token.Line, ident.Token.Column)
+	}
+	bindings := index.Bindings()
+	if len(bindings) != len(tests) {
+		t.Fatalf("expected %d bindings, got %d", len(tests), len(bindings))
+	}
+	for i, tt := range tests {
+		b := bindings[i]
+		references := []string{}
+		for _, ref := range b.References {
+			references = append(references, position(ref))
+			if got, _ := index.Lookup(ref); got != b {
+				t.Errorf("%s at %s: Lookup returned another binding", ref.Value, position(ref))
+			}
+		}
+		if b.Name.Value != tt.name || b.Kind != tt.kind || position(b.Name) != tt.declared ||
+			strings.Join(references, " ") != strings.Join(tt.references, " ") {
+			t.Errorf("binding %d: expected %s %s at %s used at %v, got %s %s at %s used at %v", i,
+				tt.kind, tt.name, tt.declared, tt.references, b.Kind, b.Name.Value, position(b.Name), references)
+		}
+	}
+
+	visible := []struct {
+		line, column int
+		expected     string
+	}{
+		{1, 1, "f g"},
+		{3, 3, "a x f g"},
+		{4, 3, "a x f g"},
+		{6, 11, "b x f g"},
+		{7, 22, "i x f g"},
+	}
+	for _, tt := range visible {
+		names := []string{}
+		for _, b := range index.Visible(ast.Position{Line: tt.line, Column: tt.column}) {
+			names = append(names, b.Name.Value)
+		}
+		if strings.Join(names, " ") != tt.expected {
+			t.Errorf("visible at %d:%d: expected %q, got %q", tt.line, tt.column, tt.expected, strings.Join(names, " "))
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Package stdlib holds the standard library of Monkey. The modules are
+// written in Monkey, embedded into the interpreter and imported like any
+// other module, for example import "std/functional" as f.
+package stdlib
+
+import (
+	"embed"
+	"fmt"
+	"monkey/module"
+	"strings"
+)
+
+//go:embed *.monkey
+var sources embed.FS
+
+// Prefix starts the import path of every standard library module
+const Prefix = "std/"
+
+// Resolver serves the standard library modules and hands every other import
+// to Next. Modules are only parsed and evaluated when a program imports them.
+type Resolver struct {
+	Next module.Resolver
+}
+
+func (r Resolver) Resolve(importPath, importer string) (string, error) {
+	if strings.HasPrefix(importPath, Prefix) {
+		if _, err := sources.Open(fileName(importPath)); err != nil {
+			return "", fmt.Errorf("module not found: %s", importPath)
+		}
+		return importPath, nil
+	}
+	if r.Next == nil {
+		return "", fmt.Errorf("module not found: %s", importPath)
+	}
+	return r.Next.Resolve(importPath, importer)
+}
+
+func (r Resolver) Read(resolved string) (string, error) {
+	if strings.HasPrefix(resolved, Prefix) {
+		source, err := sources.ReadFile(fileName(resolved))
+		if err != nil {
+			return "", fmt.Errorf("module not found: %s", resolved)
+		}
+		return string(source), nil
+	}
+	return r.Next.Read(resolved)
+}
+
+// fileName maps std/name to the embedded file holding the module
+func fileName(importPath string) string {
+	return strings.TrimPrefix(importPath, Prefix) + ".monkey"
+}
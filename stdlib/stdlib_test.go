@@ -0,0 +1,51 @@
+package stdlib
+
+import (
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/module"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+func TestStandardLibrary(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "std/functional" as f; f.map([1, 2, 3], fn(x) { x * 2 })`, `[2, 4, 6]`},
+		{`import "std/functional" as f; f.filter(f.range(0, 6), fn(x) { x > 2 })`, `[3, 4, 5]`},
+		{`import "std/functional" as f; f.reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, `10`},
+		{`import "std/functional" as f; f.range(2, 2)`, `[]`},
+		{`import { any, all } from "std/functional"; [any([1, 5], fn(x) { x > 4 }), all([1, 5], fn(x) { x > 4 })]`, `[true, false]`},
+		{`import "std/strings" as s; s.join([1, 2, 3], ", ")`, `1, 2, 3`},
+		{`import "std/strings" as s; s.repeat("ab", 3)`, `ababab`},
+		{`import "std/strings" as s; s.reverse("monkey")`, `yeknom`},
+		{`import "std/strings" as s; s.chars("abc")`, `[a, b, c]`},
+		{`import "std/strings" as s; [s.startsWith("monkey", "mon"), s.startsWith("mon", "monkey")]`, `[true, false]`},
+		{`import "std/strings" as s; [s.contains("monkey", "key"), s.contains("monkey", "kex"), s.contains("", "")]`, `[true, false, true]`},
+		{`import "std/math" as m; [m.abs(-4), m.max(2, 9), m.min(2, 9)]`, `[4, 9, 2]`},
+		{`import "std/math" as m; [m.clamp(15, 0, 10), m.clamp(-3, 0, 10), m.pow(2, 10)]`, `[10, 0, 1024]`},
+		{`import { sum } from "std/math"; sum([1, 2, 3])`, `6`},
+		{`import "std/missing" as m`, `ERROR: module not found: std/missing`},
+		{`import "user.monkey" as u; u.value`, `42`},
+	}
+
+	user := module.MapResolver{"user.monkey": `export let value = 42;`}
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("input %q: parser errors: %v", tt.input, p.Errors())
+		}
+
+		env := object.NewEnvironment()
+		env.Runtime().Loader = module.NewLoader(Resolver{Next: user})
+
+		evaluated := evaluator.Eval(program, env)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package tester
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// WriteText reports suites the way go test does: the failed tests with
+// their errors and output, every test when verbose is set, and a line for
+// every file
+func WriteText(w io.Writer, suites []*Suite, verbose bool) error {
+	var out strings.Builder
+	for _, suite := range suites {
+		for _, r := range suite.Results {
+			if r.Status == Pass && !verbose {
+				continue
+			}
+			fmt.Fprintf(&out, "--- %s: %s (%s)\n", strings.ToUpper(string(r.Status)), r.Name, seconds(r.Duration))
+			if r.Message != "" {
+				out.WriteString(indent(r.Message))
+			}
+			if r.Output != "" && (r.Status != Pass || verbose) {
+				out.WriteString(indent(strings.TrimSuffix(r.Output, "\n")))
+			}
+		}
+
+		switch {
+		case suite.Error != "":
+			fmt.Fprintf(&out, "FAIL\t%s\n%s", suite.File, indent(suite.Error))
+		case suite.Passed():
+			fmt.Fprintf(&out, "ok\t%s\t%s\t(%d passed)\n", suite.File, seconds(suite.Duration), len(suite.Results))
+		default:
+			fmt.Fprintf(&out, "FAIL\t%s\t%s\t(%d passed, %d failed, %d errored)\n", suite.File, seconds(suite.Duration),
+				suite.Count(Pass), suite.Count(Fail), suite.Count(Error))
+		}
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3fs", d.Seconds())
+}
+
+// indent indents every line of s by four spaces
+func indent(s string) string {
+	return "    " + strings.ReplaceAll(s, "\n", "\n    ") + "\n"
+}
+
+// The JUnit XML format, as CI servers read it
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",cdata"`
+}
+
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+// WriteJUnit reports suites in the JUnit XML format. A file that cannot be
+// loaded is a suite with a single test in error, named after the file.
+func WriteJUnit(w io.Writer, suites []*Suite) error {
+	report := junitSuites{}
+	var total time.Duration
+	for _, suite := range suites {
+		s := junitSuite{Name: suite.File, Time: xmlSeconds(suite.Duration)}
+		if suite.Error != "" {
+			s.Cases = append(s.Cases, junitCase{
+				Name:      suite.File,
+				Classname: suite.File,
+				Time:      xmlSeconds(0),
+				Error:     &junitProblem{Message: firstLine(suite.Error), Text: suite.Error},
+			})
+			s.Errors++
+		}
+		for _, r := range suite.Results {
+			c := junitCase{Name: r.Name, Classname: suite.File, Time: xmlSeconds(r.Duration)}
+			if r.Output != "" {
+				c.SystemOut = &junitOutput{Text: r.Output}
+			}
+			problem := &junitProblem{Message: firstLine(r.Message), Text: r.Message}
+			switch r.Status {
+			case Fail:
+				c.Failure = problem
+				s.Failures++
+			case Error:
+				c.Error = problem
+				s.Errors++
+			}
+			s.Cases = append(s.Cases, c)
+		}
+		s.Tests = len(s.Cases)
+		report.Tests += s.Tests
+		report.Failures += s.Failures
+		report.Errors += s.Errors
+		total += suite.Duration
+		report.Suites = append(report.Suites, s)
+	}
+	report.Time = xmlSeconds(total)
+
+	out, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, out)
+	return err
+}
+
+func xmlSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
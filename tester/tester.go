@@ -0,0 +1,280 @@
+// Package tester runs tests written in Monkey. Tests are the top level
+// functions named test_* of the files named *_test.monkey. Each runs in a
+// fresh environment, where the file is evaluated again before the test is
+// called, and fails when it returns an error: an assertion error made by
+// assert, assert_eq or assert_error is a failure, any other error is an
+// error of the test.
+package tester
+
+import (
+	"fmt"
+	"io/fs"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/module"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/resolver"
+	"monkey/stdlib"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Suffix ends the names of the files holding tests
+const Suffix = "_test.monkey"
+
+// Prefix starts the names of the test functions
+const Prefix = "test_"
+
+// Status is the outcome of a test
+type Status string
+
+const (
+	Pass  Status = "pass"
+	Fail  Status = "fail"
+	Error Status = "error"
+)
+
+// Result is the outcome of a test function
+type Result struct {
+	Name   string
+	Status Status
+	// Message is the error the test returned, starting with the position
+	// where it was raised
+	Message  string
+	Output   string
+	Duration time.Duration
+}
+
+// Suite is the outcome of the tests of a file
+type Suite struct {
+	File    string
+	Results []Result
+	// Error is set when the file cannot be read, parsed or resolved, and
+	// none of its tests ran
+	Error    string
+	Duration time.Duration
+}
+
+// Count returns the number of the tests of s with status
+func (s *Suite) Count(status Status) int {
+	n := 0
+	for _, r := range s.Results {
+		if r.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Passed reports whether the file was loaded and all its tests passed
+func (s *Suite) Passed() bool {
+	return s.Error == "" && s.Count(Pass) == len(s.Results)
+}
+
+// Discover returns the test files among paths: the files given, and the
+// files named *_test.monkey in the directories given and below them
+func Discover(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		found := []string{}
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && p != path && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() && strings.HasSuffix(d.Name(), Suffix) {
+				found = append(found, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// Runner runs test files
+type Runner struct {
+	// Hook, when set, sees the evaluation of every test, as the coverage
+	// does
+	Hook object.Hook
+	// resolver finds the modules the tests import
+	resolver module.Resolver
+}
+
+// NewRunner returns a runner loading modules from files and the standard
+// library
+func NewRunner() *Runner {
+	return &Runner{resolver: stdlib.Resolver{Next: module.FileResolver{}}}
+}
+
+// Run runs the tests of the file at path, in the order they are declared
+func (r *Runner) Run(path string) *Suite {
+	start := time.Now()
+	suite := &Suite{File: path}
+	defer func() { suite.Duration = time.Since(start) }()
+
+	program, absPath, err := load(path)
+	if err != nil {
+		suite.Error = err.Error()
+		return suite
+	}
+	for _, name := range Tests(program) {
+		suite.Results = append(suite.Results, r.runTest(program, absPath, name))
+	}
+	return suite
+}
+
+// load parses and resolves the file at path, and returns its program with
+// its absolute path
+func load(path string) (*ast.Program, string, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, "", fmt.Errorf("parser errors:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+	}
+	if errs := resolver.Errors(resolver.Resolve(program, nil)); len(errs) != 0 {
+		return nil, "", fmt.Errorf("resolver errors:\n\t%s", strings.Join(errs, "\n\t"))
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return program, absPath, nil
+}
+
+// Tests returns the names of the test functions of program, in the order
+// they are declared. They are declared with fn, or bound to a function
+// literal with let or const.
+func Tests(program *ast.Program) []string {
+	names := []string{}
+	for _, statement := range program.Statements {
+		if export, ok := statement.(*ast.ExportStatement); ok {
+			statement = export.Statement
+		}
+		var name *ast.Identifier
+		switch decl := statement.(type) {
+		case *ast.FunctionStatement:
+			name = decl.Name
+		case *ast.LetStatement:
+			if _, ok := decl.Value.(*ast.FunctionLiteral); ok {
+				name = decl.Name
+			}
+		case *ast.ConstStatement:
+			if _, ok := decl.Value.(*ast.FunctionLiteral); ok {
+				name = decl.Name
+			}
+		}
+		if name != nil && strings.HasPrefix(name.Value, Prefix) {
+			names = append(names, name.Value)
+		}
+	}
+	return names
+}
+
+// runTest evaluates program in a fresh environment, with fresh modules, and
+// calls the test function name
+func (r *Runner) runTest(program *ast.Program, path, name string) Result {
+	start := time.Now()
+	var output strings.Builder
+	env := object.NewEnvironment()
+	env.SetModule(path)
+	env.Runtime().Loader = module.NewLoader(r.resolver)
+	env.Runtime().Stdout = &output
+	env.Runtime().Stderr = &output
+	recorder := &recorder{next: r.Hook, positions: map[*object.Error]ast.Position{}}
+
+	evaluated := evaluator.EvalWithHook(program, env, recorder)
+	if _, ok := evaluated.(*object.Error); !ok {
+		fn, _ := env.Get(name)
+		evaluated = evaluator.ApplyWithHook(fn, nil, env, recorder)
+	}
+
+	result := Result{Name: name, Status: Pass, Output: output.String(), Duration: time.Since(start)}
+	if err, ok := evaluated.(*object.Error); ok {
+		result.Status = Error
+		if err.Kind == object.AssertionError {
+			result.Status = Fail
+		}
+		result.Message = message(err, recorder.positions[err])
+	}
+	return result
+}
+
+// message returns the message of err, starting with the position it was
+// raised at when it is known, and followed by its stack
+func message(err *object.Error, position ast.Position) string {
+	var out strings.Builder
+	if position.Line != 0 {
+		fmt.Fprintf(&out, "%d:%d: ", position.Line, position.Column)
+	}
+	out.WriteString(string(err.Kind) + ": " + err.Message)
+	for _, frame := range err.PrintedStack() {
+		out.WriteString("\n\tat " + frame)
+	}
+	return out.String()
+}
+
+// recorder is the hook of the tests. It records the position of the node
+// every error was first returned by, and passes every event on to next.
+type recorder struct {
+	next      object.Hook
+	positions map[*object.Error]ast.Position
+}
+
+func (r *recorder) Before(node ast.Node, env *object.Environment) *object.Error {
+	if r.next != nil {
+		return r.next.Before(node, env)
+	}
+	return nil
+}
+
+func (r *recorder) After(node ast.Node, env *object.Environment, result object.Object) {
+	if err, ok := result.(*object.Error); ok {
+		if _, seen := r.positions[err]; !seen {
+			r.positions[err] = ast.SpanOf(node).Start
+		}
+	}
+	if r.next != nil {
+		r.next.After(node, env, result)
+	}
+}
+
+func (r *recorder) Call(fn *object.Function, args []object.Object) {
+	if r.next != nil {
+		r.next.Call(fn, args)
+	}
+}
+
+func (r *recorder) Return(fn *object.Function, result object.Object) {
+	if r.next != nil {
+		r.next.Return(fn, result)
+	}
+}
+
+func (r *recorder) NestTailCalls() bool {
+	nester, ok := r.next.(object.TailCallNester)
+	return ok && nester.NestTailCalls()
+}
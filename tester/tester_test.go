@@ -0,0 +1,322 @@
+package tester
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+const lib = `export fn sign(n) {
+	if (n < 0) { -1 } else { 1 }
+}`
+
+const tests = `import "lib.monkey" as lib;
+
+let seen = [];
+
+fn test_sign() {
+	assert_eq(lib.sign(-3), -1);
+	assert_eq(lib.sign(3), 1);
+}
+
+fn test_fails() {
+	puts("checking");
+	assert_eq(lib.sign(0), 0, "zero");
+}
+
+fn test_errors() {
+	let x = 1 + true;
+}
+
+fn test_fresh() {
+	assert_eq(len(seen), 0);
+	seen = push(seen, 1);
+}
+
+fn test_fresh_again() {
+	assert_eq(len(seen), 0);
+}
+
+fn helper() { 1 }
+`
+
+// writeFiles writes files, keyed by their paths relative to a new directory,
+// and returns the directory
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"lib.monkey": lib, "lib_test.monkey": tests})
+	suite := NewRunner().Run(filepath.Join(dir, "lib_test.monkey"))
+	if suite.Error != "" {
+		t.Fatalf("unexpected error %s", suite.Error)
+	}
+
+	expected := []Result{
+		{Name: "test_sign", Status: Pass},
+		{Name: "test_fails", Status: Fail, Output: "checking\n",
+			Message: "12:2: AssertionError: zero: assert_eq failed\n--- expected\n+++ actual\n-0\n+1"},
+		{Name: "test_errors", Status: Error,
+			Message: "16:10: TypeError: unknown operator: INTEGER + BOOLEAN"},
+		// every test runs in a fresh environment
+		{Name: "test_fresh", Status: Pass},
+		{Name: "test_fresh_again", Status: Pass},
+	}
+	if len(suite.Results) != len(expected) {
+		t.Fatalf("expected %d results, got %+v", len(expected), suite.Results)
+	}
+	for i, r := range suite.Results {
+		r.Duration = 0
+		if r != expected[i] {
+			t.Errorf("result %d: expected %+v, got %+v", i, expected[i], r)
+		}
+	}
+	if suite.Passed() || suite.Count(Pass) != 3 || suite.Count(Fail) != 1 || suite.Count(Error) != 1 {
+		t.Errorf("wrong counts for %+v", suite.Results)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	// the tests run under a hook, which must not keep tail calls from
+	// running in constant stack
+	defer debug.SetMaxStack(debug.SetMaxStack(16 << 20))
+	dir := writeFiles(t, map[string]string{"loop_test.monkey": `
+fn loop(n, acc) { if (n == 0) { acc } else { loop(n - 1, acc + 1) } }
+
+fn test_deep() {
+	assert_eq(loop(1000000, 0), 1000000);
+}
+`})
+	suite := NewRunner().Run(filepath.Join(dir, "loop_test.monkey"))
+	if suite.Error != "" || !suite.Passed() {
+		t.Errorf("expected the test to pass, got %+v", suite)
+	}
+}
+
+func TestTests(t *testing.T) {
+	p := parser.New(lexer.New(`
+fn test_a() {}
+let test_b = fn() {};
+const test_c = fn() {};
+export fn test_d() {}
+let test_value = 1;
+fn helper() {}
+`))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	expected := "test_a test_b test_c test_d"
+	if got := strings.Join(Tests(program), " "); got != expected {
+		t.Errorf("expected the tests %q, got %q", expected, got)
+	}
+}
+
+// counter is a hook counting the calls of functions
+type counter struct{ calls []string }
+
+func (c *counter) Before(node ast.Node, env *object.Environment) *object.Error        { return nil }
+func (c *counter) After(node ast.Node, env *object.Environment, result object.Object) {}
+func (c *counter) Call(fn *object.Function, args []object.Object)                     { c.calls = append(c.calls, fn.Name) }
+func (c *counter) Return(fn *object.Function, result object.Object)                   {}
+
+func TestHook(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"lib.monkey": lib, "lib_test.monkey": tests})
+	runner := NewRunner()
+	hook := &counter{}
+	runner.Hook = hook
+	runner.Run(filepath.Join(dir, "lib_test.monkey"))
+	expected := "test_sign sign sign test_fails sign test_errors test_fresh test_fresh_again"
+	if got := strings.Join(hook.calls, " "); got != expected {
+		t.Errorf("expected the calls %q, got %q", expected, got)
+	}
+}
+
+// nesting is a hook following the depth of the calls, which needs tail
+// calls nested in their caller
+type nesting struct{ depth, max int }
+
+func (n *nesting) Before(node ast.Node, env *object.Environment) *object.Error        { return nil }
+func (n *nesting) After(node ast.Node, env *object.Environment, result object.Object) {}
+func (n *nesting) Call(fn *object.Function, args []object.Object) {
+	n.depth++
+	n.max = max(n.max, n.depth)
+}
+func (n *nesting) Return(fn *object.Function, result object.Object) { n.depth-- }
+func (n *nesting) NestTailCalls() bool                              { return true }
+
+func TestNestedTailCalls(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"loop_test.monkey": `
+fn loop(n) { if (n == 0) { 0 } else { loop(n - 1) } }
+
+fn test_loop() {
+	loop(100);
+}
+`})
+	runner := NewRunner()
+	hook := &nesting{}
+	runner.Hook = hook
+	runner.Run(filepath.Join(dir, "loop_test.monkey"))
+	// the test and the 101 calls of loop, as the recorder passes the need on
+	if hook.max != 102 {
+		t.Errorf("expected calls 102 deep, got %d", hook.max)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"syntax_test.monkey":   "fn test_a() { let }",
+		"resolver_test.monkey": "fn test_a() { nope }",
+	})
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{"syntax_test.monkey", "parser errors:"},
+		{"resolver_test.monkey", "resolver errors:\n\t1:15: error: undefined identifier nope"},
+		{"missing_test.monkey", "no such file or directory"},
+	}
+
+	for _, tt := range tests {
+		suite := NewRunner().Run(filepath.Join(dir, tt.file))
+		if !strings.Contains(suite.Error, tt.expected) || len(suite.Results) != 0 || suite.Passed() {
+			t.Errorf("%s: expected an error containing %q, got %+v", tt.file, tt.expected, suite)
+		}
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a_test.monkey":            "",
+		"a.monkey":                 "",
+		"sub/b_test.monkey":        "",
+		"sub/deeper/c_test.monkey": "",
+		".hidden/d_test.monkey":    "",
+	})
+	files, err := Discover([]string{dir, filepath.Join(dir, "a.monkey")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, f := range files {
+		rel, _ := filepath.Rel(dir, f)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	expected := "a_test.monkey sub/b_test.monkey sub/deeper/c_test.monkey a.monkey"
+	if strings.Join(got, " ") != expected {
+		t.Errorf("expected %q, got %q", expected, strings.Join(got, " "))
+	}
+
+	if _, err := Discover([]string{filepath.Join(dir, "missing")}); err == nil {
+		t.Errorf("expected an error for a missing path")
+	}
+}
+
+var suites = []*Suite{
+	{File: "a_test.monkey", Results: []Result{
+		{Name: "test_ok", Status: Pass, Output: "hi\n"},
+		{Name: "test_bad", Status: Fail, Message: "2:1: AssertionError: assert failed\nmore", Output: "out\n"},
+		{Name: "test_broken", Status: Error, Message: "3:1: TypeError: nope"},
+	}},
+	{File: "b_test.monkey", Results: []Result{{Name: "test_ok", Status: Pass}}},
+	{File: "c_test.monkey", Error: "parser errors:\n\t1:1: bad"},
+}
+
+func TestWriteText(t *testing.T) {
+	tests := []struct {
+		verbose  bool
+		expected string
+	}{
+		{false, `--- FAIL: test_bad (0.000s)
+    2:1: AssertionError: assert failed
+    more
+    out
+--- ERROR: test_broken (0.000s)
+    3:1: TypeError: nope
+FAIL	a_test.monkey	0.000s	(1 passed, 1 failed, 1 errored)
+ok	b_test.monkey	0.000s	(1 passed)
+FAIL	c_test.monkey
+    parser errors:
+    	1:1: bad
+`},
+		{true, `--- PASS: test_ok (0.000s)
+    hi
+--- FAIL: test_bad (0.000s)
+    2:1: AssertionError: assert failed
+    more
+    out
+--- ERROR: test_broken (0.000s)
+    3:1: TypeError: nope
+FAIL	a_test.monkey	0.000s	(1 passed, 1 failed, 1 errored)
+--- PASS: test_ok (0.000s)
+ok	b_test.monkey	0.000s	(1 passed)
+FAIL	c_test.monkey
+    parser errors:
+    	1:1: bad
+`},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		WriteText(&out, suites, tt.verbose)
+		if out.String() != tt.expected {
+			t.Errorf("verbose %v: expected\n%s\ngot\n%s", tt.verbose, tt.expected, out.String())
+		}
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var out strings.Builder
+	if err := WriteJUnit(&out, suites); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="5" failures="1" errors="2" time="0.000">
+  <testsuite name="a_test.monkey" tests="3" failures="1" errors="1" time="0.000">
+    <testcase name="test_ok" classname="a_test.monkey" time="0.000">
+      <system-out><![CDATA[hi
+]]></system-out>
+    </testcase>
+    <testcase name="test_bad" classname="a_test.monkey" time="0.000">
+      <failure message="2:1: AssertionError: assert failed"><![CDATA[2:1: AssertionError: assert failed
+more]]></failure>
+      <system-out><![CDATA[out
+]]></system-out>
+    </testcase>
+    <testcase name="test_broken" classname="a_test.monkey" time="0.000">
+      <error message="3:1: TypeError: nope"><![CDATA[3:1: TypeError: nope]]></error>
+    </testcase>
+  </testsuite>
+  <testsuite name="b_test.monkey" tests="1" failures="0" errors="0" time="0.000">
+    <testcase name="test_ok" classname="b_test.monkey" time="0.000"></testcase>
+  </testsuite>
+  <testsuite name="c_test.monkey" tests="1" failures="0" errors="1" time="0.000">
+    <testcase name="c_test.monkey" classname="c_test.monkey" time="0.000">
+      <error message="parser errors:"><![CDATA[parser errors:
+	1:1: bad]]></error>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,114 @@
+// Package trace records the evaluation of a program node by node, for the
+// editor to replay it step by step next to the AST.
+package trace
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"reflect"
+)
+
+// Event is the visit of a node by the evaluator. Events are in the order the
+// nodes are visited, a node before its children.
+type Event struct {
+	// Kind is the name of the type of the node, such as InfixExpression
+	Kind string   `json:"kind"`
+	Span ast.Span `json:"span"`
+	// Value is the Inspect of what the node evaluated to, empty when it is
+	// a statement without a value
+	Value string `json:"value"`
+	// Depth is the number of environments enclosing the one the node is
+	// evaluated in, 0 being the global scope
+	Depth int `json:"depth"`
+}
+
+// Tracer is a Hook recording the first events of a program. Once it holds
+// limit events it stops the program with a CancelledError, so even a
+// program that never ends can be traced.
+type Tracer struct {
+	limit     int
+	events    []Event
+	truncated bool
+	// open holds the indexes of the events of the nodes being evaluated,
+	// whose values are not known yet
+	open  []int
+	spans map[ast.Node]ast.Span
+}
+
+// New returns a tracer recording at most limit events
+func New(limit int) *Tracer {
+	return &Tracer{limit: limit, spans: map[ast.Node]ast.Span{}}
+}
+
+// Run evaluates program in env under the tracer
+func (t *Tracer) Run(program *ast.Program, env *object.Environment) object.Object {
+	return evaluator.EvalWithHook(program, env, t)
+}
+
+// Events returns the events recorded so far
+func (t *Tracer) Events() []Event {
+	return t.events
+}
+
+// Truncated reports whether the program was stopped because it reached the
+// limit of events
+func (t *Tracer) Truncated() bool {
+	return t.truncated
+}
+
+func (t *Tracer) Before(node ast.Node, env *object.Environment) *object.Error {
+	if len(t.events) >= t.limit {
+		t.truncated = true
+		return &object.Error{Kind: object.CancelledError, Message: fmt.Sprintf("trace: the limit of %d events is reached", t.limit)}
+	}
+
+	depth := 0
+	for scope := env.Outer(); scope != nil; scope = scope.Outer() {
+		depth++
+	}
+	t.open = append(t.open, len(t.events))
+	t.events = append(t.events, Event{
+		Kind:  kind(node),
+		Span:  t.span(node),
+		Depth: depth,
+	})
+	return nil
+}
+
+func (t *Tracer) After(node ast.Node, env *object.Environment, result object.Object) {
+	i := t.open[len(t.open)-1]
+	t.open = t.open[:len(t.open)-1]
+	if result != nil {
+		t.events[i].Value = result.Inspect()
+	}
+}
+
+// kind returns the name of the type of node
+func kind(node ast.Node) string {
+	t := reflect.TypeOf(node)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// span returns the span of node, they are remembered as they are costly to
+// compute and loops visit the same nodes again
+func (t *Tracer) span(node ast.Node) ast.Span {
+	span, ok := t.spans[node]
+	if !ok {
+		span = ast.SpanOf(node)
+		t.spans[node] = span
+	}
+	return span
+}
+
+func (t *Tracer) Call(fn *object.Function, args []object.Object) {}
+
+func (t *Tracer) Return(fn *object.Function, result object.Object) {}
+
+// NestTailCalls makes tail calls nest so that every node is recorded with
+// its value. The limit of events bounds the depth of the calls.
+func (t *Tracer) NestTailCalls() bool { return true }
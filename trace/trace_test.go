@@ -0,0 +1,106 @@
+package trace
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/resolver"
+	"strings"
+	"testing"
+)
+
+func run(t *testing.T, input string, limit int) (*Tracer, object.Object) {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	if errors := resolver.Errors(resolver.Resolve(program, nil)); len(errors) != 0 {
+		t.Fatalf("resolver errors: %v", errors)
+	}
+	tracer := New(limit)
+	env := object.NewEnvironment()
+	result := tracer.Run(program, env)
+	return tracer, result
+}
+
+func TestEvents(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1 + 2; x", []string{
+			"Program 3 0",
+			"LetStatement  0",
+			"InfixExpression 3 0",
+			"IntegerLiteral 1 0",
+			"IntegerLiteral 2 0",
+			"ExpressionStatement 3 0",
+			"Identifier 3 0",
+		}},
+		{"fn double(n) { n * 2 }\ndouble(4)", []string{
+			"Program 8 0",
+			"FunctionStatement  0",
+			"ExpressionStatement 8 0",
+			"CallExpression 8 0",
+			"Identifier fn double(n) {\n(n * 2)\n} 0",
+			"IntegerLiteral 4 0",
+			"BlockStatement 8 1",
+			"ExpressionStatement 8 1",
+			"InfixExpression 8 1",
+			"Identifier 4 1",
+			"IntegerLiteral 2 1",
+		}},
+		{"if (true) { \"a\" }", []string{
+			"Program a 0",
+			"ExpressionStatement a 0",
+			"IfExpression a 0",
+			"Boolean true 0",
+			"BlockStatement a 1",
+			"ExpressionStatement a 1",
+			"StringLiteral a 1",
+		}},
+	}
+
+	for _, tt := range tests {
+		tracer, _ := run(t, tt.input, 100)
+		got := []string{}
+		for _, e := range tracer.Events() {
+			got = append(got, fmt.Sprintf("%s %s %d", e.Kind, e.Value, e.Depth))
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("input %q:\nexpected %q\ngot      %q", tt.input, tt.expected, got)
+		}
+		if tracer.Truncated() {
+			t.Errorf("input %q: the trace is truncated", tt.input)
+		}
+	}
+}
+
+func TestSpans(t *testing.T) {
+	tracer, _ := run(t, "let a = 10;\nputs(a * 2)", 100)
+	expected := map[string]ast.Span{
+		"LetStatement":    {Start: ast.Position{Line: 1, Column: 1}, End: ast.Position{Line: 1, Column: 11}},
+		"CallExpression":  {Start: ast.Position{Line: 2, Column: 1}, End: ast.Position{Line: 2, Column: 11}},
+		"InfixExpression": {Start: ast.Position{Line: 2, Column: 6}, End: ast.Position{Line: 2, Column: 11}},
+	}
+	for _, e := range tracer.Events() {
+		if span, ok := expected[e.Kind]; ok && e.Span != span {
+			t.Errorf("%s: expected span %v, got %v", e.Kind, span, e.Span)
+		}
+	}
+}
+
+func TestLimit(t *testing.T) {
+	tracer, result := run(t, "let i = 0; while (true) { i = i + 1; }", 50)
+	if len(tracer.Events()) != 50 || !tracer.Truncated() {
+		t.Errorf("expected 50 events and a truncated trace, got %d events", len(tracer.Events()))
+	}
+	err, ok := result.(*object.Error)
+	if !ok || err.Kind != object.CancelledError {
+		t.Errorf("expected the program to be stopped, got %v", result)
+	}
+}
@@ -0,0 +1,646 @@
+package types
+
+import (
+	"fmt"
+	"monkey/ast"
+	"sort"
+)
+
+// Error is a type mismatch found in a program
+type Error struct {
+	Span    ast.Span `json:"span"`
+	Message string   `json:"message"`
+}
+
+func (e Error) String() string {
+	return fmt.Sprintf("%d:%d: type error: %s", e.Span.Start.Line, e.Span.Start.Column, e.Message)
+}
+
+// Result is what Check found out about a program
+type Result struct {
+	Errors []Error
+	// Declarations maps the names declared by the program, including
+	// parameters, to their types
+	Declarations map[*ast.Identifier]Type
+}
+
+// builtins are the types of the builtin functions of the evaluator
+var builtins = map[string]func(u *unifier, level int) Type{
+	"len": func(*unifier, int) Type { return &Function{Params: []Type{Any}, Return: Int} },
+	"str": func(*unifier, int) Type { return &Function{Params: []Type{Any}, Return: String} },
+	"push": func(u *unifier, level int) Type {
+		a := u.newVariable(level)
+		return &Function{Params: []Type{&Array{Element: a}, a}, Return: &Array{Element: a}}
+	},
+	"puts":  func(*unifier, int) Type { return &Function{Params: []Type{Any}, Return: Null, Variadic: true} },
+	"print": func(*unifier, int) Type { return &Function{Params: []Type{Any}, Return: Null, Variadic: true} },
+	// the assertions take an optional message, and assert_error a part of
+	// the error message, checked when they are called
+	"assert": func(*unifier, int) Type {
+		return &Function{Params: []Type{Any, String}, Return: Null, Variadic: true}
+	},
+	"assert_eq": func(*unifier, int) Type {
+		return &Function{Params: []Type{Any, Any, String}, Return: Null, Variadic: true}
+	},
+	"assert_error": func(*unifier, int) Type {
+		return &Function{Params: []Type{&Function{Return: Any}, String}, Return: String, Variadic: true}
+	},
+}
+
+// Check infers the types of program and reports the mismatches, in the
+// order they appear in the source
+func Check(program *ast.Program) *Result {
+	c := &checker{result: &Result{Declarations: map[*ast.Identifier]Type{}}}
+	c.openScope()
+	c.scan(program.Statements)
+	c.checkStatements(program.Statements)
+	c.closeScope()
+
+	// + only works on ints and strings, which is only known once the
+	// types of its operands are solved
+	for _, operand := range c.addOperands {
+		switch t := prune(operand.t).(type) {
+		case *Variable:
+		default:
+			if t != Int && t != String && t != Any {
+				c.errorf(operand.node, "operator + not defined on %s", t)
+			}
+		}
+	}
+
+	sort.SliceStable(c.result.Errors, func(i, j int) bool {
+		a, b := c.result.Errors[i].Span.Start, c.result.Errors[j].Span.Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return c.result
+}
+
+// function is the function whose body is being checked
+type function struct {
+	returnType Type // returnType is the annotated return type, nil when inferred
+	returns    []Type
+}
+
+type operand struct {
+	node ast.Node
+	t    Type
+}
+
+type checker struct {
+	unifier
+	scopes      []map[string]*Scheme
+	level       int
+	functions   []*function
+	addOperands []operand
+	result      *Result
+}
+
+func (c *checker) errorf(node ast.Node, format string, args ...any) {
+	c.result.Errors = append(c.result.Errors, Error{Span: ast.SpanOf(node), Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) openScope() {
+	c.scopes = append(c.scopes, map[string]*Scheme{})
+}
+
+func (c *checker) closeScope() {
+	c.scopes = c.scopes[:len(c.scopes)-1]
+}
+
+func (c *checker) declare(ident *ast.Identifier, scheme *Scheme) {
+	c.scopes[len(c.scopes)-1][ident.Value] = scheme
+	c.result.Declarations[ident] = scheme.Type
+}
+
+func (c *checker) lookup(name string) (*Scheme, bool) {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if scheme, ok := c.scopes[i][name]; ok {
+			return scheme, true
+		}
+	}
+	return nil, false
+}
+
+// scan declares the names a block declares before its statements are
+// checked, so that functions can refer to names declared further down.
+// Function declarations get a variable generalized once their body is
+// checked, like the evaluator hoists them.
+func (c *checker) scan(statements []ast.Statement) {
+	for _, statement := range statements {
+		if export, ok := statement.(*ast.ExportStatement); ok {
+			statement = export.Statement
+		}
+		switch statement := statement.(type) {
+		case *ast.FunctionStatement:
+			c.declare(statement.Name, mono(c.newVariable(c.level+1)))
+		case *ast.LetStatement:
+			c.declare(statement.Name, mono(c.newVariable(c.level)))
+		case *ast.ConstStatement:
+			c.declare(statement.Name, mono(c.newVariable(c.level)))
+		}
+	}
+}
+
+// annotation converts a type annotation to a type
+func annotation(t ast.Type) Type {
+	switch t := t.(type) {
+	case *ast.NamedType:
+		switch t.Name {
+		case "int":
+			return Int
+		case "string":
+			return String
+		case "bool":
+			return Bool
+		case "null":
+			return Null
+		}
+		return Any
+	case *ast.ArrayType:
+		return &Array{Element: annotation(t.Element)}
+	case *ast.HashType:
+		return &Hash{Key: annotation(t.Key), Value: annotation(t.Value)}
+	case *ast.FunctionType:
+		fn := &Function{Return: Any}
+		for _, p := range t.Parameters {
+			fn.Params = append(fn.Params, annotation(p))
+		}
+		if t.Return != nil {
+			fn.Return = annotation(t.Return)
+		}
+		return fn
+	}
+	return Any
+}
+
+// checkStatements checks the statements of a block and returns the type of
+// the value the block evaluates to
+func (c *checker) checkStatements(statements []ast.Statement) Type {
+	var result Type = Null
+	for _, statement := range statements {
+		result = c.checkStatement(statement)
+	}
+	return result
+}
+
+// checkBlock checks a block that runs in a scope of its own
+func (c *checker) checkBlock(block *ast.BlockStatement) Type {
+	if block == nil {
+		return Null
+	}
+	c.openScope()
+	defer c.closeScope()
+	c.scan(block.Statements)
+	return c.checkStatements(block.Statements)
+}
+
+// checkStatement checks statement and returns the type of its value. The
+// statements that leave the block get a fresh variable, which fits any
+// type the other paths produce.
+func (c *checker) checkStatement(statement ast.Statement) Type {
+	switch node := statement.(type) {
+	case *ast.ExpressionStatement:
+		return c.infer(node.Expression)
+
+	case *ast.LetStatement:
+		c.checkDeclaration(node.Name, node.Value)
+
+	case *ast.ConstStatement:
+		c.checkDeclaration(node.Name, node.Value)
+
+	case *ast.ExportStatement:
+		c.checkStatement(node.Statement)
+
+	case *ast.AssignStatement:
+		value := c.infer(node.Value)
+		if scheme, ok := c.lookup(node.Name.Value); ok {
+			current := c.instantiate(scheme, c.level)
+			if !c.unify(current, value) {
+				c.errorf(node, "cannot assign %s to %s of type %s", value, node.Name.Value, current)
+			}
+		}
+
+	case *ast.FunctionStatement:
+		c.level++
+		fn := c.inferFunction(node.Function)
+		if scheme, ok := c.lookup(node.Name.Value); ok && !c.unify(scheme.Type, fn) {
+			c.errorf(node.Name, "%s is used as %s before its declaration as %s", node.Name.Value, scheme.Type, fn)
+		}
+		c.level--
+		c.declare(node.Name, generalize(fn, c.level))
+
+	case *ast.ReturnStatement:
+		value := c.infer(node.Value)
+		if len(c.functions) > 0 {
+			c.addReturn(node.Value, value)
+		}
+		return c.newVariable(c.level)
+
+	case *ast.ThrowStatement:
+		c.infer(node.Value)
+		return c.newVariable(c.level)
+
+	case *ast.BreakStatement, *ast.ContinueStatement:
+		return c.newVariable(c.level)
+
+	case *ast.ImportStatement:
+		if node.Alias != nil {
+			c.declare(node.Alias, mono(Any))
+		}
+		for _, name := range node.Names {
+			c.declare(name, mono(Any))
+		}
+
+	case *ast.WhileStatement:
+		c.infer(node.Condition)
+		c.checkBlock(node.Consequence)
+
+	case *ast.ForStatement:
+		c.openScope()
+		if node.Init != nil {
+			c.checkStatement(node.Init)
+		}
+		if node.Condition != nil {
+			c.infer(node.Condition)
+		}
+		c.checkBlock(node.Body)
+		if node.Post != nil {
+			c.checkStatement(node.Post)
+		}
+		c.closeScope()
+
+	case *ast.ForInStatement:
+		var element Type = Any
+		switch t := prune(c.infer(node.Iterable)).(type) {
+		case *Array:
+			element = t.Element
+		case *Hash:
+			element = t.Key
+		case *Basic:
+			if t == String {
+				element = String
+			} else if t != Any {
+				c.errorf(node.Iterable, "cannot iterate over %s", t)
+			}
+		case *Function:
+			c.errorf(node.Iterable, "cannot iterate over %s", t)
+		}
+		c.openScope()
+		c.declare(node.Variable, mono(element))
+		c.scan(node.Body.Statements)
+		c.checkStatements(node.Body.Statements)
+		c.closeScope()
+
+	case *ast.TryStatement:
+		result := c.checkBlock(node.Block)
+		if node.Catch != nil {
+			c.openScope()
+			if node.Parameter != nil {
+				c.declare(node.Parameter, mono(&Hash{Key: String, Value: Any}))
+			}
+			c.scan(node.Catch.Statements)
+			result = c.join(result, c.checkStatements(node.Catch.Statements))
+			c.closeScope()
+		}
+		if node.Finally != nil {
+			c.checkBlock(node.Finally)
+		}
+		return result
+	}
+	return Null
+}
+
+// checkDeclaration checks a let or const statement. Function literals are
+// generalized, other values keep a single type.
+func (c *checker) checkDeclaration(name *ast.Identifier, value ast.Expression) {
+	declared, _ := c.lookup(name.Value)
+
+	c.level++
+	t := c.infer(value)
+	c.level--
+
+	if name.Type != nil {
+		annotated := annotation(name.Type)
+		if !c.unify(annotated, t) {
+			c.errorf(value, "cannot use %s as %s in the declaration of %s", t, annotated, name.Value)
+		}
+		t = annotated
+	}
+
+	scheme := mono(t)
+	if _, ok := value.(*ast.FunctionLiteral); ok {
+		scheme = generalize(t, c.level)
+	} else {
+		c.lower(t, c.level)
+	}
+	// code written before the declaration, in a function, may already
+	// have used the variable declared by scan
+	if declared != nil {
+		if used := declared.Type; !c.unify(used, c.instantiate(scheme, c.level)) {
+			c.errorf(value, "%s is used as %s before its declaration as %s", name.Value, used, t)
+		}
+	}
+	c.declare(name, scheme)
+}
+
+// lower moves the variables of t to level, so that they are not generalized
+// along with a function that refers to a value of type t
+func (c *checker) lower(t Type, level int) {
+	switch t := prune(t).(type) {
+	case *Variable:
+		if t.level > level {
+			t.level = level
+		}
+	case *Array:
+		c.lower(t.Element, level)
+	case *Hash:
+		c.lower(t.Key, level)
+		c.lower(t.Value, level)
+	case *Function:
+		for _, p := range t.Params {
+			c.lower(p, level)
+		}
+		c.lower(t.Return, level)
+	}
+}
+
+func (c *checker) addReturn(node ast.Node, t Type) {
+	fn := c.functions[len(c.functions)-1]
+	if fn.returnType != nil && !c.unify(fn.returnType, t) {
+		c.errorf(node, "cannot return %s from a function returning %s", t, fn.returnType)
+		return
+	}
+	fn.returns = append(fn.returns, t)
+}
+
+func (c *checker) inferFunction(lit *ast.FunctionLiteral) *Function {
+	fn := &Function{}
+	c.openScope()
+	defer c.closeScope()
+
+	for _, param := range lit.Parameters {
+		var t Type = c.newVariable(c.level)
+		if param.Type != nil {
+			t = annotation(param.Type)
+		}
+		fn.Params = append(fn.Params, t)
+		c.declare(param, mono(t))
+	}
+
+	current := &function{}
+	if lit.ReturnType != nil {
+		current.returnType = annotation(lit.ReturnType)
+	}
+	c.functions = append(c.functions, current)
+	defer func() { c.functions = c.functions[:len(c.functions)-1] }()
+
+	if lit.Body != nil {
+		c.scan(lit.Body.Statements)
+		// the value of the body is returned unless it ends with a return
+		value := c.checkStatements(lit.Body.Statements)
+		var last ast.Node = lit.Body
+		if n := len(lit.Body.Statements); n > 0 {
+			last = lit.Body.Statements[n-1]
+		}
+		if _, ok := last.(*ast.ReturnStatement); !ok {
+			c.addReturn(last, value)
+		}
+	}
+
+	if current.returnType != nil {
+		fn.Return = current.returnType
+		return fn
+	}
+	var result Type = c.newVariable(c.level)
+	for _, t := range current.returns {
+		result = c.join(result, t)
+	}
+	fn.Return = result
+	return fn
+}
+
+func (c *checker) infer(expression ast.Expression) Type {
+	switch node := expression.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+
+	case *ast.StringLiteral:
+		return String
+
+	case *ast.Boolean:
+		return Bool
+
+	case *ast.Identifier:
+		if scheme, ok := c.lookup(node.Value); ok {
+			return c.instantiate(scheme, c.level)
+		}
+		if builtin, ok := builtins[node.Value]; ok {
+			return builtin(&c.unifier, c.level)
+		}
+		// the resolver reports undefined names, and the host may define more
+		return Any
+
+	case *ast.PrefixExpression:
+		right := c.infer(node.Right)
+		if node.Operator == "-" {
+			c.expect(node.Right, right, Int, "operator -")
+			return Int
+		}
+		return Bool
+
+	case *ast.InfixExpression:
+		return c.inferInfix(node)
+
+	case *ast.IfExpression:
+		c.infer(node.Condition)
+		consequence := c.checkBlock(node.Consequence)
+		var alternative Type = Null
+		if node.Alternative != nil {
+			alternative = c.checkBlock(node.Alternative)
+		}
+		return c.join(consequence, alternative)
+
+	case *ast.FunctionLiteral:
+		return c.inferFunction(node)
+
+	case *ast.CallExpression:
+		return c.inferCall(node)
+
+	case *ast.ArrayLiteral:
+		var element Type = c.newVariable(c.level)
+		for _, e := range node.Elements {
+			element = c.join(element, c.infer(e))
+		}
+		return &Array{Element: element}
+
+	case *ast.HashLiteral:
+		var key, value Type = c.newVariable(c.level), c.newVariable(c.level)
+		for _, pair := range node.Pairs {
+			k := c.infer(pair.Key)
+			switch t := prune(k).(type) {
+			case *Variable:
+			default:
+				if t != Int && t != String && t != Bool && t != Any {
+					c.errorf(pair.Key, "unusable as hash key: %s", t)
+				}
+			}
+			key = c.join(key, k)
+			value = c.join(value, c.infer(pair.Value))
+		}
+		return &Hash{Key: key, Value: value}
+
+	case *ast.IndexExpression:
+		return c.inferIndex(node)
+
+	case *ast.MemberExpression:
+		switch t := prune(c.infer(node.Object)).(type) {
+		case *Hash:
+			c.expect(node.Object, t.Key, String, "member access")
+			return t.Value
+		case *Basic:
+			if t != Any {
+				c.errorf(node, "%s has no member %s", t, node.Property.Value)
+			}
+		}
+		return Any
+
+	case *ast.MatchExpression:
+		subject := c.infer(node.Subject)
+		var result Type = c.newVariable(c.level)
+		for _, arm := range node.Arms {
+			c.openScope()
+			c.bindPattern(arm.Pattern, subject)
+			c.scan(arm.Body.Statements)
+			result = c.join(result, c.checkStatements(arm.Body.Statements))
+			c.closeScope()
+		}
+		return result
+	}
+	return Any
+}
+
+// bindPattern declares the names bound by a match pattern matched against
+// a value of type t
+func (c *checker) bindPattern(pattern ast.Expression, t Type) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			c.declare(pattern, mono(t))
+		}
+	case *ast.ArrayLiteral:
+		var element Type = Any
+		if array, ok := prune(t).(*Array); ok {
+			element = array.Element
+		}
+		for _, e := range pattern.Elements {
+			c.bindPattern(e, element)
+		}
+	case *ast.HashLiteral:
+		var value Type = Any
+		if hash, ok := prune(t).(*Hash); ok {
+			value = hash.Value
+		}
+		for _, pair := range pattern.Pairs {
+			c.bindPattern(pair.Value, value)
+		}
+	}
+}
+
+// expect reports an error when t, the type of node, is not want
+func (c *checker) expect(node ast.Node, t, want Type, what string) {
+	if !c.unify(t, want) {
+		c.errorf(node, "%s expects %s, got %s", what, want, t)
+	}
+}
+
+func (c *checker) inferInfix(node *ast.InfixExpression) Type {
+	left := c.infer(node.Left)
+	right := c.infer(node.Right)
+
+	switch node.Operator {
+	case "+":
+		if !c.unify(left, right) {
+			c.errorf(node, "operator + not defined on %s and %s", left, right)
+			return Any
+		}
+		c.addOperands = append(c.addOperands, operand{node: node, t: left})
+		return left
+	case "-", "*", "/":
+		c.expect(node.Left, left, Int, "operator "+node.Operator)
+		c.expect(node.Right, right, Int, "operator "+node.Operator)
+		return Int
+	case "<", ">":
+		c.expect(node.Left, left, Int, "operator "+node.Operator)
+		c.expect(node.Right, right, Int, "operator "+node.Operator)
+		return Bool
+	}
+	// == and != compare values of any types
+	return Bool
+}
+
+func (c *checker) inferCall(node *ast.CallExpression) Type {
+	callee := c.infer(node.Function)
+	args := make([]Type, len(node.Arguments))
+	for i, arg := range node.Arguments {
+		args[i] = c.infer(arg)
+	}
+
+	switch fn := prune(callee).(type) {
+	case *Function:
+		if !fn.Variadic && len(args) != len(fn.Params) {
+			c.errorf(node, "wrong number of arguments to %s: want=%d, got=%d", node.Function, len(fn.Params), len(args))
+			return fn.Return
+		}
+		for i, arg := range args {
+			param := fn.Params[len(fn.Params)-1]
+			if i < len(fn.Params) {
+				param = fn.Params[i]
+			}
+			if !c.unify(param, arg) {
+				c.errorf(node.Arguments[i], "argument %d to %s: expected %s, got %s", i+1, node.Function, param, arg)
+			}
+		}
+		return fn.Return
+
+	case *Variable:
+		result := c.newVariable(c.level)
+		c.unify(fn, &Function{Params: args, Return: result})
+		return result
+
+	case *Basic:
+		if fn != Any {
+			c.errorf(node.Function, "cannot call %s", fn)
+		}
+	case *Array, *Hash:
+		c.errorf(node.Function, "cannot call %s", fn)
+	}
+	return Any
+}
+
+func (c *checker) inferIndex(node *ast.IndexExpression) Type {
+	left := c.infer(node.Left)
+	index := c.infer(node.Index)
+
+	switch t := prune(left).(type) {
+	case *Array:
+		c.expect(node.Index, index, Int, "array index")
+		return t.Element
+	case *Hash:
+		c.expect(node.Index, index, t.Key, "hash index")
+		return t.Value
+	case *Basic:
+		if t == String {
+			c.expect(node.Index, index, Int, "string index")
+			return String
+		}
+		if t != Any {
+			c.errorf(node.Left, "cannot index %s", t)
+		}
+	case *Function:
+		c.errorf(node.Left, "cannot index %s", t)
+	}
+	return Any
+}
@@ -0,0 +1,336 @@
+// Package types infers the static types of a program and reports the
+// operations that would fail at runtime because of them, such as 1 + "a".
+//
+// Inference follows Hindley-Milner: every expression gets a type, unknown
+// types are type variables solved by unification, and functions bound by let
+// or declared with fn are generalized so they can be used at several types.
+// Typing is gradual: type annotations are optional, the type any accepts
+// every value, and values that mix types, such as [1, "a"] or the result of
+// an if whose branches differ, are typed any instead of being rejected.
+package types
+
+import (
+	"strings"
+)
+
+// Type is the static type of a value
+type Type interface {
+	String() string
+}
+
+// Basic is one of the types int, string, bool and null
+type Basic struct {
+	Name string
+}
+
+func (b *Basic) String() string { return b.Name }
+
+var (
+	Int    = &Basic{Name: "int"}
+	String = &Basic{Name: "string"}
+	Bool   = &Basic{Name: "bool"}
+	Null   = &Basic{Name: "null"}
+	// Any is the type of values whose type is not known statically. It is
+	// compatible with every other type.
+	Any = &Basic{Name: "any"}
+)
+
+// Array is the type of arrays whose elements all have the type Element
+type Array struct {
+	Element Type
+}
+
+func (a *Array) String() string { return format(a, map[*Variable]string{}) }
+
+// Hash is the type of hashes with keys of type Key and values of type Value
+type Hash struct {
+	Key   Type
+	Value Type
+}
+
+func (h *Hash) String() string { return format(h, map[*Variable]string{}) }
+
+// Function is the type of functions. A variadic function accepts any
+// number of arguments of the type of its only parameter.
+type Function struct {
+	Params   []Type
+	Return   Type
+	Variadic bool
+}
+
+func (f *Function) String() string { return format(f, map[*Variable]string{}) }
+
+// Variable is a type that is not known yet. Unification binds it to the
+// type it turns out to be.
+type Variable struct {
+	id    int
+	level int // level is the depth of let bindings it was created at, see generalize
+	bound Type
+}
+
+func (v *Variable) String() string { return format(v, map[*Variable]string{}) }
+
+// prune follows bound variables to the type they stand for
+func prune(t Type) Type {
+	for {
+		v, ok := t.(*Variable)
+		if !ok || v.bound == nil {
+			return t
+		}
+		t = v.bound
+	}
+}
+
+// format prints t, naming its unbound variables a, b, c... in the order
+// they appear
+func format(t Type, names map[*Variable]string) string {
+	switch t := prune(t).(type) {
+	case *Variable:
+		name, ok := names[t]
+		if !ok {
+			name = variableName(len(names))
+			names[t] = name
+		}
+		return name
+	case *Array:
+		return "[" + format(t.Element, names) + "]"
+	case *Hash:
+		return "{" + format(t.Key, names) + ": " + format(t.Value, names) + "}"
+	case *Function:
+		params := []string{}
+		for _, p := range t.Params {
+			params = append(params, format(p, names))
+		}
+		if t.Variadic {
+			params[len(params)-1] = "..." + params[len(params)-1]
+		}
+		return "fn(" + strings.Join(params, ", ") + "): " + format(t.Return, names)
+	case *Basic:
+		return t.Name
+	}
+	return "?"
+}
+
+// Signature formats the type t of a function declared with the given name
+// and parameters, such as fn add(a: int, b: int): int
+func Signature(name string, params []string, t Type) string {
+	fn, ok := prune(t).(*Function)
+	if !ok || len(fn.Params) != len(params) {
+		return "fn " + name + "(" + strings.Join(params, ", ") + ")"
+	}
+
+	names := map[*Variable]string{}
+	typed := make([]string, len(params))
+	for i, param := range params {
+		typed[i] = param + ": " + format(fn.Params[i], names)
+	}
+	return "fn " + name + "(" + strings.Join(typed, ", ") + "): " + format(fn.Return, names)
+}
+
+func variableName(i int) string {
+	name := string(rune('a' + i%26))
+	if i >= 26 {
+		name += strings.Repeat("'", i/26)
+	}
+	return name
+}
+
+// Scheme is a type that can be used at several types: every use of it
+// replaces the variables Vars with fresh ones
+type Scheme struct {
+	Vars []*Variable
+	Type Type
+}
+
+func (s *Scheme) String() string { return s.Type.String() }
+
+// change records the state of a variable before unification changed it
+type change struct {
+	v     *Variable
+	bound Type
+	level int
+}
+
+// unifier binds type variables, and can undo the bindings of a failed
+// unification so that the types are left as they were
+type unifier struct {
+	trail  []change
+	nextID int
+}
+
+func (u *unifier) newVariable(level int) *Variable {
+	u.nextID++
+	return &Variable{id: u.nextID, level: level}
+}
+
+func (u *unifier) record(v *Variable) {
+	u.trail = append(u.trail, change{v: v, bound: v.bound, level: v.level})
+}
+
+// unify makes a and b the same type. When that is impossible it reports
+// false and leaves every variable as it was.
+func (u *unifier) unify(a, b Type) bool {
+	mark := len(u.trail)
+	if u.unifyTypes(a, b) {
+		return true
+	}
+	for i := len(u.trail) - 1; i >= mark; i-- {
+		c := u.trail[i]
+		c.v.bound = c.bound
+		c.v.level = c.level
+	}
+	u.trail = u.trail[:mark]
+	return false
+}
+
+func (u *unifier) unifyTypes(a, b Type) bool {
+	a, b = prune(a), prune(b)
+	if a == b {
+		return true
+	}
+
+	if v, ok := a.(*Variable); ok {
+		return u.bind(v, b)
+	}
+	if v, ok := b.(*Variable); ok {
+		return u.bind(v, a)
+	}
+	if a == Any || b == Any {
+		return true
+	}
+
+	switch a := a.(type) {
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && u.unifyTypes(a.Element, b.Element)
+	case *Hash:
+		b, ok := b.(*Hash)
+		return ok && u.unifyTypes(a.Key, b.Key) && u.unifyTypes(a.Value, b.Value)
+	case *Function:
+		b, ok := b.(*Function)
+		if !ok || a.Variadic != b.Variadic || len(a.Params) != len(b.Params) {
+			return false
+		}
+		for i := range a.Params {
+			if !u.unifyTypes(a.Params[i], b.Params[i]) {
+				return false
+			}
+		}
+		return u.unifyTypes(a.Return, b.Return)
+	}
+	return false
+}
+
+// bind binds v to t, unless v occurs in t which would make an infinite type
+func (u *unifier) bind(v *Variable, t Type) bool {
+	if u.occurs(v, t) {
+		return false
+	}
+	u.record(v)
+	v.bound = t
+	return true
+}
+
+// occurs reports whether v occurs in t. It also lowers the level of the
+// variables of t to the level of v, since they are now reachable from it.
+func (u *unifier) occurs(v *Variable, t Type) bool {
+	switch t := prune(t).(type) {
+	case *Variable:
+		if t == v {
+			return true
+		}
+		if t.level > v.level {
+			u.record(t)
+			t.level = v.level
+		}
+	case *Array:
+		return u.occurs(v, t.Element)
+	case *Hash:
+		return u.occurs(v, t.Key) || u.occurs(v, t.Value)
+	case *Function:
+		for _, p := range t.Params {
+			if u.occurs(v, p) {
+				return true
+			}
+		}
+		return u.occurs(v, t.Return)
+	}
+	return false
+}
+
+// join returns the type of a value that is either of type a or of type b:
+// their unification when they have one, any otherwise
+func (u *unifier) join(a, b Type) Type {
+	if u.unify(a, b) {
+		return a
+	}
+	return Any
+}
+
+// generalize turns t into a scheme over its variables created deeper than level
+func generalize(t Type, level int) *Scheme {
+	scheme := &Scheme{Type: t}
+	seen := map[*Variable]bool{}
+	var collect func(t Type)
+	collect = func(t Type) {
+		switch t := prune(t).(type) {
+		case *Variable:
+			if t.level > level && !seen[t] {
+				seen[t] = true
+				scheme.Vars = append(scheme.Vars, t)
+			}
+		case *Array:
+			collect(t.Element)
+		case *Hash:
+			collect(t.Key)
+			collect(t.Value)
+		case *Function:
+			for _, p := range t.Params {
+				collect(p)
+			}
+			collect(t.Return)
+		}
+	}
+	collect(t)
+	return scheme
+}
+
+// instantiate returns the type of s with its variables replaced by fresh
+// ones created at level
+func (u *unifier) instantiate(s *Scheme, level int) Type {
+	if len(s.Vars) == 0 {
+		return s.Type
+	}
+	fresh := map[*Variable]Type{}
+	for _, v := range s.Vars {
+		fresh[v] = u.newVariable(level)
+	}
+	var copyType func(t Type) Type
+	copyType = func(t Type) Type {
+		switch t := prune(t).(type) {
+		case *Variable:
+			if f, ok := fresh[t]; ok {
+				return f
+			}
+			return t
+		case *Array:
+			return &Array{Element: copyType(t.Element)}
+		case *Hash:
+			return &Hash{Key: copyType(t.Key), Value: copyType(t.Value)}
+		case *Function:
+			params := make([]Type, len(t.Params))
+			for i, p := range t.Params {
+				params[i] = copyType(p)
+			}
+			return &Function{Params: params, Return: copyType(t.Return), Variadic: t.Variadic}
+		default:
+			return t
+		}
+	}
+	return copyType(s.Type)
+}
+
+// mono wraps a type that is never generalized into a scheme
+func mono(t Type) *Scheme {
+	return &Scheme{Type: t}
+}
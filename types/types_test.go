@@ -0,0 +1,132 @@
+package types
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func check(t *testing.T, input string) (*ast.Program, *Result) {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program, Check(program)
+}
+
+func TestCheckErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`1 + 2`, nil},
+		{`"a" + "b"`, nil},
+		{`1 + "a"`, []string{`1:1: type error: operator + not defined on int and string`}},
+		{`true + false`, []string{`1:1: type error: operator + not defined on bool`}},
+		{`"a" - 1`, []string{`1:1: type error: operator - expects int, got string`}},
+		{`-"a"`, []string{`1:2: type error: operator - expects int, got string`}},
+		{`let x: int = "a";`, []string{`1:14: type error: cannot use string as int in the declaration of x`}},
+		{`let x: [int] = [1, 2]; let y: {string: bool} = {"a": true};`, nil},
+		{`let f = fn(a: string): bool { a == "" }; f(1)`, []string{`1:44: type error: argument 1 to f: expected string, got int`}},
+		{`fn f(a): int { "s" }`, []string{`1:16: type error: cannot return string from a function returning int`}},
+		{`fn f(a): int { if (a) { return "s" } 1 }`, []string{`1:32: type error: cannot return string from a function returning int`}},
+		{`let add = fn(a, b) { a + b }; add(1, 2); add("a", "b"); add(1, "b")`, []string{
+			`1:64: type error: argument 2 to add: expected int, got string`,
+		}},
+		{`let id = fn(x) { x }; id(1) + 1; id("a") + "b"`, nil},
+		{`fn f(n) { if (n < 2) { n } else { f(n - 1) + f(n - 2) } } f(10) + 1`, nil},
+		{`fn f(n) { n - 1 } f("a")`, []string{`1:21: type error: argument 1 to f: expected int, got string`}},
+		{`let f = fn(a, b) { a }; f(1)`, []string{`1:25: type error: wrong number of arguments to f: want=2, got=1`}},
+		{`let x = 1; x()`, []string{`1:12: type error: cannot call int`}},
+		{`let x = 1; x = "a";`, []string{`1:12: type error: cannot assign string to x of type int`}},
+		{`let x: any = 1; x = "a"; x + 1`, nil},
+		{`[1, "a"]`, nil},
+		{`let a = [1, 2]; a["x"]`, []string{`1:19: type error: array index expects int, got string`}},
+		{`let h = {"a": 1}; h.a + 1; h["b"] - 1`, nil},
+		{`let h = {"a": 1}; h.a + "x"`, []string{`1:19: type error: operator + not defined on int and string`}},
+		{`push([1], "a")`, []string{`1:11: type error: argument 2 to push: expected int, got string`}},
+		{`len("abc") + len([1]); puts(1, "a"); str(1) + "a"`, nil},
+		{`assert(1 < 2); assert_eq([1], [1], "same"); assert_error(fn() { throw "x" }, "x") + "!"`, nil},
+		{`assert(true, 1)`, []string{`1:14: type error: argument 2 to assert: expected string, got int`}},
+		{`assert_error(fn(x) { x })`, []string{`1:14: type error: argument 1 to assert_error: expected fn(): any, got fn(a): a`}},
+		{`for x in [1, 2] { x + 1 } for c in "ab" { c + "!" } for x in 5 { x }`, []string{
+			`1:62: type error: cannot iterate over int`,
+		}},
+		{`match ([1, 2]) { [a, b] => a + b, _ => 0 }`, nil},
+		{`try { throw "x" } catch (e) { e.message + "!" }`, nil},
+		{`let f = fn() { later + 1 }; let later = "a";`, []string{`1:41: type error: later is used as int before its declaration as string`}},
+		{`let f: fn(int): bool = fn(x) { x > 0 }; f(1)`, nil},
+		{`let f: fn(int): bool = fn(x) { x }`, []string{`1:24: type error: cannot use fn(a): a as fn(int): bool in the declaration of f`}},
+		{`import "std/math" as math; math.max(1, 2) + "a"`, nil},
+		{`{1: "a", true: "b"}; {[1]: 2}`, []string{`1:23: type error: unusable as hash key: [int]`}},
+	}
+
+	for _, tt := range tests {
+		_, result := check(t, tt.input)
+		got := []string{}
+		for _, err := range result.Errors {
+			got = append(got, err.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("input %q:\nexpected %q\ngot      %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestInferredTypes(t *testing.T) {
+	tests := []struct {
+		input    string
+		name     string
+		expected string
+	}{
+		{`let x = 1;`, "x", "int"},
+		{`let id = fn(x) { x };`, "id", "fn(a): a"},
+		{`let compose = fn(f, g) { fn(x) { f(g(x)) } };`, "compose", "fn(fn(a): b, fn(c): a): fn(c): b"},
+		{`fn twice(f, x) { f(f(x)) }`, "twice", "fn(fn(a): a, a): a"},
+		{`let add = fn(a, b) { a + b };`, "add", "fn(a, a): a"},
+		{`let inc = fn(n) { n + 1 };`, "inc", "fn(int): int"},
+		{`let greet = fn(name: string) { "hi " + name };`, "greet", "fn(string): string"},
+		{`let xs = push([], "a");`, "xs", "[string]"},
+		{`let h = {"a": [1]};`, "h", "{string: [int]}"},
+		{`let maybe = fn(c) { if (c) { 1 } };`, "maybe", "fn(a): any"},
+		{`fn count(xs) { let n = 0; for x in xs { n = n + 1 } n }`, "count", "fn(a): int"},
+		{`let f = fn(x: int, y): bool { x > y };`, "f", "fn(int, int): bool"},
+	}
+
+	for _, tt := range tests {
+		program, result := check(t, tt.input)
+		if len(result.Errors) != 0 {
+			t.Errorf("input %q: unexpected errors %v", tt.input, result.Errors)
+			continue
+		}
+
+		var got Type
+		for ident, typ := range result.Declarations {
+			if ident.Value == tt.name && ident == declaredName(program) {
+				got = typ
+			}
+		}
+		if got == nil {
+			t.Errorf("input %q: %s is not declared", tt.input, tt.name)
+			continue
+		}
+		if got.String() != tt.expected {
+			t.Errorf("input %q: expected %s to be %s, got %s", tt.input, tt.name, tt.expected, got)
+		}
+	}
+}
+
+// declaredName returns the name declared by the first statement of program
+func declaredName(program *ast.Program) *ast.Identifier {
+	switch stmt := program.Statements[0].(type) {
+	case *ast.LetStatement:
+		return stmt.Name
+	case *ast.FunctionStatement:
+		return stmt.Name
+	}
+	return nil
+}